@@ -0,0 +1,487 @@
+// Package config loads the API's settings into one typed struct. Values
+// come from, in increasing precedence: the defaults below, an optional YAML
+// file (CONFIG_FILE) and environment variables, which include .env once
+// godotenv has loaded it. Load validates everything up front so a malformed
+// value stops the process instead of silently falling back to a default.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"portofolionetworkapi/internal/database"
+)
+
+// Fields tagged `env` are read from that variable; `secret` fields are
+// masked by Redacted.
+type Config struct {
+	App       AppConfig       `yaml:"app"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Demo      DemoConfig      `yaml:"demo"`
+	Telegram  TelegramConfig  `yaml:"telegram"`
+	Odoo      OdooConfig      `yaml:"odoo"`
+	Staleness StalenessConfig `yaml:"staleness"`
+	Commands  CommandsConfig  `yaml:"commands"`
+	Rollouts  RolloutsConfig  `yaml:"rollouts"`
+	Health    HealthConfig    `yaml:"health"`
+	Webhooks  WebhooksConfig  `yaml:"webhooks"`
+
+	// File is the YAML file that was loaded, if any
+	File string `yaml:"-"`
+}
+
+type AppConfig struct {
+	Env             string        `yaml:"env" env:"APP_ENV"`
+	Port            int           `yaml:"port" env:"APP_PORT"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// TrustedProxies lists the proxies (IPs or CIDRs, comma-separated)
+	// whose X-Forwarded-For is believed; empty trusts every peer
+	TrustedProxies string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+type DatabaseConfig struct {
+	Driver      string `yaml:"driver" env:"DB_DRIVER"`
+	URL         string `yaml:"url" env:"DATABASE_URL" secret:"url"`
+	Host        string `yaml:"host" env:"DB_HOST"`
+	Port        int    `yaml:"port" env:"DB_PORT"`
+	User        string `yaml:"user" env:"DB_USER"`
+	Password    string `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name        string `yaml:"name" env:"DB_NAME"`
+	SSLMode     string `yaml:"sslmode" env:"DB_SSLMODE"`
+	SQLitePath  string `yaml:"sqlite_path" env:"SQLITE_PATH"`
+	AutoMigrate bool   `yaml:"auto_migrate" env:"AUTO_MIGRATE"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+
+	ConnectAttempts      int           `yaml:"connect_attempts" env:"DB_CONNECT_ATTEMPTS"`
+	ConnectRetryDelay    time.Duration `yaml:"connect_retry_delay" env:"DB_CONNECT_RETRY_DELAY"`
+	ConnectRetryMaxDelay time.Duration `yaml:"connect_retry_max_delay" env:"DB_CONNECT_RETRY_MAX_DELAY"`
+}
+
+type AuthConfig struct {
+	// AgentAPIKey is the legacy shared fleet key, not bound to any device
+	AgentAPIKey       string        `yaml:"agent_api_key" env:"AGENT_API_KEY" secret:"true"`
+	AgentAuthDisabled bool          `yaml:"agent_auth_disabled" env:"AGENT_AUTH_DISABLED"`
+	AgentKeyGrace     time.Duration `yaml:"agent_key_grace_period" env:"AGENT_KEY_GRACE_PERIOD"`
+	AdminAPIKey       string        `yaml:"admin_api_key" env:"ADMIN_API_KEY" secret:"true"`
+	// JWTSecret signs dashboard access tokens; empty disables user login
+	JWTSecret       string        `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"JWT_ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"JWT_REFRESH_TOKEN_TTL"`
+}
+
+type DemoConfig struct {
+	Enabled       bool          `yaml:"enabled" env:"DEMO_MODE"`
+	MaxDevices    int           `yaml:"max_devices" env:"MAX_DEVICES"`
+	ResetInterval time.Duration `yaml:"reset_interval" env:"RESET_INTERVAL"`
+}
+
+type TelegramConfig struct {
+	BotToken string `yaml:"bot_token" env:"TELEGRAM_BOT_TOKEN" secret:"true"`
+	ChatID   string `yaml:"chat_id" env:"TELEGRAM_CHAT_ID"`
+}
+
+type OdooConfig struct {
+	URL           string `yaml:"url" env:"ODOO_URL"`
+	DB            string `yaml:"db" env:"ODOO_DB"`
+	User          string `yaml:"user" env:"ODOO_USER"`
+	Password      string `yaml:"password" env:"ODOO_PASSWORD" secret:"true"`
+	TeamID        int    `yaml:"team_id" env:"ODOO_TEAM_ID"`
+	DefaultUserID int    `yaml:"default_user_id" env:"ODOO_DEFAULT_USER_ID"`
+}
+
+type StalenessConfig struct {
+	CheckInterval time.Duration `yaml:"check_interval" env:"STALENESS_CHECK_INTERVAL"`
+	GracePeriod   time.Duration `yaml:"grace_period" env:"STALENESS_GRACE_PERIOD"`
+}
+
+type CommandsConfig struct {
+	TimeoutSweepInterval time.Duration `yaml:"timeout_sweep_interval" env:"COMMAND_TIMEOUT_SWEEP_INTERVAL"`
+	BulkMaxDevices       int           `yaml:"bulk_max_devices" env:"BULK_MAX_DEVICES"`
+}
+
+type RolloutsConfig struct {
+	TickInterval time.Duration `yaml:"tick_interval" env:"ROLLOUT_TICK_INTERVAL"`
+}
+
+type HealthConfig struct {
+	CheckTimeout    time.Duration `yaml:"check_timeout" env:"HEALTH_CHECK_TIMEOUT"`
+	DependencyCache time.Duration `yaml:"dependency_cache" env:"HEALTH_DEPENDENCY_CACHE"`
+}
+
+// WebhooksConfig holds the verification settings of each webhook source
+type WebhooksConfig struct {
+	Zabbix ZabbixWebhookConfig `yaml:"zabbix"`
+}
+
+// ZabbixWebhookConfig verifies POST /webhooks/zabbix. With a secret, every
+// request must carry a Unix timestamp and an HMAC-SHA256 signature of
+// "<timestamp>.<raw body>"; empty leaves the webhook unsigned.
+type ZabbixWebhookConfig struct {
+	Secret          string        `yaml:"secret" env:"ZABBIX_WEBHOOK_SECRET" secret:"true"`
+	SignatureHeader string        `yaml:"signature_header" env:"ZABBIX_WEBHOOK_SIGNATURE_HEADER"`
+	TimestampHeader string        `yaml:"timestamp_header" env:"ZABBIX_WEBHOOK_TIMESTAMP_HEADER"`
+	Tolerance       time.Duration `yaml:"tolerance" env:"ZABBIX_WEBHOOK_TOLERANCE"`
+	// AllowedIPs lists the IPs or CIDRs (comma-separated) allowed to call
+	// the webhook; empty allows any
+	AllowedIPs string `yaml:"allowed_ips" env:"ZABBIX_WEBHOOK_ALLOWED_IPS"`
+}
+
+// Default returns the settings used when nothing is configured
+func Default() Config {
+	return Config{
+		App: AppConfig{
+			Env:             "development",
+			Port:            8080,
+			ShutdownTimeout: 25 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Driver:               database.DriverPostgres,
+			Host:                 "localhost",
+			Port:                 5432,
+			SSLMode:              "disable",
+			SQLitePath:           "data/netops.db",
+			AutoMigrate:          true,
+			MaxOpenConns:         25,
+			MaxIdleConns:         5,
+			ConnMaxLifetime:      30 * time.Minute,
+			ConnMaxIdleTime:      5 * time.Minute,
+			ConnectAttempts:      10,
+			ConnectRetryDelay:    500 * time.Millisecond,
+			ConnectRetryMaxDelay: 15 * time.Second,
+		},
+		Auth: AuthConfig{
+			AgentKeyGrace:   24 * time.Hour,
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 7 * 24 * time.Hour,
+		},
+		Demo: DemoConfig{
+			MaxDevices:    25,
+			ResetInterval: time.Hour,
+		},
+		Odoo: OdooConfig{
+			TeamID:        1,
+			DefaultUserID: 1,
+		},
+		Staleness: StalenessConfig{
+			CheckInterval: time.Minute,
+			GracePeriod:   5 * time.Minute,
+		},
+		Commands: CommandsConfig{
+			TimeoutSweepInterval: 30 * time.Second,
+			BulkMaxDevices:       50,
+		},
+		Rollouts: RolloutsConfig{
+			TickInterval: 15 * time.Second,
+		},
+		Health: HealthConfig{
+			CheckTimeout:    2 * time.Second,
+			DependencyCache: 30 * time.Second,
+		},
+		Webhooks: WebhooksConfig{
+			Zabbix: ZabbixWebhookConfig{
+				SignatureHeader: "X-Zabbix-Signature",
+				TimestampHeader: "X-Zabbix-Timestamp",
+				Tolerance:       5 * time.Minute,
+			},
+		},
+	}
+}
+
+// Error lists every invalid setting found by Load
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// Load reads the YAML file named by CONFIG_FILE (if set), then the
+// environment, and validates the result
+func Load() (*Config, error) {
+	return load(os.Getenv)
+}
+
+// load is Load with env looking up variables; unset and empty are the same
+func load(env func(string) string) (*Config, error) {
+	cfg := Default()
+
+	if path := env("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file: %v", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+		}
+		cfg.File = path
+	}
+
+	var problems []string
+	applyEnv(reflect.ValueOf(&cfg).Elem(), env, &problems)
+
+	// PORT is set by Railway and takes precedence over APP_PORT
+	if v := env("PORT"); v != "" {
+		if err := setValue(reflect.ValueOf(&cfg.App.Port).Elem(), v); err != nil {
+			problems = append(problems, fmt.Sprintf("PORT: %v", err))
+		}
+	}
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, &Error{Problems: problems}
+	}
+	return &cfg, nil
+}
+
+// applyEnv overrides every `env` tagged field whose variable is set
+func applyEnv(v reflect.Value, env func(string) string, problems *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			applyEnv(v.Field(i), env, problems)
+			continue
+		}
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		raw := env(name)
+		if raw == "" {
+			continue
+		}
+		if err := setValue(v.Field(i), raw); err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+}
+
+func setValue(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration (e.g. 30s, 5m)", raw)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean (true or false)", raw)
+		}
+		v.SetBool(b)
+	default:
+		v.SetString(raw)
+	}
+	return nil
+}
+
+func (c *Config) validate() []string {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.App.Port > 0 && c.App.Port <= 65535, "APP_PORT: %d is not a valid port", c.App.Port)
+	check(c.App.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+	if _, err := ParseIPList(c.App.TrustedProxies); err != nil {
+		problems = append(problems, fmt.Sprintf("TRUSTED_PROXIES: %v", err))
+	}
+
+	db := c.Database
+	check(db.Driver == database.DriverPostgres || db.Driver == database.DriverSQLite,
+		"DB_DRIVER: unknown driver %q, use postgres or sqlite", db.Driver)
+	if db.Driver == database.DriverPostgres && db.URL == "" {
+		check(db.Host != "", "DB_HOST is required when DATABASE_URL is not set")
+		check(db.Port > 0 && db.Port <= 65535, "DB_PORT: %d is not a valid port", db.Port)
+	}
+	if db.URL != "" {
+		_, err := url.Parse(db.URL)
+		check(err == nil, "DATABASE_URL is not a valid URL")
+	}
+	check(db.Driver != database.DriverSQLite || db.SQLitePath != "", "SQLITE_PATH is required with DB_DRIVER=sqlite")
+	check(db.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS must not be negative")
+	check(db.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS must not be negative")
+	check(db.MaxOpenConns == 0 || db.MaxIdleConns <= db.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", db.MaxIdleConns, db.MaxOpenConns)
+	check(db.ConnMaxLifetime >= 0 && db.ConnMaxIdleTime >= 0, "DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME must not be negative")
+	check(db.ConnectAttempts >= 1, "DB_CONNECT_ATTEMPTS must be at least 1")
+	check(db.ConnectRetryDelay >= 0 && db.ConnectRetryMaxDelay >= 0, "DB_CONNECT_RETRY_DELAY and DB_CONNECT_RETRY_MAX_DELAY must not be negative")
+
+	check(!c.Auth.AgentAuthDisabled || c.App.Env != "production",
+		"AGENT_AUTH_DISABLED is not allowed with APP_ENV=production")
+	check(c.Auth.AgentAPIKey == "" || c.App.Env != "production",
+		"AGENT_API_KEY (shared fleet key) is not allowed with APP_ENV=production; issue per-device keys")
+	check(c.Auth.JWTSecret == "" || len(c.Auth.JWTSecret) >= 32, "JWT_SECRET must be at least 32 bytes")
+	check(c.Auth.AccessTokenTTL > 0, "JWT_ACCESS_TOKEN_TTL must be positive")
+	check(c.Auth.RefreshTokenTTL > c.Auth.AccessTokenTTL, "JWT_REFRESH_TOKEN_TTL must be longer than JWT_ACCESS_TOKEN_TTL")
+	check(c.Auth.AgentKeyGrace >= 0, "AGENT_KEY_GRACE_PERIOD must not be negative (0 revokes rotated keys at once)")
+
+	check(c.Demo.MaxDevices >= 0, "MAX_DEVICES must not be negative")
+	check(c.Demo.ResetInterval > 0, "RESET_INTERVAL must be positive")
+
+	check((c.Telegram.BotToken == "") == (c.Telegram.ChatID == ""),
+		"TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID must be set together")
+	if c.Odoo.URL != "" {
+		u, err := url.Parse(c.Odoo.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"ODOO_URL: %q is not an http(s) URL", c.Odoo.URL)
+	}
+	check(c.Odoo.TeamID > 0, "ODOO_TEAM_ID must be a positive Odoo helpdesk team ID")
+	check(c.Odoo.DefaultUserID > 0, "ODOO_DEFAULT_USER_ID must be a positive Odoo user ID")
+
+	check(c.Staleness.CheckInterval >= 0, "STALENESS_CHECK_INTERVAL must not be negative (0 disables the monitor)")
+	check(c.Staleness.GracePeriod > 0, "STALENESS_GRACE_PERIOD must be positive")
+	check(c.Commands.TimeoutSweepInterval > 0, "COMMAND_TIMEOUT_SWEEP_INTERVAL must be positive")
+	check(c.Commands.BulkMaxDevices > 0, "BULK_MAX_DEVICES must be positive")
+	check(c.Rollouts.TickInterval > 0, "ROLLOUT_TICK_INTERVAL must be positive")
+	check(c.Health.CheckTimeout > 0, "HEALTH_CHECK_TIMEOUT must be positive")
+	check(c.Health.DependencyCache >= 0, "HEALTH_DEPENDENCY_CACHE must not be negative")
+
+	zabbix := c.Webhooks.Zabbix
+	check(zabbix.Secret != "" || c.App.Env != "production", "ZABBIX_WEBHOOK_SECRET is required with APP_ENV=production")
+	check(zabbix.Secret == "" || len(zabbix.Secret) >= 16, "ZABBIX_WEBHOOK_SECRET must be at least 16 bytes")
+	check(zabbix.SignatureHeader != "" && zabbix.TimestampHeader != "",
+		"ZABBIX_WEBHOOK_SIGNATURE_HEADER and ZABBIX_WEBHOOK_TIMESTAMP_HEADER must not be empty")
+	check(zabbix.Tolerance > 0, "ZABBIX_WEBHOOK_TOLERANCE must be positive")
+	if _, err := ParseIPList(zabbix.AllowedIPs); err != nil {
+		problems = append(problems, fmt.Sprintf("ZABBIX_WEBHOOK_ALLOWED_IPS: %v", err))
+	}
+	return problems
+}
+
+// Production reports whether APP_ENV is production
+func (c *Config) Production() bool {
+	return c.App.Env == "production"
+}
+
+// DSN is the connection string for the configured driver: a Postgres URL or
+// keyword string, or the SQLite file path
+func (d DatabaseConfig) DSN() string {
+	if d.Driver == database.DriverSQLite {
+		return d.SQLitePath
+	}
+	if d.URL != "" {
+		return d.URL
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		d.Host, d.Port, d.User, d.Password, d.Name, d.SSLMode)
+}
+
+// ParseIPList parses a comma-separated list of IPs and CIDRs. A bare IP
+// becomes a single-address network; an empty list returns nil.
+func ParseIPList(raw string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP or CIDR", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP or CIDR", item)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+const redacted = "***"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Redacted renders the settings for operators, keyed like the YAML file.
+// Secrets are replaced by "***" when set, URLs keep everything but their
+// password ("xxxxx"), and durations are strings ("30s").
+func (c *Config) Redacted() map[string]interface{} {
+	out := display(reflect.ValueOf(*c))
+	if c.File != "" {
+		out["file"] = c.File
+	}
+	return out
+}
+
+func display(v reflect.Value) map[string]interface{} {
+	out := map[string]interface{}{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, f := t.Field(i), v.Field(i)
+		name := field.Tag.Get("yaml")
+		if name == "-" {
+			continue
+		}
+		switch {
+		case f.Type() == durationType:
+			out[name] = time.Duration(f.Int()).String()
+		case f.Kind() == reflect.Struct:
+			out[name] = display(f)
+		case field.Tag.Get("secret") == "" || f.String() == "":
+			out[name] = f.Interface()
+		case field.Tag.Get("secret") == "url":
+			out[name] = redactURL(f.String())
+		default:
+			out[name] = redacted
+		}
+	}
+	return out
+}
+
+// redactURL masks the password of a connection URL, in the userinfo and in
+// any password query parameter. Anything that is not a URL with a scheme
+// and host, such as a lib/pq keyword DSN, is masked whole.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return redacted
+	}
+	if u.RawQuery != "" {
+		query, err := url.ParseQuery(u.RawQuery)
+		if err != nil {
+			return redacted
+		}
+		for key := range query {
+			if strings.Contains(strings.ToLower(key), "password") {
+				query.Set(key, "xxxxx")
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
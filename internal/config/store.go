@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/joho/godotenv"
+)
+
+// Loader loads the configuration the same way at startup and on every
+// reload: the process environment as it was when the Loader was created,
+// then the env files (read again each time), then the YAML file.
+type Loader struct {
+	env      map[string]string
+	envFiles []string
+}
+
+// NewLoader snapshots the process environment; env files that don't exist
+// are skipped
+func NewLoader(envFiles ...string) *Loader {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return &Loader{env: env, envFiles: envFiles}
+}
+
+func (l *Loader) Load() (*Config, error) {
+	merged := map[string]string{}
+	for _, file := range l.envFiles {
+		vars, err := godotenv.Read(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Like godotenv.Load, earlier files win
+		for k, v := range vars {
+			if _, ok := merged[k]; !ok {
+				merged[k] = v
+			}
+		}
+	}
+	for k, v := range l.env {
+		merged[k] = v
+	}
+	return load(func(key string) string { return merged[key] })
+}
+
+// Reloadable sections take effect on Store.Reload; changes anywhere else
+// are reported as needing a restart
+var reloadableSections = map[string]bool{
+	"telegram": true,
+	"odoo":     true,
+}
+
+// Store holds the running configuration. Reload swaps it atomically, so a
+// reader that took Current keeps a consistent snapshot.
+type Store struct {
+	loader  *Loader
+	current atomic.Pointer[Config]
+
+	mu    sync.Mutex // serializes reloads
+	hooks []func(*Config)
+}
+
+func NewStore(loader *Loader, initial *Config) *Store {
+	s := &Store{loader: loader}
+	s.current.Store(initial)
+	return s
+}
+
+func (s *Store) Current() *Config {
+	return s.current.Load()
+}
+
+// OnReload registers fn to apply a reloaded configuration. Hooks run, in
+// registration order, before the new configuration is published, and only
+// when a reloadable section changed.
+func (s *Store) OnReload(fn func(*Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, fn)
+}
+
+// ReloadResult says which sections a reload changed
+type ReloadResult struct {
+	Config *Config
+	// Applied lists the reloadable sections that changed
+	Applied []string
+	// RestartRequired lists changed sections that only apply on restart;
+	// the running configuration keeps their old values
+	RestartRequired []string
+}
+
+// Reload loads and validates the configuration again and applies the
+// reloadable sections. On error the running configuration is unchanged.
+func (s *Store) Reload() (*ReloadResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loaded, err := s.loader.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	old := s.current.Load()
+	next := *old
+	result := &ReloadResult{Config: &next}
+
+	ov, lv, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(loaded).Elem(), reflect.ValueOf(&next).Elem()
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("yaml")
+		if name == "-" || reflect.DeepEqual(ov.Field(i).Interface(), lv.Field(i).Interface()) {
+			continue
+		}
+		if reloadableSections[name] {
+			nv.Field(i).Set(lv.Field(i))
+			result.Applied = append(result.Applied, name)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, name)
+		}
+	}
+
+	if len(result.Applied) > 0 {
+		for _, hook := range s.hooks {
+			hook(&next)
+		}
+	}
+	s.current.Store(&next)
+	return result, nil
+}
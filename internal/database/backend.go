@@ -0,0 +1,24 @@
+package database
+
+import "database/sql"
+
+// Storage backends selectable with DB_DRIVER
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Open connects to the backend for driver; dsn is the SQLite file path or
+// the Postgres connection string. For Postgres the handle is also DB; a
+// SQLite handle is only returned, so DB stays nil and Postgres-only code
+// cannot run against it.
+func Open(driver, dsn string) (*sql.DB, error) {
+	if driver == DriverSQLite {
+		return OpenSQLite(dsn)
+	}
+
+	if err := Connect(dsn); err != nil {
+		return nil, err
+	}
+	return DB, nil
+}
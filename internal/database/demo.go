@@ -0,0 +1,442 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+)
+
+// Demo mode is opt-in (see ConfigureDemoMode). Only then is there a device
+// cap of MaxDevices, and once the cap is hit the inventory is reset to the
+// sample data at the end of the current ResetInterval window. Every reset
+// snapshots the devices and the rows that depend on them first, and can be
+// undone.
+var (
+	MaxDevices    = 25
+	ResetInterval = 1 * time.Hour
+	demoMode      bool
+)
+
+var (
+	// ErrDeviceLimitReached is returned by ReserveDeviceSlot when the demo cap is full
+	ErrDeviceLimitReached = errors.New("device limit reached")
+	ErrDemoModeDisabled   = errors.New("demo mode is disabled")
+	ErrDemoResetNotFound  = errors.New("demo reset not found")
+	ErrDemoResetUndone    = errors.New("demo reset was already undone")
+)
+
+// deviceLimitLockKey serializes device creates with resets while demo mode is on
+const deviceLimitLockKey = 7250001
+
+var (
+	resetMu       sync.RWMutex
+	lastResetTime time.Time
+)
+
+// autoResetStop and autoResetDone are set while the auto-reset worker runs
+var (
+	autoResetStop chan struct{}
+	autoResetDone chan struct{}
+)
+
+// ConfigureDemoMode must be called before StartDemoAutoReset. MaxDevices
+// <= 0 keeps demo mode on without a cap; a non-positive interval keeps the
+// default.
+func ConfigureDemoMode(enabled bool, maxDevices int, interval time.Duration) {
+	demoMode = enabled
+	MaxDevices = maxDevices
+	if interval > 0 {
+		ResetInterval = interval
+	}
+}
+
+func DemoModeEnabled() bool {
+	return demoMode
+}
+
+// DeviceLimitEnabled reports whether the demo cap is enforced
+func DeviceLimitEnabled() bool {
+	return demoMode && MaxDevices > 0
+}
+
+// StartDemoAutoReset starts the background reset when the demo cap is enabled
+func StartDemoAutoReset() {
+	if !DeviceLimitEnabled() {
+		return
+	}
+	markReset()
+	autoResetStop = make(chan struct{})
+	autoResetDone = make(chan struct{})
+	go autoResetDatabase(autoResetStop, autoResetDone)
+	log.Printf("[WARN] Demo mode: inventory resets when %d devices are reached (window %s)", MaxDevices, ResetInterval)
+}
+
+// StopDemoAutoReset stops the auto-reset worker, waiting for a reset in
+// progress to commit. It does nothing when the worker was not started.
+func StopDemoAutoReset() {
+	if autoResetStop == nil {
+		return
+	}
+	close(autoResetStop)
+	<-autoResetDone
+	autoResetStop, autoResetDone = nil, nil
+}
+
+// Check if device limit reached
+func IsDeviceLimitReached() (bool, int, error) {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM devices").Scan(&count)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return DeviceLimitEnabled() && count >= MaxDevices, count, nil
+}
+
+// ReserveDeviceSlot takes a transaction-scoped lock and checks the cap, so
+// concurrent creates cannot overshoot it or interleave with a reset. Call
+// it in the same transaction as the INSERT; it returns
+// ErrDeviceLimitReached when the cap is full.
+func ReserveDeviceSlot(tx *sql.Tx) (int, error) {
+	if !DemoModeEnabled() {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, deviceLimitLockKey); err != nil {
+		return 0, err
+	}
+	if !DeviceLimitEnabled() {
+		return 0, nil
+	}
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM devices").Scan(&count); err != nil {
+		return 0, err
+	}
+	if count >= MaxDevices {
+		return count, ErrDeviceLimitReached
+	}
+	return count, nil
+}
+
+// ResetDatabase snapshots the inventory into demo_resets, then replaces it
+// with the sample devices. Refused unless demo mode is on.
+func ResetDatabase(triggeredBy, actor, reason string) (*models.DemoReset, error) {
+	if !DemoModeEnabled() {
+		return nil, ErrDemoModeDisabled
+	}
+	log.Println("🔄 Resetting database to demo state...")
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	reset, err := snapshotDevices(tx, models.DemoActionReset, triggeredBy, actor, reason, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Delete all devices
+	if _, err := tx.Exec("DELETE FROM devices"); err != nil {
+		return nil, fmt.Errorf("error deleting devices: %v", err)
+	}
+
+	// Re-insert dummy data
+	res, err := tx.Exec(`
+		INSERT INTO devices (name, ip_address, location, status, last_seen) VALUES
+			('Router-BDG-01', '192.168.100.11', 'Bandung', 'online', NOW()),
+			('Router-JKT-01', '192.168.100.12', 'Jakarta', 'online', NOW()),
+			('Router-SBY-01', '192.168.100.13', 'Surabaya', 'offline', NOW() - INTERVAL '1 hour')
+		ON CONFLICT (name) DO NOTHING
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting dummy data: %v", err)
+	}
+
+	if err := finishSnapshot(tx, reset, res); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	markReset()
+	log.Printf("✓ Database reset completed - %d devices snapshotted as reset #%d, %d demo devices restored",
+		reset.DevicesBefore, reset.ID, reset.DevicesAfter)
+	return reset, nil
+}
+
+// UndoDemoReset restores the inventory captured by reset id: the devices,
+// then their heartbeats, commands, rollout progress and API keys, and the
+// links of alerts to them. The inventory being replaced is snapshotted too,
+// so an undo can itself be undone. Snapshots taken before dependent rows
+// were captured restore the devices only.
+func UndoDemoReset(id int64, actor, reason string) (*models.DemoReset, error) {
+	if !DemoModeEnabled() {
+		return nil, ErrDemoModeDisabled
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		snapshot []byte
+		undoneAt sql.NullTime
+	)
+	err = tx.QueryRow(`SELECT snapshot, undone_at FROM demo_resets WHERE id = $1 FOR UPDATE`, id).
+		Scan(&snapshot, &undoneAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDemoResetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if undoneAt.Valid {
+		return nil, ErrDemoResetUndone
+	}
+
+	restore, err := snapshotDevices(tx, models.DemoActionRestore, models.DemoTriggerManual, actor, reason, &id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM devices"); err != nil {
+		return nil, fmt.Errorf("error deleting devices: %v", err)
+	}
+	res, restored, err := restoreSnapshot(tx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	restore.Restored = restored
+
+	if err := finishSnapshot(tx, restore, res); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE demo_resets SET undone_at = NOW() WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	markReset()
+	log.Printf("[OK] Demo reset #%d undone by %s: %d devices restored", id, actor, restore.DevicesAfter)
+	return restore, nil
+}
+
+// ListDemoResets returns the audit log, newest first
+func ListDemoResets(limit int) ([]models.DemoReset, error) {
+	rows, err := DB.Query(`
+		SELECT id, action, triggered_by, COALESCE(actor, ''), COALESCE(reason, ''), undoes_id,
+			devices_before, devices_after, undone_at, created_at
+		FROM demo_resets
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resets := []models.DemoReset{}
+	for rows.Next() {
+		var (
+			r        models.DemoReset
+			undoesID sql.NullInt64
+			undoneAt sql.NullTime
+		)
+		if err := rows.Scan(&r.ID, &r.Action, &r.TriggeredBy, &r.Actor, &r.Reason, &undoesID,
+			&r.DevicesBefore, &r.DevicesAfter, &undoneAt, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if undoesID.Valid {
+			r.UndoesID = &undoesID.Int64
+		}
+		if undoneAt.Valid {
+			r.UndoneAt = &undoneAt.Time
+		}
+		resets = append(resets, r)
+	}
+	return resets, rows.Err()
+}
+
+// snapshotTables are the tables a snapshot keeps whole, parents first.
+// Deleting the devices cascades to all the others.
+var snapshotTables = []string{"devices", "device_heartbeats", "commands", "rollout_devices", "device_api_keys"}
+
+// snapshotDevices records the audit row with the current contents of
+// snapshotTables and the device links of alerts, which survive the delete
+// unlinked. It takes the same lock as ReserveDeviceSlot so no create slips
+// in between the snapshot and the delete.
+func snapshotDevices(tx *sql.Tx, action, triggeredBy, actor, reason string, undoesID *int64) (*models.DemoReset, error) {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, deviceLimitLockKey); err != nil {
+		return nil, err
+	}
+
+	members := make([]string, 0, len(snapshotTables)+1)
+	for _, table := range snapshotTables {
+		members = append(members, fmt.Sprintf(
+			`'%[1]s', (SELECT COALESCE(jsonb_agg(to_jsonb(t)), '[]'::jsonb) FROM %[1]s t)`, table))
+	}
+	members = append(members, `'alert_links', (
+		SELECT COALESCE(jsonb_agg(jsonb_build_object('id', a.id, 'device_id', a.device_id)), '[]'::jsonb)
+		FROM alerts a WHERE a.device_id IS NOT NULL)`)
+
+	r := &models.DemoReset{Action: action, TriggeredBy: triggeredBy, Actor: actor, Reason: reason, UndoesID: undoesID}
+	err := tx.QueryRow(`
+		INSERT INTO demo_resets (action, triggered_by, actor, reason, undoes_id, devices_before, devices_after, snapshot)
+		SELECT $1::text, $2::text, NULLIF($3::text, ''), NULLIF($4::text, ''), $5::bigint,
+			(SELECT COUNT(*) FROM devices), 0, jsonb_build_object(`+strings.Join(members, ", ")+`)
+		RETURNING id, devices_before, created_at
+	`, action, triggeredBy, actor, reason, undoesID).Scan(&r.ID, &r.DevicesBefore, &r.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error snapshotting devices: %v", err)
+	}
+	return r, nil
+}
+
+// restoreSnapshot inserts the rows of a snapshot into the emptied tables
+// and relinks alerts. It returns the devices insert and the number of rows
+// restored per table. Early snapshots are a plain array of devices.
+func restoreSnapshot(tx *sql.Tx, snapshot []byte) (sql.Result, map[string]int, error) {
+	trimmed := bytes.TrimSpace(snapshot)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		log.Printf("[WARN] Demo snapshot predates dependent rows; restoring devices only")
+		res, err := tx.Exec(`INSERT INTO devices SELECT * FROM jsonb_populate_recordset(NULL::devices, $1::jsonb)`, string(snapshot))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error restoring snapshot: %v", err)
+		}
+		n, err := res.RowsAffected()
+		return res, map[string]int{"devices": int(n)}, err
+	}
+
+	var devices sql.Result
+	restored := map[string]int{}
+	for _, table := range snapshotTables {
+		res, err := tx.Exec(fmt.Sprintf(
+			`INSERT INTO %[1]s SELECT * FROM jsonb_populate_recordset(NULL::%[1]s, $1::jsonb -> '%[1]s')`, table),
+			string(snapshot))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error restoring %s: %v", table, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, nil, err
+		}
+		if table == "devices" {
+			devices = res
+		}
+		restored[table] = int(n)
+	}
+
+	res, err := tx.Exec(`
+		UPDATE alerts a SET device_id = l.device_id
+		FROM jsonb_to_recordset($1::jsonb -> 'alert_links') AS l(id BIGINT, device_id UUID)
+		WHERE a.id = l.id
+	`, string(snapshot))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error relinking alerts: %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, nil, err
+	}
+	restored["alert_links"] = int(n)
+	return devices, restored, nil
+}
+
+func finishSnapshot(tx *sql.Tx, r *models.DemoReset, inserted sql.Result) error {
+	n, err := inserted.RowsAffected()
+	if err != nil {
+		return err
+	}
+	r.DevicesAfter = int(n)
+	_, err = tx.Exec(`UPDATE demo_resets SET devices_after = $1 WHERE id = $2`, r.DevicesAfter, r.ID)
+	return err
+}
+
+// Auto-reset background task
+func autoResetDatabase(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(autoResetCheckInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		// Check if reset interval passed
+		if GetTimeUntilReset() > 0 {
+			continue
+		}
+
+		// Check device count
+		var count int
+		err := DB.QueryRow("SELECT COUNT(*) FROM devices").Scan(&count)
+		if err != nil {
+			log.Printf("Error checking device count: %v", err)
+			continue
+		}
+
+		// Reset if limit was reached, otherwise just start a new window
+		if count >= MaxDevices {
+			log.Printf("🔄 Auto-reset triggered: %d devices (limit: %d)", count, MaxDevices)
+			if _, err := ResetDatabase(models.DemoTriggerAuto, "system", "device limit reached"); err != nil {
+				log.Printf("Error during auto-reset: %v", err)
+			}
+		} else {
+			markReset()
+		}
+	}
+}
+
+// autoResetCheckInterval keeps the countdown reported to clients accurate
+// to within a minute, or a tenth of short intervals
+func autoResetCheckInterval() time.Duration {
+	d := ResetInterval / 10
+	switch {
+	case d < time.Second:
+		return time.Second
+	case d > time.Minute:
+		return time.Minute
+	}
+	return d
+}
+
+func markReset() {
+	resetMu.Lock()
+	lastResetTime = time.Now()
+	resetMu.Unlock()
+}
+
+// NextResetAt is when the current reset window ends
+func NextResetAt() time.Time {
+	resetMu.RLock()
+	defer resetMu.RUnlock()
+	return lastResetTime.Add(ResetInterval)
+}
+
+// Get time until next reset
+func GetTimeUntilReset() time.Duration {
+	remaining := time.Until(NextResetAt())
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
@@ -12,8 +12,8 @@ CREATE TABLE IF NOT EXISTS devices (
 );
 
 -- Create index for faster queries
-CREATE INDEX idx_devices_status ON devices(status);
-CREATE INDEX idx_devices_name ON devices(name);
+CREATE INDEX IF NOT EXISTS idx_devices_status ON devices(status);
+CREATE INDEX IF NOT EXISTS idx_devices_name ON devices(name);
 
 -- Insert sample data
 INSERT INTO devices (name, ip_address, location, status, last_seen) VALUES
@@ -0,0 +1,15 @@
+-- Create heartbeats table for agent-reported metrics
+CREATE TABLE IF NOT EXISTS device_heartbeats (
+    id BIGSERIAL PRIMARY KEY,
+    device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL,
+    version VARCHAR(50),
+    uptime VARCHAR(50),
+    cpu_load VARCHAR(20),
+    free_memory VARCHAR(20),
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Latest heartbeats per device are read most often
+CREATE INDEX IF NOT EXISTS idx_device_heartbeats_device_received
+    ON device_heartbeats(device_id, received_at DESC);
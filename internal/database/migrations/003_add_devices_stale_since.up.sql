@@ -0,0 +1,2 @@
+-- Track when the staleness monitor marked a device offline
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS stale_since TIMESTAMP;
@@ -0,0 +1,21 @@
+-- Create command queue table
+-- Status flow: pending -> dispatched -> executing -> succeeded | failed | timed_out
+CREATE TABLE IF NOT EXISTS commands (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    parameters JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    result JSONB,
+    error TEXT,
+    timeout_seconds INT NOT NULL DEFAULT 300,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    dispatched_at TIMESTAMP,
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Agents poll for pending work per device in FIFO order
+CREATE INDEX IF NOT EXISTS idx_commands_device_status
+    ON commands(device_id, status, created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_commands_job;
+ALTER TABLE commands DROP COLUMN IF EXISTS job_id;
+DROP TABLE IF EXISTS command_jobs;
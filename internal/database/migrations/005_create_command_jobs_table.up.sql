@@ -0,0 +1,13 @@
+-- Create bulk command jobs; each job fans out to one command per device
+CREATE TABLE IF NOT EXISTS command_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    command_type VARCHAR(50) NOT NULL,
+    parameters JSONB NOT NULL DEFAULT '{}',
+    device_filter JSONB NOT NULL,
+    total_devices INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS job_id UUID REFERENCES command_jobs(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_commands_job ON commands(job_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS rollout_devices;
+DROP TABLE IF EXISTS rollouts;
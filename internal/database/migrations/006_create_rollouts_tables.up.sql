@@ -0,0 +1,35 @@
+-- Create firmware rollouts, executed in waves (canary first, then batches)
+CREATE TABLE IF NOT EXISTS rollouts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    target_version VARCHAR(50) NOT NULL,
+    firmware_url TEXT,
+    device_filter JSONB NOT NULL,
+    canary_percent INT NOT NULL DEFAULT 10,
+    batch_size INT NOT NULL DEFAULT 10,
+    failure_threshold DOUBLE PRECISION NOT NULL DEFAULT 0.2,
+    timeout_seconds INT NOT NULL DEFAULT 1800,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    current_wave INT NOT NULL DEFAULT 0,
+    total_waves INT NOT NULL DEFAULT 0,
+    pause_reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_rollouts_status ON rollouts(status);
+
+-- Per-device progress within a rollout
+CREATE TABLE IF NOT EXISTS rollout_devices (
+    rollout_id UUID NOT NULL REFERENCES rollouts(id) ON DELETE CASCADE,
+    device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    wave INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    command_id UUID REFERENCES commands(id) ON DELETE SET NULL,
+    previous_version VARCHAR(50),
+    error TEXT,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (rollout_id, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rollout_devices_status ON rollout_devices(status);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_devices_last_seen_id;
+DROP INDEX IF EXISTS idx_devices_created_at_id;
+DROP INDEX IF EXISTS idx_devices_name_id;
+DROP INDEX IF EXISTS idx_devices_location;
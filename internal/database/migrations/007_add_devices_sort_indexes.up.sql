@@ -0,0 +1,7 @@
+-- Keyset pagination indexes; expressions must match the ORDER BY in ListDevices
+CREATE INDEX IF NOT EXISTS idx_devices_last_seen_id
+    ON devices ((COALESCE(last_seen, 'epoch'::timestamp)), id);
+CREATE INDEX IF NOT EXISTS idx_devices_created_at_id
+    ON devices ((COALESCE(created_at, 'epoch'::timestamp)), id);
+CREATE INDEX IF NOT EXISTS idx_devices_name_id ON devices(name, id);
+CREATE INDEX IF NOT EXISTS idx_devices_location ON devices(LOWER(location));
@@ -0,0 +1,20 @@
+-- Record every alert handled by the orchestrator so open incidents can be
+-- shown per device. RESOLVED events close the alert with the same event_id.
+CREATE TABLE IF NOT EXISTS alerts (
+    id BIGSERIAL PRIMARY KEY,
+    event_id VARCHAR(100) NOT NULL UNIQUE,
+    device_id UUID REFERENCES devices(id) ON DELETE SET NULL,
+    device_name VARCHAR(100) NOT NULL,
+    ip_address VARCHAR(45),
+    severity VARCHAR(20),
+    problem TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    ticket_id INT,
+    customers_affected INT DEFAULT 0,
+    sla_status VARCHAR(20),
+    opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_device_status ON alerts(device_id, status);
@@ -0,0 +1,2 @@
+-- Revision counter backing device ETags; bumped on every visible change
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_commands_device_created;
+ALTER TABLE alerts DROP COLUMN IF EXISTS last_raised_at;
+ALTER TABLE alerts DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE devices DROP COLUMN IF EXISTS tenant_id;
+DROP TABLE IF EXISTS tenants;
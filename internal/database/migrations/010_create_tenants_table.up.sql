@@ -0,0 +1,31 @@
+-- Tenants (customer NOCs) sharing one deployment, with per-tenant quotas.
+-- NULL quota = unlimited. Devices without an explicit tenant belong to
+-- 'default'.
+CREATE TABLE IF NOT EXISTS tenants (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(200) NOT NULL,
+    max_devices INT CHECK (max_devices >= 0),
+    max_commands_per_hour INT CHECK (max_commands_per_hour >= 0),
+    max_alerts_per_hour INT CHECK (max_alerts_per_hour >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO tenants (id, name) VALUES ('default', 'Default')
+ON CONFLICT (id) DO NOTHING;
+
+ALTER TABLE devices
+    ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+CREATE INDEX IF NOT EXISTS idx_devices_tenant ON devices(tenant_id);
+
+-- Alerts are charged to the tenant of the matched device. last_raised_at
+-- moves each time the alert is opened or reopened and drives the hourly quota.
+ALTER TABLE alerts
+    ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+ALTER TABLE alerts
+    ADD COLUMN IF NOT EXISTS last_raised_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_alerts_tenant_raised ON alerts(tenant_id, last_raised_at);
+
+-- Hourly command usage is counted per device, newest first
+CREATE INDEX IF NOT EXISTS idx_commands_device_created
+    ON commands(device_id, created_at);
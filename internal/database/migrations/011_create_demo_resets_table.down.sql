@@ -0,0 +1 @@
+DROP TABLE IF EXISTS demo_resets;
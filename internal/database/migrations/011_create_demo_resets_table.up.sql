@@ -0,0 +1,18 @@
+-- Audit log of demo inventory resets and their undo operations. Each row
+-- keeps the full devices table as it was right before the operation, so
+-- any entry can be undone by restoring its snapshot.
+CREATE TABLE IF NOT EXISTS demo_resets (
+    id BIGSERIAL PRIMARY KEY,
+    action VARCHAR(20) NOT NULL,
+    triggered_by VARCHAR(20) NOT NULL,
+    actor VARCHAR(200),
+    reason TEXT,
+    undoes_id BIGINT REFERENCES demo_resets(id),
+    devices_before INT NOT NULL,
+    devices_after INT NOT NULL,
+    snapshot JSONB NOT NULL,
+    undone_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_demo_resets_created ON demo_resets(created_at DESC);
@@ -0,0 +1,15 @@
+-- Per-device agent API keys. Only the SHA-256 of the key is stored; prefix
+-- is the public part of the key used to find the row. A rotated key keeps
+-- working until expires_at (NULL = no expiry).
+CREATE TABLE IF NOT EXISTS device_api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    prefix VARCHAR(32) NOT NULL UNIQUE,
+    key_hash CHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_api_keys_device ON device_api_keys(device_id);
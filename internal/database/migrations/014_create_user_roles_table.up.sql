@@ -0,0 +1,14 @@
+-- Roles granted to dashboard users. An empty location grants the role
+-- everywhere; otherwise only for devices at that location.
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('viewer', 'operator', 'admin')),
+    location VARCHAR(200) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role, location)
+);
+
+-- Users created before roles existed could do everything; keep it that way
+INSERT INTO user_roles (user_id, role)
+SELECT id, 'admin' FROM users
+ON CONFLICT DO NOTHING;
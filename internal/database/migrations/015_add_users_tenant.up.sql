@@ -0,0 +1,5 @@
+-- Every user belongs to one tenant; the tenant of a dashboard request is
+-- the tenant of its user. Existing users stay in 'default'.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+CREATE INDEX IF NOT EXISTS idx_users_tenant ON users(tenant_id);
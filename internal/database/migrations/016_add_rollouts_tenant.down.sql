@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_rollouts_tenant_created;
+ALTER TABLE rollouts DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,5 @@
+-- A rollout belongs to the tenant that created it and only covers that
+-- tenant's devices. Existing rollouts stay in 'default'.
+ALTER TABLE rollouts
+    ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+CREATE INDEX IF NOT EXISTS idx_rollouts_tenant_created ON rollouts(tenant_id, created_at);
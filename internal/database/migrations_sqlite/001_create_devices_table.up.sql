@@ -0,0 +1,38 @@
+-- SQLite schema for single-box deployments. Timestamps are UTC text in
+-- the "YYYY-MM-DD HH:MM:SS.SSS" form so they compare correctly as strings,
+-- and UUIDs are generated from randomblob() as there is no gen_random_uuid().
+CREATE TABLE IF NOT EXISTS tenants (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(200) NOT NULL,
+    max_devices INT CHECK (max_devices >= 0),
+    max_commands_per_hour INT CHECK (max_commands_per_hour >= 0),
+    max_alerts_per_hour INT CHECK (max_alerts_per_hour >= 0),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+INSERT INTO tenants (id, name) VALUES ('default', 'Default')
+ON CONFLICT (id) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS devices (
+    id TEXT PRIMARY KEY DEFAULT (lower(
+        hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+        substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+    )),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    ip_address VARCHAR(45) NOT NULL,
+    location VARCHAR(200),
+    status VARCHAR(20) DEFAULT 'offline',
+    version VARCHAR(50),
+    last_seen TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    stale_since TIMESTAMP,
+    revision BIGINT NOT NULL DEFAULT 1,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_devices_status ON devices(status);
+CREATE INDEX IF NOT EXISTS idx_devices_tenant ON devices(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_devices_last_seen ON devices(COALESCE(last_seen, '1970-01-01 00:00:00.000'), id);
+CREATE INDEX IF NOT EXISTS idx_devices_created_at ON devices(COALESCE(created_at, '1970-01-01 00:00:00.000'), id);
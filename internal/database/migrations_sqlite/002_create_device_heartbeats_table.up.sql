@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS device_heartbeats (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL,
+    version VARCHAR(50),
+    uptime VARCHAR(50),
+    cpu_load VARCHAR(20),
+    free_memory VARCHAR(20),
+    received_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_heartbeats_device_received
+    ON device_heartbeats(device_id, received_at DESC);
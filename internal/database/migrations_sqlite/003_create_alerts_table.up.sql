@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS alerts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id VARCHAR(100) NOT NULL UNIQUE,
+    device_id TEXT REFERENCES devices(id) ON DELETE SET NULL,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants(id),
+    device_name VARCHAR(100) NOT NULL,
+    ip_address VARCHAR(45),
+    severity VARCHAR(20),
+    problem TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    ticket_id INT,
+    customers_affected INT DEFAULT 0,
+    sla_status VARCHAR(20),
+    opened_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    resolved_at TIMESTAMP,
+    last_raised_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_device_status ON alerts(device_id, status);
+CREATE INDEX IF NOT EXISTS idx_alerts_tenant_raised ON alerts(tenant_id, last_raised_at);
@@ -0,0 +1,17 @@
+-- Create bulk command jobs; each job fans out to one command per device.
+-- parameters and device_filter hold JSON text
+CREATE TABLE IF NOT EXISTS command_jobs (
+    id TEXT PRIMARY KEY DEFAULT (lower(
+        hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+        substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+    )),
+    command_type VARCHAR(50) NOT NULL,
+    parameters TEXT NOT NULL DEFAULT '{}',
+    device_filter TEXT NOT NULL,
+    total_devices INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+ALTER TABLE commands ADD COLUMN job_id TEXT REFERENCES command_jobs(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_commands_job ON commands(job_id);
@@ -0,0 +1,39 @@
+-- Create firmware rollouts, executed in waves (canary first, then batches).
+-- device_filter holds JSON text
+CREATE TABLE IF NOT EXISTS rollouts (
+    id TEXT PRIMARY KEY DEFAULT (lower(
+        hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+        substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+    )),
+    target_version VARCHAR(50) NOT NULL,
+    firmware_url TEXT,
+    device_filter TEXT NOT NULL,
+    canary_percent INT NOT NULL DEFAULT 10,
+    batch_size INT NOT NULL DEFAULT 10,
+    failure_threshold DOUBLE PRECISION NOT NULL DEFAULT 0.2,
+    timeout_seconds INT NOT NULL DEFAULT 1800,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    current_wave INT NOT NULL DEFAULT 0,
+    total_waves INT NOT NULL DEFAULT 0,
+    pause_reason TEXT,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_rollouts_status ON rollouts(status);
+
+-- Per-device progress within a rollout
+CREATE TABLE IF NOT EXISTS rollout_devices (
+    rollout_id TEXT NOT NULL REFERENCES rollouts(id) ON DELETE CASCADE,
+    device_id TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    wave INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    command_id TEXT REFERENCES commands(id) ON DELETE SET NULL,
+    previous_version VARCHAR(50),
+    error TEXT,
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    PRIMARY KEY (rollout_id, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rollout_devices_status ON rollout_devices(status);
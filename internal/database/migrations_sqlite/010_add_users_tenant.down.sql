@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_tenant;
+ALTER TABLE users DROP COLUMN tenant_id;
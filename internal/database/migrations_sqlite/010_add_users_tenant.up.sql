@@ -0,0 +1,4 @@
+-- SQLite cannot add a REFERENCES column with a non-NULL default, so the
+-- user repository checks that the tenant exists instead of a foreign key.
+ALTER TABLE users ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+CREATE INDEX IF NOT EXISTS idx_users_tenant ON users(tenant_id);
@@ -0,0 +1,4 @@
+-- See 010_add_users_tenant: no foreign key on an added column. The tenant
+-- comes from the signed-in user, which already belongs to an existing one.
+ALTER TABLE rollouts ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+CREATE INDEX IF NOT EXISTS idx_rollouts_tenant_created ON rollouts(tenant_id, created_at);
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PoolConfig bounds the connection pool. Zero values keep the database/sql
+// default, which for MaxOpenConns and the lifetimes means unlimited.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// RetryPolicy controls how long Connect waits for Postgres to come up. The
+// delay doubles after every failed attempt, capped at MaxDelay.
+type RetryPolicy struct {
+	Attempts     int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// Delay is the wait after the given failed attempt (1-based)
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	d := p.InitialDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// Pool and ConnectRetry are applied by Open (see ConfigurePool). The retry
+// defaults give Postgres about a minute, enough for a docker-compose start.
+var (
+	Pool = PoolConfig{
+		MaxOpenConns:    25,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+	}
+	ConnectRetry = RetryPolicy{
+		Attempts:     10,
+		InitialDelay: 500 * time.Millisecond,
+		MaxDelay:     15 * time.Second,
+	}
+)
+
+// ConfigurePool must be called before Open. Attempts < 1 is treated as a
+// single attempt.
+func ConfigurePool(pool PoolConfig, retry RetryPolicy) {
+	Pool = pool
+	if retry.Attempts < 1 {
+		retry.Attempts = 1
+	}
+	ConnectRetry = retry
+}
+
+func applyPool(db *sql.DB) {
+	db.SetMaxOpenConns(Pool.MaxOpenConns)
+	db.SetMaxIdleConns(Pool.MaxIdleConns)
+	db.SetConnMaxLifetime(Pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(Pool.ConnMaxIdleTime)
+}
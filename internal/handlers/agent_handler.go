@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/middleware"
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+func (h *DeviceHandler) RecordHeartbeat(c *gin.Context) {
+	var req models.HeartbeatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Status == "" {
+		req.Status = models.DeviceStatusOnline
+	}
+	if !models.IsValidDeviceStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status: " + req.Status})
+		return
+	}
+
+	// A per-device key may only report for its own device
+	if !authorizeAgent(c, req.DeviceID) {
+		return
+	}
+	if identity, ok := middleware.AgentIdentity(c); ok {
+		req.DeviceID = identity.DeviceID
+	}
+
+	deviceID, err := h.devices.RecordHeartbeat(c.Request.Context(), req)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Heartbeat recorded", "device_id": deviceID})
+}
+
+// authorizeAgent answers 403 unless the agent's key may act for the device
+// ref. A per-device key acts for its own device; the fleet key only for
+// devices without a per-device key.
+func authorizeAgent(c *gin.Context, ref string) bool {
+	ok, err := middleware.AgentMayActAs(c, ref)
+	if err != nil {
+		respondInternalError(c, err)
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "api key does not belong to device " + ref})
+	}
+	return ok
+}
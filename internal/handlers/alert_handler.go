@@ -12,15 +12,11 @@ import (
 )
 
 type AlertHandler struct {
-	orchestrator        *services.AlertOrchestrator
-	defaultAssignUserID int
+	orchestrator *services.AlertOrchestrator
 }
 
-func NewAlertHandler(orchestrator *services.AlertOrchestrator, defaultUserID int) *AlertHandler {
-	return &AlertHandler{
-		orchestrator:        orchestrator,
-		defaultAssignUserID: defaultUserID,
-	}
+func NewAlertHandler(orchestrator *services.AlertOrchestrator) *AlertHandler {
+	return &AlertHandler{orchestrator: orchestrator}
 }
 
 type ZabbixWebhookRequest struct {
@@ -36,10 +32,37 @@ type ZabbixWebhookRequest struct {
 }
 
 func (h *AlertHandler) HandleZabbixWebhook(c *gin.Context) {
+	alert, assignUser, ok := bindZabbixAlert(c)
+	if !ok {
+		return
+	}
+
+	log.Printf("[WEBHOOK] %s [%s] %s → %s", alert.EventID, alert.Severity, alert.Device, alert.Status)
+	result := h.orchestrator.HandleAlert(alert, assignUser)
+	c.JSON(http.StatusOK, result)
+}
+
+// DryRunZabbixWebhook takes the same body as the Zabbix webhook and returns
+// what would be sent to Telegram and the Odoo ticket that would be created,
+// without sending, ticketing or recording anything
+func (h *AlertHandler) DryRunZabbixWebhook(c *gin.Context) {
+	alert, assignUser, ok := bindZabbixAlert(c)
+	if !ok {
+		return
+	}
+
+	log.Printf("[DRY-RUN] %s [%s] %s → %s", alert.EventID, alert.Severity, alert.Device, alert.Status)
+	c.JSON(http.StatusOK, gin.H{"dry_run": true, "data": h.orchestrator.DryRun(alert, assignUser)})
+}
+
+// bindZabbixAlert parses the webhook body into an alert, deriving the SLA
+// status when Zabbix leaves it out. It answers 400 and returns false on a
+// malformed body.
+func bindZabbixAlert(c *gin.Context) (services.AlertPayload, int, bool) {
 	var req ZabbixWebhookRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
-		return
+		return services.AlertPayload{}, 0, false
 	}
 
 	ts := time.Now()
@@ -64,16 +87,14 @@ func (h *AlertHandler) HandleZabbixWebhook(c *gin.Context) {
 		SLA:       req.SLA,
 	}
 
-	assignUser := h.defaultAssignUserID
+	// 0 leaves the choice to the orchestrator's default user
+	assignUser := 0
 	if raw := c.Query("assign_user"); raw != "" {
 		if uid, err := strconv.Atoi(raw); err == nil {
 			assignUser = uid
 		}
 	}
-
-	log.Printf("[WEBHOOK] %s [%s] %s → %s", req.EventID, req.Severity, req.Device, req.Status)
-	result := h.orchestrator.HandleAlert(alert, assignUser)
-	c.JSON(http.StatusOK, result)
+	return alert, assignUser, true
 }
 
 func deriveSLA(severity string) string {
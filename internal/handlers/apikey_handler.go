@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+	"portofolionetworkapi/internal/services"
+)
+
+// APIKeyHandler manages per-device agent keys under /admin/devices/:id/api-keys
+type APIKeyHandler struct {
+	keys    *services.APIKeyService
+	devices repository.DeviceRepository
+}
+
+func NewAPIKeyHandler(keys *services.APIKeyService, devices repository.DeviceRepository) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys, devices: devices}
+}
+
+func (h *APIKeyHandler) Register(admin *gin.RouterGroup) {
+	admin.GET("/devices/:id/api-keys", h.ListKeys)
+	admin.POST("/devices/:id/api-keys", h.IssueKey)
+	admin.DELETE("/devices/:id/api-keys/:keyId", h.RevokeKey)
+}
+
+// IssueKey issues a new key for the device, which also rotates out its
+// current keys after the grace period. The plaintext key is only returned
+// here.
+func (h *APIKeyHandler) IssueKey(c *gin.Context) {
+	var req models.IssueAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var grace *time.Duration
+	if req.GracePeriod != nil {
+		d, err := time.ParseDuration(*req.GracePeriod)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "grace_period must be a non-negative duration such as \"1h\""})
+			return
+		}
+		grace = &d
+	}
+
+	key, err := h.keys.Issue(c.Request.Context(), c.Param("id"), grace)
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data":    key,
+		"message": "Store this key now; it cannot be shown again",
+	})
+}
+
+// ListKeys returns the device's keys with their status, never the keys
+// themselves
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	id := c.Param("id")
+	if !models.IsValidUUID(id) {
+		respondAPIKeyError(c, services.ErrDeviceNotFound)
+		return
+	}
+	if _, err := h.devices.Get(c.Request.Context(), id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = services.ErrDeviceNotFound
+		}
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	keys, err := h.keys.List(c.Request.Context(), id)
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": keys, "total": len(keys)})
+}
+
+// RevokeKey stops the key from authenticating immediately
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	key, err := h.keys.Revoke(c.Request.Context(), c.Param("id"), c.Param("keyId"))
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": key})
+}
+
+func respondAPIKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrDeviceNotFound), errors.Is(err, services.ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		respondInternalError(c, err)
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/middleware"
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/services"
+)
+
+// AuthHandler serves dashboard login under /auth and user management
+// under /admin/users
+type AuthHandler struct {
+	auth *services.AuthService
+}
+
+func NewAuthHandler(auth *services.AuthService) *AuthHandler {
+	return &AuthHandler{auth: auth}
+}
+
+// Register adds the login routes; /me sits behind requireUser
+func (h *AuthHandler) Register(auth *gin.RouterGroup, requireUser gin.HandlerFunc) {
+	auth.POST("/login", h.Login)
+	auth.POST("/refresh", h.Refresh)
+	auth.POST("/logout", h.Logout)
+	auth.GET("/me", requireUser, h.Me)
+}
+
+func (h *AuthHandler) RegisterAdmin(admin *gin.RouterGroup) {
+	admin.GET("/users", h.ListUsers)
+	admin.POST("/users", h.CreateUser)
+	admin.POST("/users/:id/disable", h.DisableUser)
+	admin.PUT("/users/:id/roles", h.SetRoles)
+}
+
+func (h *AuthHandler) Login(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.auth.Login(c.Request.Context(), req.Username, req.Password)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Refresh exchanges a refresh token for a new pair; the old refresh token
+// stops working
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.auth.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout ends the session the refresh token belongs to. Unknown tokens
+// succeed too, so logging out twice is harmless.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.auth.Logout(c.Request.Context(), req.RefreshToken); err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// Me returns the user the access token was issued to
+func (h *AuthHandler) Me(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+func (h *AuthHandler) ListUsers(c *gin.Context) {
+	users, err := h.auth.ListUsers(c.Request.Context())
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": users, "total": len(users)})
+}
+
+func (h *AuthHandler) CreateUser(c *gin.Context) {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.auth.CreateUser(c.Request.Context(), req)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": user})
+}
+
+// DisableUser blocks logins and revokes the user's refresh tokens; access
+// tokens already issued expire on their own
+func (h *AuthHandler) DisableUser(c *gin.Context) {
+	user, err := h.auth.DisableUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// SetRoles replaces the user's roles. They apply to access tokens issued
+// from the next login or refresh.
+func (h *AuthHandler) SetRoles(c *gin.Context) {
+	var req models.SetRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.auth.SetRoles(c.Request.Context(), c.Param("id"), req.Roles)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// enabled answers 503 while JWT_SECRET is not set
+func (h *AuthHandler) enabled(c *gin.Context) bool {
+	if !h.auth.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "user authentication is disabled; set JWT_SECRET"})
+		return false
+	}
+	return true
+}
+
+func respondAuthError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrInvalidRefreshToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidUser):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondInternalError(c, err)
+	}
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/middleware"
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+	"portofolionetworkapi/internal/services"
+)
+
+type CommandHandler struct {
+	commands *services.CommandService
+}
+
+func NewCommandHandler(commands *services.CommandService) *CommandHandler {
+	return &CommandHandler{commands: commands}
+}
+
+// EnqueueCommand queues a command for the device in the URL
+func (h *CommandHandler) EnqueueCommand(c *gin.Context) {
+	var req models.EnqueueCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.authorizeDevice(c, c.Param("id")) {
+		return
+	}
+
+	cmd, err := h.commands.Enqueue(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		respondCommandError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": cmd})
+}
+
+func (h *CommandHandler) ListDeviceCommands(c *gin.Context) {
+	limit := queryInt(c, "limit", 50, 1, 500)
+	if !h.authorizeDevice(c, c.Param("id")) {
+		return
+	}
+
+	cmds, err := h.commands.ListForDevice(c.Request.Context(), c.Param("id"), limit)
+	if err != nil {
+		respondCommandError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": cmds, "total": len(cmds)})
+}
+
+// GetCommand returns a command of a device the user can see; commands of
+// other tenants or locations are not found
+func (h *CommandHandler) GetCommand(c *gin.Context) {
+	cmd, err := h.commands.Get(c.Request.Context(), c.Param("id"))
+	if err == nil {
+		var ok bool
+		if ok, err = h.deviceVisible(c, cmd.DeviceID); err == nil && !ok {
+			err = services.ErrCommandNotFound
+		}
+	}
+	if err != nil {
+		respondCommandError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": cmd})
+}
+
+// PollCommands hands pending commands to an agent and marks them dispatched
+func (h *CommandHandler) PollCommands(c *gin.Context) {
+	limit := queryInt(c, "limit", 10, 1, 100)
+
+	deviceRef := c.Param("deviceId")
+	if !authorizeAgent(c, deviceRef) {
+		return
+	}
+	if identity, ok := middleware.AgentIdentity(c); ok {
+		deviceRef = identity.DeviceID
+	}
+
+	cmds, err := h.commands.Claim(c.Request.Context(), deviceRef, limit)
+	if err != nil {
+		respondCommandError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "commands": cmds})
+}
+
+// ReportCommandResult records progress or the final outcome from an agent
+func (h *CommandHandler) ReportCommandResult(c *gin.Context) {
+	var req models.CommandResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// An agent only sees the commands of devices it may act for
+	cmd, err := h.commands.Get(c.Request.Context(), c.Param("commandId"))
+	if err == nil {
+		var ok bool
+		if ok, err = middleware.AgentMayActAs(c, cmd.DeviceID); err == nil && !ok {
+			err = services.ErrCommandNotFound
+		}
+	}
+	if err != nil {
+		respondCommandError(c, err)
+		return
+	}
+
+	cmd, err = h.commands.ReportResult(c.Request.Context(), c.Param("commandId"), req)
+	if err != nil {
+		respondCommandError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": cmd})
+}
+
+// BulkConfigure fans a command out to every device matching the filter
+func (h *CommandHandler) BulkConfigure(c *gin.Context) {
+	var req models.BulkConfigureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Roles scoped to locations can only target one of their locations
+	if _, all := middleware.LocationScope(c); !all && !authorizeLocation(c, req.DeviceFilter.Location) {
+		return
+	}
+	req.DeviceFilter.Tenant = middleware.TenantID(c)
+
+	exec, err := h.commands.BulkConfigure(c.Request.Context(), req)
+	if err != nil {
+		respondCommandError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"execution_id":  exec.ID,
+		"total_devices": exec.TotalDevices,
+		"status":        exec.Status,
+		"devices":       exec.Devices,
+	})
+}
+
+// GetExecution returns a bulk job of the request tenant. Users whose roles
+// are scoped to locations only see jobs filtered to one of them.
+func (h *CommandHandler) GetExecution(c *gin.Context) {
+	exec, err := h.commands.GetExecution(c.Request.Context(), c.Param("id"))
+	if err == nil && !executionVisible(c, exec) {
+		err = services.ErrExecutionNotFound
+	}
+	if err != nil {
+		respondCommandError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": exec})
+}
+
+// authorizeDevice checks that the device ref belongs to the request tenant
+// and that the user's roles cover its location. It answers the request and
+// returns false when they do not.
+func (h *CommandHandler) authorizeDevice(c *gin.Context, ref string) bool {
+	device, err := h.commands.Device(c.Request.Context(), ref)
+	if err == nil && device.TenantID != middleware.TenantID(c) {
+		err = services.ErrDeviceNotFound
+	}
+	if err != nil {
+		respondCommandError(c, err)
+		return false
+	}
+	return authorizeLocation(c, device.Location)
+}
+
+// deviceVisible reports whether the device belongs to the request tenant
+// and the user's roles cover its location
+func (h *CommandHandler) deviceVisible(c *gin.Context, ref string) (bool, error) {
+	device, err := h.commands.Device(c.Request.Context(), ref)
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return device.TenantID == middleware.TenantID(c) && middleware.AllowsLocation(c, device.Location), nil
+}
+
+// executionVisible applies the tenant and location checks of BulkConfigure
+// to the filter the job was created with
+func executionVisible(c *gin.Context, exec *models.Execution) bool {
+	var filter models.DeviceFilter
+	if err := json.Unmarshal(exec.DeviceFilter, &filter); err != nil {
+		return false
+	}
+	// Jobs created before filters carried a tenant were single-tenant
+	if filter.Tenant == "" {
+		filter.Tenant = models.DefaultTenantID
+	}
+	return filter.Tenant == middleware.TenantID(c) && middleware.AllowsLocation(c, filter.Location)
+}
+
+func respondCommandError(c *gin.Context, err error) {
+	var fanOut *services.FanOutLimitError
+	var quotaErr *repository.QuotaExceededError
+	switch {
+	case errors.As(err, &quotaErr):
+		respondQuotaExceeded(c, quotaErr)
+	case errors.As(err, &fanOut):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":           err.Error(),
+			"matched_devices": fanOut.Matched,
+			"max_devices":     fanOut.Max,
+		})
+	case errors.Is(err, services.ErrDeviceNotFound), errors.Is(err, services.ErrCommandNotFound),
+		errors.Is(err, services.ErrExecutionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidCommand), errors.Is(err, services.ErrInvalidDeviceFilter):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidCommandTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondInternalError(c, err)
+	}
+}
+
+// queryInt reads an integer query parameter, clamped to [min, max]
+func queryInt(c *gin.Context, key string, def, min, max int) int {
+	raw := c.Query(key)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return def
+	}
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/config"
+)
+
+type ConfigHandler struct {
+	store *config.Store
+}
+
+func NewConfigHandler(store *config.Store) *ConfigHandler {
+	return &ConfigHandler{store: store}
+}
+
+// GetConfig shows operators the settings this instance is running with.
+// Secrets are masked (see config.Config.Redacted).
+func (h *ConfigHandler) GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.store.Current().Redacted()})
+}
+
+// ReloadConfig re-reads .env and the YAML file, like SIGHUP. Only the
+// Telegram and Odoo sections apply without a restart; the response lists
+// any other section that changed.
+func (h *ConfigHandler) ReloadConfig(c *gin.Context) {
+	result, err := h.store.Reload()
+	var cfgErr *config.Error
+	if errors.As(err, &cfgErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "invalid configuration; the running configuration is unchanged",
+			"details": cfgErr.Problems,
+		})
+		return
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if len(result.RestartRequired) > 0 {
+		log.Printf("[WARN] Changed settings need a restart to apply: %v", result.RestartRequired)
+	}
+	log.Printf("[OK] Config reloaded via API (applied: %v)", result.Applied)
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "configuration reloaded",
+		"applied":          emptyIfNil(result.Applied),
+		"restart_required": emptyIfNil(result.RestartRequired),
+		"data":             result.Config.Redacted(),
+	})
+}
+
+func emptyIfNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
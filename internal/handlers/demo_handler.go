@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/database"
+	"portofolionetworkapi/internal/models"
+)
+
+// GetDemoStatus exposes the demo device quota so the dashboard can show the
+// same limit and reset countdown the server enforces
+func GetDemoStatus(c *gin.Context) {
+	reached, count, err := database.IsDeviceLimitReached()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if !database.DeviceLimitEnabled() {
+		c.JSON(http.StatusOK, gin.H{
+			"enabled":      false,
+			"demo_mode":    database.DemoModeEnabled(),
+			"device_count": count,
+		})
+		return
+	}
+
+	remaining := database.GetTimeUntilReset()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                true,
+		"demo_mode":              true,
+		"device_count":           count,
+		"max_devices":            database.MaxDevices,
+		"remaining_slots":        max(database.MaxDevices-count, 0),
+		"limit_reached":          reached,
+		"reset_interval_seconds": int(database.ResetInterval.Seconds()),
+		"reset_in_seconds":       seconds(remaining),
+		"next_reset_at":          database.NextResetAt().UTC(),
+	})
+}
+
+// DemoUnavailable answers the demo routes on SQLite: demo mode resets the
+// Postgres inventory and has no SQLite implementation
+func DemoUnavailable(c *gin.Context) {
+	c.JSON(http.StatusNotImplemented, gin.H{"error": "demo mode requires DB_DRIVER=postgres"})
+}
+
+// respondDeviceLimitReached answers 429 with the time until the database is
+// reset, which is when creates will succeed again
+func respondDeviceLimitReached(c *gin.Context, count int) {
+	remaining := database.GetTimeUntilReset()
+	c.Header("Retry-After", strconv.Itoa(seconds(remaining)))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": "device limit reached",
+		"code":  "DEVICE_LIMIT_REACHED",
+		"details": gin.H{
+			"device_count":     count,
+			"max_devices":      database.MaxDevices,
+			"reset_in_seconds": seconds(remaining),
+			"next_reset_at":    database.NextResetAt().UTC(),
+		},
+	})
+}
+
+// seconds rounds up so a client never retries just before the reset
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ResetDemo snapshots the inventory and restores the sample devices.
+// Only available in demo mode.
+func ResetDemo(c *gin.Context) {
+	var req models.DemoResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reset, err := database.ResetDatabase(models.DemoTriggerManual, demoActor(c), req.Reason)
+	if err != nil {
+		respondDemoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "demo inventory reset", "data": reset})
+}
+
+// ListDemoResets returns the reset audit log, newest first
+func ListDemoResets(c *gin.Context) {
+	resets, err := database.ListDemoResets(queryInt(c, "limit", 50, 1, 500))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": resets, "total": len(resets)})
+}
+
+// UndoDemoReset restores the inventory snapshotted by a reset (or restore)
+func UndoDemoReset(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reset id"})
+		return
+	}
+
+	var req models.DemoResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	restore, err := database.UndoDemoReset(id, demoActor(c), req.Reason)
+	if err != nil {
+		respondDemoError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "demo reset undone", "data": restore})
+}
+
+// demoActor identifies who triggered a reset in the audit log
+func demoActor(c *gin.Context) string {
+	return "admin@" + c.ClientIP()
+}
+
+func respondDemoError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrDemoModeDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrDemoResetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrDemoResetUndone):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondInternalError(c, err)
+	}
+}
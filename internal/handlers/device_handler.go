@@ -1,68 +1,247 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"sort"
 
 	"github.com/gin-gonic/gin"
 
-	"portofolionetworkapi/internal/database"
+	"portofolionetworkapi/internal/middleware"
 	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
 )
 
-func ListDevices(c *gin.Context) {
-	rows, err := database.DB.Query(`
-		SELECT id, name, ip_address, location, status, created_at, updated_at
-		FROM devices ORDER BY id DESC
-	`)
+// DeviceHandler serves the device inventory from the injected repositories
+type DeviceHandler struct {
+	devices  repository.DeviceRepository
+	alerts   repository.AlertRepository
+	commands repository.CommandRepository
+}
+
+func NewDeviceHandler(repos repository.Repositories) *DeviceHandler {
+	return &DeviceHandler{
+		devices:  repos.Devices,
+		alerts:   repos.Alerts,
+		commands: repos.Commands,
+	}
+}
+
+// Register mounts the device CRUD routes on the /devices group
+func (h *DeviceHandler) Register(devices *gin.RouterGroup) {
+	devices.GET("", h.ListDevices)
+	devices.POST("", h.CreateDevice)
+	devices.GET("/:id", h.GetDevice)
+	devices.PUT("/:id", h.UpdateDevice)
+	devices.PATCH("/:id", h.PatchDevice)
+	devices.DELETE("/:id", h.DeleteDevice)
+}
+
+// ListDevices returns one page of devices using keyset pagination.
+// Query: limit, cursor, sort (name|last_seen|created_at), order (asc|desc),
+// status, location, name (substring) and ip_prefix. Only devices of the
+// request tenant are listed.
+func (h *DeviceHandler) ListDevices(c *gin.Context) {
+	q, err := parseDeviceListQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	var devices []models.Device
-	for rows.Next() {
-		var d models.Device
-		if err := rows.Scan(&d.ID, &d.Name, &d.IPAddress,
-			&d.Location, &d.Status, &d.CreatedAt, &d.UpdatedAt); err != nil {
-			continue
+	// Users whose roles are scoped to locations only see those locations
+	opts := q.options()
+	opts.Tenant = middleware.TenantID(c)
+	if locations, all := middleware.LocationScope(c); !all {
+		opts.Locations = append([]string{}, locations...)
+	}
+
+	devices, total, err := h.devices.List(c.Request.Context(), opts)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// One extra row was fetched to detect whether another page exists
+	nextCursor := ""
+	hasMore := len(devices) > q.Limit
+	if hasMore {
+		devices = devices[:q.Limit]
+		nextCursor = q.cursorFor(devices[len(devices)-1])
+	}
+
+	jsonWithBodyETag(c, http.StatusOK, gin.H{
+		"data":  devices,
+		"total": total,
+		"meta": gin.H{
+			"limit":       q.Limit,
+			"sort":        q.Sort,
+			"order":       q.Order,
+			"has_more":    hasMore,
+			"next_cursor": nextCursor,
+		},
+	})
+}
+
+// GetDevice returns a device with its recent heartbeats, open alerts and
+// their Odoo tickets, and recent commands.
+// Query: heartbeats (default 20), commands (default 10).
+func (h *DeviceHandler) GetDevice(c *gin.Context) {
+	id := c.Param("id")
+	if !models.IsValidUUID(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	device, err := h.devices.Get(ctx, id)
+	if err == nil && device.TenantID != middleware.TenantID(c) {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		respondDeviceError(c, err)
+		return
+	}
+	if !authorizeLocation(c, device.Location) {
+		return
+	}
+
+	// The ETag tracks the device record; answer polls before loading the rest
+	etag := deviceETag(device)
+	c.Header("ETag", etag)
+	if ifNoneMatch(c, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	heartbeats, err := h.devices.RecentHeartbeats(ctx, id, queryInt(c, "heartbeats", 20, 0, 500))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	alerts, err := h.alerts.OpenForDevice(ctx, id)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	ticketIDs := []int{}
+	for _, a := range alerts {
+		if a.TicketID != 0 {
+			ticketIDs = append(ticketIDs, a.TicketID)
 		}
-		devices = append(devices, d)
 	}
 
-	if devices == nil {
-		devices = []models.Device{}
+	commands, err := h.commands.RecentForDevice(ctx, id, queryInt(c, "commands", 10, 0, 100))
+	if err != nil {
+		respondInternalError(c, err)
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": devices, "total": len(devices)})
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"device":          device,
+			"heartbeats":      heartbeats,
+			"open_alerts":     alerts,
+			"open_ticket_ids": ticketIDs,
+			"recent_commands": commands,
+		},
+	})
 }
 
-func CreateDevice(c *gin.Context) {
+// authorizeDevice checks that the device belongs to the request tenant and
+// that the user's roles cover its location. It answers the request and
+// returns false when they do not; devices of other tenants are not found.
+func (h *DeviceHandler) authorizeDevice(c *gin.Context, id string) bool {
+	device, err := h.devices.Get(c.Request.Context(), id)
+	if err == nil && device.TenantID != middleware.TenantID(c) {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		respondDeviceError(c, err)
+		return false
+	}
+	return authorizeLocation(c, device.Location)
+}
+
+// authorizeLocation answers 403 and returns false when the user's roles do
+// not cover location
+func authorizeLocation(c *gin.Context, location string) bool {
+	if !middleware.AllowsLocation(c, location) {
+		middleware.ForbidLocation(c, location)
+		return false
+	}
+	return true
+}
+
+// respondInternalError logs the underlying error and hides it from clients
+func respondInternalError(c *gin.Context, err error) {
+	log.Printf("[ERROR] %s %s: %v", c.Request.Method, c.FullPath(), err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+}
+
+// respondValidationErrors answers 400 listing every invalid field
+func respondValidationErrors(c *gin.Context, errs []models.FieldError) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": errs})
+}
+
+// respondDeviceError maps repository errors to responses: a duplicate name
+// is 409, and a stale If-Match revision on an existing device is 412
+func respondDeviceError(c *gin.Context, err error) {
+	var (
+		limitErr *repository.DeviceLimitError
+		quotaErr *repository.QuotaExceededError
+	)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+	case errors.Is(err, repository.ErrRevisionMismatch):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "device was modified by another request; reload and retry"})
+	case errors.Is(err, repository.ErrDuplicateName):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "device name already exists",
+			"details": []models.FieldError{{Field: "name", Message: "is already used by another device"}},
+		})
+	case errors.As(err, &limitErr):
+		respondDeviceLimitReached(c, limitErr.Count)
+	case errors.As(err, &quotaErr):
+		respondQuotaExceeded(c, quotaErr)
+	case errors.Is(err, repository.ErrTenantNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown tenant: " + middleware.TenantID(c)})
+	default:
+		respondInternalError(c, err)
+	}
+}
+
+func (h *DeviceHandler) CreateDevice(c *gin.Context) {
 	var req models.CreateDeviceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if errs := req.Validate(); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+	if !authorizeLocation(c, req.Location) {
+		return
+	}
 
-	var id string
-	err := database.DB.QueryRow(`
-		INSERT INTO devices (name, ip_address, location, status)
-		VALUES ($1, $2, $3, 'unknown')
-		RETURNING id
-	`, req.Name, req.IPAddress, req.Location).Scan(&id)
-
+	device, err := h.devices.Create(c.Request.Context(), middleware.TenantID(c), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDeviceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "device created"})
+	c.Header("ETag", deviceETag(device))
+	c.JSON(http.StatusCreated, gin.H{"id": device.ID, "message": "device created"})
 }
 
-func UpdateDevice(c *gin.Context) {
+func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
 	id := c.Param("id")
-	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+	if !models.IsValidUUID(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
 		return
 	}
 
@@ -71,30 +250,146 @@ func UpdateDevice(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if errs := req.Validate(); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+	// Moving a device needs the permission at both locations
+	if !h.authorizeDevice(c, id) || !authorizeLocation(c, req.Location) {
+		return
+	}
 
-	_, err := database.DB.Exec(`
-		UPDATE devices SET name=$1, ip_address=$2, location=$3, status=$4, updated_at=NOW()
-		WHERE id=$5
-	`, req.Name, req.IPAddress, req.Location, req.Status, id)
-
+	device, err := h.devices.Update(c.Request.Context(), id, req, parseIfMatch(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDeviceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "device updated"})
+	c.Header("ETag", deviceETag(device))
+	c.JSON(http.StatusOK, gin.H{"message": "device updated", "data": device})
+}
+
+// nullableDeviceFields lists the JSON members PatchDevice accepts; only
+// location may be cleared with null
+var nullableDeviceFields = map[string]bool{
+	"name":       false,
+	"ip_address": false,
+	"location":   true,
+	"status":     false,
 }
 
-func DeleteDevice(c *gin.Context) {
+// PatchDevice applies a JSON Merge Patch (RFC 7396): only the members
+// present in the body are changed, and null clears a nullable field.
+func (h *DeviceHandler) PatchDevice(c *gin.Context) {
 	id := c.Param("id")
-	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+	if !models.IsValidUUID(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+		return
+	}
+
+	switch c.ContentType() {
+	case "application/merge-patch+json", "application/json":
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "use Content-Type: application/merge-patch+json"})
+		return
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil || body == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body must be a JSON object"})
+		return
+	}
+
+	// Validate members in a stable order so details are deterministic
+	keys := make([]string, 0, len(body))
+	for key := range body {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	patch := repository.DevicePatch{}
+	var errs []models.FieldError
+	for _, key := range keys {
+		nullable, ok := nullableDeviceFields[key]
+		if !ok {
+			errs = append(errs, models.FieldError{Field: key, Message: "cannot be patched"})
+			continue
+		}
+
+		var value *string
+		if err := json.Unmarshal(body[key], &value); err != nil {
+			errs = append(errs, models.FieldError{Field: key, Message: "must be a string or null"})
+			continue
+		}
+		if value == nil {
+			if !nullable {
+				errs = append(errs, models.FieldError{Field: key, Message: "cannot be null"})
+				continue
+			}
+			patch[key] = nil
+			continue
+		}
+
+		v, msg := *value, ""
+		switch key {
+		case "name":
+			msg = models.ValidateDeviceName(v)
+		case "ip_address":
+			v, msg = models.NormalizeDeviceIP(v)
+		case "location":
+			msg = models.ValidateDeviceLocation(v)
+		case "status":
+			if !models.IsValidDeviceStatus(v) {
+				msg = "must be one of online, offline, degraded, unknown"
+			}
+		}
+		if msg != "" {
+			errs = append(errs, models.FieldError{Field: key, Message: msg})
+			continue
+		}
+		patch[key] = &v
+	}
+	if len(errs) > 0 {
+		respondValidationErrors(c, errs)
 		return
 	}
 
-	_, err := database.DB.Exec("DELETE FROM devices WHERE id=$1", id)
+	if !h.authorizeDevice(c, id) {
+		return
+	}
+	if location, ok := patch["location"]; ok {
+		newLocation := ""
+		if location != nil {
+			newLocation = *location
+		}
+		if !authorizeLocation(c, newLocation) {
+			return
+		}
+	}
+
+	// An empty patch is a no-op that still returns the resource
+	device, err := h.devices.Patch(c.Request.Context(), id, patch, parseIfMatch(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDeviceError(c, err)
+		return
+	}
+
+	c.Header("ETag", deviceETag(device))
+	c.JSON(http.StatusOK, gin.H{"data": device})
+}
+
+func (h *DeviceHandler) DeleteDevice(c *gin.Context) {
+	id := c.Param("id")
+	if !models.IsValidUUID(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+		return
+	}
+
+	if !h.authorizeDevice(c, id) {
+		return
+	}
+	if err := h.devices.Delete(c.Request.Context(), id, parseIfMatch(c)); err != nil {
+		respondDeviceError(c, err)
 		return
 	}
 
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+// deviceListQuery holds the parsed query string for GET /api/v1/devices
+type deviceListQuery struct {
+	Limit    int
+	Sort     string
+	Order    string
+	Status   string
+	Location string
+	Name     string
+	IPPrefix string
+	Cursor   *repository.DeviceCursor
+}
+
+// deviceCursor marks the last row of a page. It is tied to the sort it was
+// issued for so it cannot be replayed against a different ordering.
+type deviceCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func parseDeviceListQuery(c *gin.Context) (*deviceListQuery, error) {
+	q := &deviceListQuery{
+		Limit:    queryInt(c, "limit", 50, 1, 500),
+		Sort:     c.DefaultQuery("sort", "created_at"),
+		Order:    strings.ToLower(c.Query("order")),
+		Status:   c.Query("status"),
+		Location: c.Query("location"),
+		Name:     c.Query("name"),
+		IPPrefix: c.Query("ip_prefix"),
+	}
+
+	if !repository.IsValidDeviceSort(q.Sort) {
+		return nil, fmt.Errorf("sort must be one of name, last_seen, created_at")
+	}
+	if q.Order == "" {
+		q.Order = "desc"
+		if q.Sort == "name" {
+			q.Order = "asc"
+		}
+	}
+	if q.Order != "asc" && q.Order != "desc" {
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+	if q.Status != "" && !models.IsValidDeviceStatus(q.Status) {
+		return nil, fmt.Errorf("invalid status: %s", q.Status)
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cur, err := decodeDeviceCursor(raw)
+		if err != nil {
+			return nil, err
+		}
+		if cur.Sort != q.Sort || cur.Order != q.Order {
+			return nil, fmt.Errorf("cursor was issued for sort=%s order=%s", cur.Sort, cur.Order)
+		}
+		if q.Cursor, err = cur.position(); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// options converts the query into a repository request. One extra row is
+// asked for to detect whether another page exists.
+func (q *deviceListQuery) options() repository.DeviceListOptions {
+	return repository.DeviceListOptions{
+		DeviceFilter: repository.DeviceFilter{
+			Status:   q.Status,
+			Location: q.Location,
+			Name:     q.Name,
+			IPPrefix: q.IPPrefix,
+		},
+		Sort:  q.Sort,
+		Order: q.Order,
+		Limit: q.Limit + 1,
+		After: q.Cursor,
+	}
+}
+
+// cursorFor encodes the position of the given device in the current sort
+func (q *deviceListQuery) cursorFor(d models.Device) string {
+	cur := deviceCursor{Sort: q.Sort, Order: q.Order, ID: d.ID}
+	switch q.Sort {
+	case "name":
+		cur.Value = d.Name
+	case "last_seen":
+		cur.Value = sortTime(d.LastSeen)
+	case "created_at":
+		cur.Value = sortTime(d.CreatedAt)
+	}
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// sortTime mirrors how repositories sort a missing timestamp, as the epoch
+func sortTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0).UTC()
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// position validates the cursor and returns the row it points at
+func (cur *deviceCursor) position() (*repository.DeviceCursor, error) {
+	if !models.IsValidUUID(cur.ID) {
+		return nil, errors.New("invalid cursor")
+	}
+	pos := &repository.DeviceCursor{ID: cur.ID}
+	if cur.Sort == repository.SortByName {
+		pos.Name = cur.Value
+		return pos, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, cur.Value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	pos.Time = t
+	return pos, nil
+}
+
+func decodeDeviceCursor(raw string) (*deviceCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cur deviceCursor
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cur, nil
+}
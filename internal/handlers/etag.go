@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+// deviceETag is a strong validator derived from the device revision
+func deviceETag(d models.Device) string {
+	return fmt.Sprintf(`"%d"`, d.Revision)
+}
+
+// parseIfMatch turns the If-Match header into a precondition on the device
+// revision. "*" only requires the device to exist. Tags that are not device
+// revisions are dropped, so they can never match.
+func parseIfMatch(c *gin.Context) repository.Precondition {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return repository.Precondition{}
+	}
+
+	pre := repository.Precondition{Enforced: true, Revisions: []int64{}}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		// If-Match uses strong comparison, so weak tags never match
+		if strings.HasPrefix(tag, "W/") || len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if rev, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64); err == nil {
+			pre.Revisions = append(pre.Revisions, rev)
+		}
+	}
+	return pre
+}
+
+// ifNoneMatch reports whether the request's If-None-Match matches etag
+// using weak comparison
+func ifNoneMatch(c *gin.Context, etag string) bool {
+	header := strings.TrimSpace(c.GetHeader("If-None-Match"))
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonWithBodyETag writes body as JSON with a weak ETag of its content and
+// answers 304 when the client already has it. Used for collections, which
+// have no single revision.
+func jsonWithBodyETag(c *gin.Context, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `W/"` + hex.EncodeToString(sum[:8]) + `"`
+	c.Header("ETag", etag)
+	if ifNoneMatch(c, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(status, "application/json; charset=utf-8", data)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/database"
+	"portofolionetworkapi/internal/services"
+)
+
+const serviceName = "netops-integration-api"
+
+// Dependency is an external service reported by the readiness check. An
+// unreachable dependency shows as "down" but does not make the API unready:
+// alerts still reach the other channel and device traffic is unaffected.
+// Ping returns services.ErrNotConfigured when the dependency is turned off.
+type Dependency struct {
+	Name string
+	Ping func(ctx context.Context) error
+}
+
+// dependencyStatus caches one dependency's last ping so frequent probes
+// don't hammer Odoo and Telegram
+type dependencyStatus struct {
+	Dependency
+	mu        sync.Mutex
+	checkedAt time.Time
+	result    gin.H
+}
+
+type HealthHandler struct {
+	db           *sql.DB
+	migrator     *database.Migrator
+	timeout      time.Duration
+	cacheFor     time.Duration
+	dependencies []*dependencyStatus
+}
+
+// NewHealthHandler checks db and its migrations on every readiness probe,
+// with each check bounded by timeout; dependency results are reused for
+// cacheFor
+func NewHealthHandler(db *sql.DB, driver string, timeout, cacheFor time.Duration, deps ...Dependency) (*HealthHandler, error) {
+	migrator, err := database.NewMigrator(db, driver)
+	if err != nil {
+		return nil, err
+	}
+	h := &HealthHandler{db: db, migrator: migrator, timeout: timeout, cacheFor: cacheFor}
+	for _, d := range deps {
+		h.dependencies = append(h.dependencies, &dependencyStatus{Dependency: d})
+	}
+	return h, nil
+}
+
+// Live only says the process is serving HTTP; orchestrators restart the
+// container when it fails
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "alive",
+		"service":   serviceName,
+		"timestamp": time.Now().UTC(),
+	})
+}
+
+// Ready reports whether the API can serve traffic: the database answers and
+// every migration is applied. Returns 503 otherwise so load balancers route
+// around the instance.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	ctx := c.Request.Context()
+	ready := true
+	checks := gin.H{}
+
+	dbCtx, cancel := context.WithTimeout(ctx, h.timeout)
+	start := time.Now()
+	err := h.db.PingContext(dbCtx)
+	cancel()
+	if err != nil {
+		ready = false
+		log.Printf("[ERROR] Readiness check database failed: %v", err)
+		checks["database"] = gin.H{"status": "down"}
+	} else {
+		checks["database"] = gin.H{"status": "up", "latency_ms": latencyMS(time.Since(start))}
+	}
+
+	migCtx, cancel := context.WithTimeout(ctx, h.timeout)
+	applied, latest, err := h.migrator.Version(migCtx)
+	cancel()
+	switch {
+	case err != nil:
+		ready = false
+		log.Printf("[ERROR] Readiness check migrations failed: %v", err)
+		checks["migrations"] = gin.H{"status": "down"}
+	case applied < latest:
+		ready = false
+		checks["migrations"] = gin.H{"status": "pending", "version": applied, "latest": latest}
+	default:
+		checks["migrations"] = gin.H{"status": "up", "version": applied, "latest": latest}
+	}
+
+	var wg sync.WaitGroup
+	results := make([]gin.H, len(h.dependencies))
+	for i, d := range h.dependencies {
+		wg.Add(1)
+		go func(i int, d *dependencyStatus) {
+			defer wg.Done()
+			results[i] = h.checkDependency(ctx, d)
+		}(i, d)
+	}
+	wg.Wait()
+	for i, d := range h.dependencies {
+		checks[d.Name] = results[i]
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status":    status,
+		"service":   serviceName,
+		"timestamp": time.Now().UTC(),
+		"checks":    checks,
+	})
+}
+
+func (h *HealthHandler) checkDependency(ctx context.Context, d *dependencyStatus) gin.H {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.result != nil && time.Since(d.checkedAt) < h.cacheFor {
+		return d.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	start := time.Now()
+	err := d.Ping(ctx)
+	switch {
+	case errors.Is(err, services.ErrNotConfigured):
+		d.result = gin.H{"status": "disabled"}
+	case err != nil:
+		log.Printf("[ERROR] Readiness check %s failed: %v", d.Name, err)
+		d.result = gin.H{"status": "down"}
+	default:
+		d.result = gin.H{"status": "up", "latency_ms": latencyMS(time.Since(start))}
+	}
+	d.checkedAt = time.Now()
+	return d.result
+}
+
+func latencyMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/middleware"
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+	"portofolionetworkapi/internal/services"
+)
+
+type RolloutHandler struct {
+	rollouts *services.RolloutService
+}
+
+func NewRolloutHandler(rollouts *services.RolloutService) *RolloutHandler {
+	return &RolloutHandler{rollouts: rollouts}
+}
+
+func (h *RolloutHandler) CreateRollout(c *gin.Context) {
+	var req models.CreateRolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.DeviceFilter.Tenant = middleware.TenantID(c)
+
+	rollout, err := h.rollouts.Create(c.Request.Context(), req)
+	if err != nil {
+		respondRolloutError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": rollout})
+}
+
+func (h *RolloutHandler) ListRollouts(c *gin.Context) {
+	rollouts, err := h.rollouts.List(c.Request.Context(), middleware.TenantID(c), queryInt(c, "limit", 50, 1, 500))
+	if err != nil {
+		respondRolloutError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rollouts, "total": len(rollouts)})
+}
+
+func (h *RolloutHandler) GetRollout(c *gin.Context) {
+	rollout, err := h.rollouts.Get(c.Request.Context(), middleware.TenantID(c), c.Param("id"))
+	if err != nil {
+		respondRolloutError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": rollout})
+}
+
+func (h *RolloutHandler) PauseRollout(c *gin.Context) {
+	h.act(c, h.rollouts.Pause)
+}
+
+func (h *RolloutHandler) ResumeRollout(c *gin.Context) {
+	h.act(c, h.rollouts.Resume)
+}
+
+func (h *RolloutHandler) AbortRollout(c *gin.Context) {
+	h.act(c, h.rollouts.Abort)
+}
+
+func (h *RolloutHandler) act(c *gin.Context, action func(ctx context.Context, tenant, id string) (*models.Rollout, error)) {
+	rollout, err := action(c.Request.Context(), middleware.TenantID(c), c.Param("id"))
+	if err != nil {
+		respondRolloutError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": rollout})
+}
+
+func respondRolloutError(c *gin.Context, err error) {
+	var conflict *repository.RolloutConflictError
+	switch {
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "devices": conflict.Devices})
+	case errors.Is(err, services.ErrRolloutNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidRollout), errors.Is(err, services.ErrInvalidDeviceFilter),
+		errors.Is(err, services.ErrInvalidCommand):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidRolloutAction):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondInternalError(c, err)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+	"portofolionetworkapi/internal/services"
+)
+
+type TenantHandler struct {
+	tenants *services.TenantService
+}
+
+func NewTenantHandler(tenants *services.TenantService) *TenantHandler {
+	return &TenantHandler{tenants: tenants}
+}
+
+// ListTenants returns every tenant with its quotas and current usage
+func (h *TenantHandler) ListTenants(c *gin.Context) {
+	tenants, err := h.tenants.List()
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tenants, "total": len(tenants)})
+}
+
+func (h *TenantHandler) GetTenant(c *gin.Context) {
+	tenant, err := h.tenants.Get(c.Param("id"))
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tenant})
+}
+
+func (h *TenantHandler) CreateTenant(c *gin.Context) {
+	var req models.CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant, err := h.tenants.Create(req)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": tenant})
+}
+
+// UpdateTenant replaces the tenant's quotas; null removes a limit
+func (h *TenantHandler) UpdateTenant(c *gin.Context) {
+	var req models.UpdateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant, err := h.tenants.Update(c.Param("id"), req)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tenant})
+}
+
+func respondTenantError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTenantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTenantExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidTenant):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondInternalError(c, err)
+	}
+}
+
+// respondQuotaExceeded answers 403 for the device quota, which only frees
+// up when devices are deleted, and 429 for the hourly quotas
+func respondQuotaExceeded(c *gin.Context, quotaErr *repository.QuotaExceededError) {
+	status := http.StatusForbidden
+	if quotaErr.Hourly() {
+		status = http.StatusTooManyRequests
+	}
+	c.JSON(status, gin.H{
+		"error": quotaErr.Error(),
+		"code":  "TENANT_QUOTA_EXCEEDED",
+		"details": gin.H{
+			"tenant_id": quotaErr.TenantID,
+			"quota":     quotaErr.Quota,
+			"limit":     quotaErr.Limit,
+			"used":      quotaErr.Used,
+			"requested": quotaErr.Requested,
+		},
+	})
+}
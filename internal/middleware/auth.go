@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/services"
+)
+
+// AgentContextKey menyimpan identitas device agent di gin.Context
+const AgentContextKey = "agent_identity"
+
+// agentFleetKey menandai request yang memakai fleet key; nilainya
+// AgentAuthenticator untuk memeriksa key per-device (lihat AgentMayActAs)
+const agentFleetKey = "agent_fleet_key"
+
+// AgentAuthenticator memverifikasi API key per-device
+type AgentAuthenticator interface {
+	AuthenticateAgent(ctx context.Context, token string) (models.AgentIdentity, error)
+	// DeviceHasKey melaporkan apakah device sudah punya key per-device
+	DeviceHasKey(ctx context.Context, deviceRef string) (bool, error)
+}
+
+// AgentAuth memvalidasi header "Authorization: Bearer <api_key>" dari agent.
+// API key per-device mengikat request ke device pemiliknya (lihat
+// AgentMayActAs). fleetKey adalah key bersama lama yang tidak terikat ke
+// device; kosong berarti tidak dipakai. Fleet key hanya boleh bertindak
+// untuk device yang belum punya key per-device, dan config menolaknya di
+// production. Jika disabled, autentikasi dimatikan (hanya untuk
+// development).
+func AgentAuth(keys AgentAuthenticator, fleetKey string, disabled bool) gin.HandlerFunc {
+	if disabled {
+		log.Println("[WARN] AGENT_AUTH_DISABLED=true — agent endpoints are unauthenticated")
+	} else if fleetKey != "" {
+		log.Println("[WARN] AGENT_API_KEY is a shared fleet key not bound to any device; prefer per-device keys")
+	}
+
+	return func(c *gin.Context) {
+		if disabled {
+			c.Next()
+			return
+		}
+
+		token, ok := bearerToken(c)
+		if ok && services.IsDeviceKey(token) {
+			identity, err := keys.AuthenticateAgent(c.Request.Context(), token)
+			if errors.Is(err, services.ErrInvalidAPIKey) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "invalid, expired or revoked api key",
+				})
+				return
+			}
+			if err != nil {
+				log.Printf("[ERROR] Agent authentication failed: %v", err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+				return
+			}
+			c.Set(AgentContextKey, identity)
+			c.Next()
+			return
+		}
+
+		if !ok || fleetKey == "" || subtle.ConstantTimeCompare([]byte(token), []byte(fleetKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "invalid or missing api key",
+			})
+			return
+		}
+		c.Set(agentFleetKey, keys)
+		c.Next()
+	}
+}
+
+// AgentIdentity mengembalikan device yang terautentikasi lewat API key
+// per-device; ok=false untuk fleet key atau jika autentikasi dimatikan
+func AgentIdentity(c *gin.Context) (models.AgentIdentity, bool) {
+	v, ok := c.Get(AgentContextKey)
+	if !ok {
+		return models.AgentIdentity{}, false
+	}
+	identity, ok := v.(models.AgentIdentity)
+	return identity, ok
+}
+
+// AgentMayActAs melaporkan apakah agent boleh bertindak atas nama device
+// ref (UUID atau nama, tidak case-sensitive). Key per-device hanya untuk
+// device-nya sendiri; fleet key hanya untuk device tanpa key per-device.
+// Jika autentikasi dimatikan selalu boleh.
+func AgentMayActAs(c *gin.Context, ref string) (bool, error) {
+	if identity, ok := AgentIdentity(c); ok {
+		return strings.EqualFold(ref, identity.DeviceID) || strings.EqualFold(ref, identity.DeviceName), nil
+	}
+	if v, ok := c.Get(agentFleetKey); ok {
+		hasKey, err := v.(AgentAuthenticator).DeviceHasKey(c.Request.Context(), ref)
+		return !hasKey, err
+	}
+	return true, nil
+}
+
+// UserContextKey menyimpan user dashboard di gin.Context
+const UserContextKey = "auth_user"
+
+// AccessTokenVerifier memverifikasi access token JWT dari dashboard
+type AccessTokenVerifier interface {
+	Enabled() bool
+	VerifyAccessToken(token string) (models.AuthUser, error)
+}
+
+// UserAuth memvalidasi header "Authorization: Bearer <access_token>" dari
+// dashboard dan menyimpan user di context. Seperti AdminAuth, jika
+// JWT_SECRET kosong endpoint user dimatikan.
+func UserAuth(tokens AccessTokenVerifier) gin.HandlerFunc {
+	if !tokens.Enabled() {
+		log.Println("[WARN] JWT_SECRET not set — user endpoints are disabled")
+	}
+
+	return func(c *gin.Context) {
+		if !tokens.Enabled() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": "user authentication is disabled; set JWT_SECRET",
+			})
+			return
+		}
+
+		token, ok := bearerToken(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "missing access token",
+			})
+			return
+		}
+		user, err := tokens.VerifyAccessToken(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "invalid or expired access token",
+			})
+			return
+		}
+		c.Set(UserContextKey, user)
+		c.Next()
+	}
+}
+
+// CurrentUser mengembalikan user yang login untuk request ini
+func CurrentUser(c *gin.Context) (models.AuthUser, bool) {
+	v, ok := c.Get(UserContextKey)
+	if !ok {
+		return models.AuthUser{}, false
+	}
+	user, ok := v.(models.AuthUser)
+	return user, ok
+}
+
+// AdminAuth melindungi endpoint admin dengan header "Authorization: Bearer <admin_key>".
+// Jika adminKey kosong endpoint admin dimatikan.
+func AdminAuth(adminKey string) gin.HandlerFunc {
+	if adminKey == "" {
+		log.Println("[WARN] ADMIN_API_KEY not set — admin endpoints are disabled")
+	}
+
+	return func(c *gin.Context) {
+		if adminKey == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": "admin api is disabled; set ADMIN_API_KEY",
+			})
+			return
+		}
+
+		token, ok := bearerToken(c)
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(adminKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "invalid or missing admin key",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// bearerToken mengambil token dari header Authorization
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
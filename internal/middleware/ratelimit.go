@@ -13,48 +13,78 @@ type visitor struct {
 	lastSeen time.Time
 }
 
-var (
-	visitors = make(map[string]*visitor)
-	mu       sync.Mutex
-)
+// RateLimiter membatasi request per IP per menit
+type RateLimiter struct {
+	maxPerMinute int
+	visitors     map[string]*visitor
+	mu           sync.Mutex
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+// NewRateLimiter menjalankan goroutine cleanup; panggil Stop saat shutdown
+func NewRateLimiter(maxPerMinute int) *RateLimiter {
+	l := &RateLimiter{
+		maxPerMinute: maxPerMinute,
+		visitors:     make(map[string]*visitor),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go l.cleanup()
+	return l
+}
+
+// cleanup menghapus visitor lama setiap menit
+func (l *RateLimiter) cleanup() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 
-// RateLimit membatasi request per IP per menit
-func RateLimit(maxPerMinute int) gin.HandlerFunc {
-	// Cleanup visitor lama setiap menit
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			mu.Lock()
-			for ip, v := range visitors {
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			for ip, v := range l.visitors {
 				if time.Since(v.lastSeen) > time.Minute {
-					delete(visitors, ip)
+					delete(l.visitors, ip)
 				}
 			}
-			mu.Unlock()
+			l.mu.Unlock()
 		}
-	}()
+	}
+}
 
+// Stop menghentikan goroutine cleanup dan menunggu sampai selesai
+func (l *RateLimiter) Stop() {
+	close(l.stop)
+	<-l.done
+}
+
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
 
-		mu.Lock()
-		v, exists := visitors[ip]
+		l.mu.Lock()
+		v, exists := l.visitors[ip]
 		if !exists || time.Since(v.lastSeen) > time.Minute {
-			visitors[ip] = &visitor{count: 1, lastSeen: time.Now()}
-			mu.Unlock()
+			l.visitors[ip] = &visitor{count: 1, lastSeen: time.Now()}
+			l.mu.Unlock()
 			c.Next()
 			return
 		}
 
 		v.count++
-		if v.count > maxPerMinute {
-			mu.Unlock()
+		if v.count > l.maxPerMinute {
+			l.mu.Unlock()
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
 				"error": "rate limit exceeded",
 			})
 			return
 		}
-		mu.Unlock()
+		l.mu.Unlock()
 		c.Next()
 	}
-}
\ No newline at end of file
+}
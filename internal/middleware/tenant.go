@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/models"
+)
+
+// TenantContextKey menyimpan ID tenant di gin.Context
+const TenantContextKey = "tenant_id"
+
+// Tenant mengambil tenant dari user yang login (lihat UserAuth) dan
+// menyimpannya di context. Tenant tidak bisa dipilih client: request tanpa
+// user atau tanpa tenant ditolak, bukan dianggap milik tenant default.
+// Tenant user sudah diperiksa keberadaannya saat user dibuat.
+func Tenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "missing access token",
+			})
+			return
+		}
+		if !models.IsValidTenantID(user.TenantID) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "user has no tenant",
+			})
+			return
+		}
+
+		c.Set(TenantContextKey, user.TenantID)
+		c.Next()
+	}
+}
+
+// TenantID mengembalikan tenant untuk request ini; Tenant harus sudah
+// dijalankan
+func TenantID(c *gin.Context) string {
+	return c.GetString(TenantContextKey)
+}
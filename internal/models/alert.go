@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	AlertStatusOpen     = "open"
+	AlertStatusResolved = "resolved"
+)
+
+// Alert is a persisted record of a monitoring event handled by the orchestrator
+type Alert struct {
+	ID                int64      `json:"id"`
+	EventID           string     `json:"event_id"`
+	DeviceID          string     `json:"device_id,omitempty"`
+	TenantID          string     `json:"tenant_id"`
+	DeviceName        string     `json:"device_name"`
+	IPAddress         string     `json:"ip_address"`
+	Severity          string     `json:"severity"`
+	Problem           string     `json:"problem"`
+	Status            string     `json:"status"`
+	TicketID          int        `json:"ticket_id,omitempty"`
+	CustomersAffected int        `json:"customers_affected"`
+	SLAStatus         string     `json:"sla_status"`
+	OpenedAt          time.Time  `json:"opened_at"`
+	ResolvedAt        *time.Time `json:"resolved_at,omitempty"`
+}
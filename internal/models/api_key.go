@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Agent API key states. A rotated key stays usable in grace until its
+// expiry so agents can pick up the new key without missing a heartbeat.
+const (
+	APIKeyStatusActive  = "active"
+	APIKeyStatusGrace   = "grace"
+	APIKeyStatusExpired = "expired"
+	APIKeyStatusRevoked = "revoked"
+)
+
+// DeviceAPIKey is a per-device agent key. Only the SHA-256 hash of the
+// key is stored; the plaintext is returned once, when the key is issued.
+type DeviceAPIKey struct {
+	ID         string     `json:"id"`
+	DeviceID   string     `json:"device_id"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// KeyStatus derives the status of a key at now
+func KeyStatus(k DeviceAPIKey, now time.Time) string {
+	switch {
+	case k.RevokedAt != nil:
+		return APIKeyStatusRevoked
+	case k.ExpiresAt == nil:
+		return APIKeyStatusActive
+	case k.ExpiresAt.After(now):
+		return APIKeyStatusGrace
+	}
+	return APIKeyStatusExpired
+}
+
+// IssueAPIKeyRequest optionally overrides how long the device's current
+// keys keep working after the new one is issued, e.g. "1h"; "0s" revokes
+// them immediately
+type IssueAPIKeyRequest struct {
+	GracePeriod *string `json:"grace_period"`
+}
+
+// IssuedAPIKey carries the plaintext key, shown only in the issue response
+type IssuedAPIKey struct {
+	DeviceAPIKey
+	Key string `json:"key"`
+}
+
+// AgentIdentity is the device an agent request authenticated as
+type AgentIdentity struct {
+	DeviceID   string
+	DeviceName string
+	KeyID      string
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Command lifecycle: pending -> dispatched -> executing -> succeeded | failed | timed_out
+const (
+	CommandStatusPending    = "pending"
+	CommandStatusDispatched = "dispatched"
+	CommandStatusExecuting  = "executing"
+	CommandStatusSucceeded  = "succeeded"
+	CommandStatusFailed     = "failed"
+	CommandStatusTimedOut   = "timed_out"
+)
+
+const (
+	DefaultCommandTimeout = 300
+	MaxCommandTimeout     = 86400
+)
+
+var commandTransitions = map[string][]string{
+	CommandStatusPending:    {CommandStatusDispatched},
+	CommandStatusDispatched: {CommandStatusExecuting, CommandStatusSucceeded, CommandStatusFailed, CommandStatusTimedOut},
+	CommandStatusExecuting:  {CommandStatusSucceeded, CommandStatusFailed, CommandStatusTimedOut},
+}
+
+// CanTransitionCommand reports whether a command may move from one status to another
+func CanTransitionCommand(from, to string) bool {
+	for _, next := range commandTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandSourceStatuses lists the statuses a command may be in before moving to `to`
+func CommandSourceStatuses(to string) []string {
+	var from []string
+	for status, nexts := range commandTransitions {
+		for _, next := range nexts {
+			if next == to {
+				from = append(from, status)
+			}
+		}
+	}
+	return from
+}
+
+func IsTerminalCommandStatus(status string) bool {
+	switch status {
+	case CommandStatusSucceeded, CommandStatusFailed, CommandStatusTimedOut:
+		return true
+	}
+	return false
+}
+
+type Command struct {
+	ID             string          `json:"id" db:"id"`
+	DeviceID       string          `json:"device_id" db:"device_id"`
+	Type           string          `json:"type" db:"type"`
+	Parameters     json.RawMessage `json:"parameters" db:"parameters"`
+	Status         string          `json:"status" db:"status"`
+	Result         json.RawMessage `json:"result,omitempty" db:"result"`
+	Error          string          `json:"error,omitempty" db:"error"`
+	TimeoutSeconds int             `json:"timeout_seconds" db:"timeout_seconds"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	DispatchedAt   *time.Time      `json:"dispatched_at,omitempty" db:"dispatched_at"`
+	StartedAt      *time.Time      `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt    *time.Time      `json:"completed_at,omitempty" db:"completed_at"`
+	UpdatedAt      time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+type EnqueueCommandRequest struct {
+	Type           string          `json:"type" binding:"required,max=50"`
+	Parameters     json.RawMessage `json:"parameters"`
+	TimeoutSeconds int             `json:"timeout_seconds"`
+}
+
+// CommandResultRequest is posted by agents as a command progresses
+type CommandResultRequest struct {
+	Status string          `json:"status" binding:"required"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error"`
+}
+
+// DeviceFilter selects devices for bulk operations. Criteria are combined
+// with AND; All must be set explicitly to target every device.
+type DeviceFilter struct {
+	All      bool     `json:"all,omitempty"`
+	IDs      []string `json:"ids,omitempty"`
+	Location string   `json:"location,omitempty"`
+	Status   string   `json:"status,omitempty"`
+	Name     string   `json:"name,omitempty"` // glob, e.g. "Router-BDG-*"
+	// Tenant limits the targets to one tenant. Bulk jobs and rollouts set
+	// it to the request tenant; it is not a criterion of its own.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+type BulkConfigureRequest struct {
+	DeviceFilter DeviceFilter          `json:"device_filter"`
+	Command      EnqueueCommandRequest `json:"command"`
+	Confirm      bool                  `json:"confirm"`
+}
+
+// FanOutEntry reports the command created for one device in a bulk job
+type FanOutEntry struct {
+	DeviceID   string `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	CommandID  string `json:"command_id"`
+	Status     string `json:"status"`
+}
+
+// Execution summarises the progress of a bulk command job
+type Execution struct {
+	ID           string          `json:"id"`
+	CommandType  string          `json:"command_type"`
+	Parameters   json.RawMessage `json:"parameters"`
+	DeviceFilter json.RawMessage `json:"device_filter"`
+	TotalDevices int             `json:"total_devices"`
+	Pending      int             `json:"pending"`
+	Running      int             `json:"running"`
+	Completed    int             `json:"completed"`
+	Failed       int             `json:"failed"`
+	Progress     int             `json:"progress"`
+	Status       string          `json:"status"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Devices      []FanOutEntry   `json:"devices"`
+}
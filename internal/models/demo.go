@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Demo reset actions and triggers recorded in demo_resets
+const (
+	DemoActionReset   = "reset"
+	DemoActionRestore = "restore"
+
+	DemoTriggerAuto   = "auto"
+	DemoTriggerManual = "manual"
+)
+
+// DemoReset is one audited reset of the demo inventory, or the undo of an
+// earlier one. The snapshot itself is not exposed.
+type DemoReset struct {
+	ID            int64      `json:"id"`
+	Action        string     `json:"action"`
+	TriggeredBy   string     `json:"triggered_by"`
+	Actor         string     `json:"actor,omitempty"`
+	Reason        string     `json:"reason,omitempty"`
+	UndoesID      *int64     `json:"undoes_id,omitempty"`
+	DevicesBefore int        `json:"devices_before"`
+	DevicesAfter  int        `json:"devices_after"`
+	UndoneAt      *time.Time `json:"undone_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// Restored counts the rows an undo put back, per table
+	Restored map[string]int `json:"restored,omitempty"`
+}
+
+type DemoResetRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
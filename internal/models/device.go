@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+    "regexp"
+    "time"
+)
 
 type Device struct {
     ID        string    `json:"id" db:"id"`
@@ -12,12 +15,16 @@ type Device struct {
     LastSeen  time.Time `json:"last_seen" db:"last_seen"`
     CreatedAt time.Time `json:"created_at" db:"created_at"`
     UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+    Revision  int64     `json:"revision" db:"revision"`
+    TenantID  string    `json:"tenant_id" db:"tenant_id"`
 }
 
+// CreateDeviceRequest and UpdateDeviceRequest are checked with Validate
+// (see device_validation.go) so every invalid field is reported at once
 type CreateDeviceRequest struct {
-    Name      string `json:"name" binding:"required"`
-    IPAddress string `json:"ip_address" binding:"required"`
-    Location  string `json:"location" binding:"required"`
+    Name      string `json:"name"`
+    IPAddress string `json:"ip_address"`
+    Location  string `json:"location"`
 }
 
 type UpdateDeviceRequest struct {
@@ -26,3 +33,48 @@ type UpdateDeviceRequest struct {
     Location  string `json:"location"`
     Status    string `json:"status"`
 }
+
+// Device statuses accepted from agents and operators
+const (
+    DeviceStatusOnline   = "online"
+    DeviceStatusOffline  = "offline"
+    DeviceStatusDegraded = "degraded"
+    DeviceStatusUnknown  = "unknown"
+)
+
+func IsValidDeviceStatus(status string) bool {
+    switch status {
+    case DeviceStatusOnline, DeviceStatusOffline, DeviceStatusDegraded, DeviceStatusUnknown:
+        return true
+    }
+    return false
+}
+
+// HeartbeatRequest is the payload agents send to POST /api/v1/agent/heartbeat.
+// DeviceID accepts either the device UUID or its name (case-insensitive).
+type HeartbeatRequest struct {
+    DeviceID   string `json:"device_id" binding:"required"`
+    Status     string `json:"status"`
+    Version    string `json:"version"`
+    Uptime     string `json:"uptime"`
+    CPULoad    string `json:"cpu_load"`
+    FreeMemory string `json:"free_memory"`
+}
+
+type Heartbeat struct {
+    ID         int64     `json:"id" db:"id"`
+    DeviceID   string    `json:"device_id" db:"device_id"`
+    Status     string    `json:"status" db:"status"`
+    Version    string    `json:"version" db:"version"`
+    Uptime     string    `json:"uptime" db:"uptime"`
+    CPULoad    string    `json:"cpu_load" db:"cpu_load"`
+    FreeMemory string    `json:"free_memory" db:"free_memory"`
+    ReceivedAt time.Time `json:"received_at" db:"received_at"`
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// IsValidUUID reports whether s is a canonical textual UUID
+func IsValidUUID(s string) bool {
+    return uuidPattern.MatchString(s)
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Column limits from migration 001
+const (
+	MaxDeviceNameLength     = 100
+	MaxDeviceLocationLength = 200
+)
+
+// FieldError describes one invalid member of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Names start with a letter or digit and may contain spaces, dots,
+// underscores and dashes, e.g. "Router-BDG-01"
+var deviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ._-]*$`)
+
+// ValidateDeviceName returns an empty string when name is acceptable
+func ValidateDeviceName(name string) string {
+	switch {
+	case name == "":
+		return "is required"
+	case utf8.RuneCountInString(name) > MaxDeviceNameLength:
+		return "must be at most 100 characters"
+	case name != strings.TrimSpace(name):
+		return "must not start or end with whitespace"
+	case !deviceNamePattern.MatchString(name):
+		return "may only contain letters, digits, spaces, '.', '_' and '-', and must start with a letter or digit"
+	}
+	return ""
+}
+
+// NormalizeDeviceIP parses an IPv4 or IPv6 address, optionally with a CIDR
+// prefix length for management subnets, and returns its canonical form
+// (e.g. "2001:DB8::0001" becomes "2001:db8::1"). Host bits are kept, so
+// "10.0.0.5/24" stays as written.
+func NormalizeDeviceIP(s string) (string, string) {
+	if s == "" {
+		return "", "is required"
+	}
+
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return "", "must be an IPv4 or IPv6 address, optionally with a CIDR prefix length"
+		}
+		return prefix.String(), ""
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.Zone() != "" {
+		return "", "must be an IPv4 or IPv6 address, optionally with a CIDR prefix length"
+	}
+	return addr.String(), ""
+}
+
+// ValidateDeviceLocation returns an empty string when location is acceptable
+func ValidateDeviceLocation(location string) string {
+	if utf8.RuneCountInString(location) > MaxDeviceLocationLength {
+		return "must be at most 200 characters"
+	}
+	for _, r := range location {
+		if unicode.IsControl(r) {
+			return "must not contain control characters"
+		}
+	}
+	return ""
+}
+
+// Validate checks every field and canonicalizes the IP address in place
+func (r *CreateDeviceRequest) Validate() []FieldError {
+	var errs []FieldError
+	if msg := ValidateDeviceName(r.Name); msg != "" {
+		errs = append(errs, FieldError{"name", msg})
+	}
+	ip, msg := NormalizeDeviceIP(r.IPAddress)
+	if msg != "" {
+		errs = append(errs, FieldError{"ip_address", msg})
+	}
+	r.IPAddress = ip
+	if r.Location == "" {
+		errs = append(errs, FieldError{"location", "is required"})
+	} else if msg := ValidateDeviceLocation(r.Location); msg != "" {
+		errs = append(errs, FieldError{"location", msg})
+	}
+	return errs
+}
+
+// Validate checks every field and canonicalizes the IP address in place.
+// PUT replaces the whole resource, so status is required here.
+func (r *UpdateDeviceRequest) Validate() []FieldError {
+	var errs []FieldError
+	if msg := ValidateDeviceName(r.Name); msg != "" {
+		errs = append(errs, FieldError{"name", msg})
+	}
+	ip, msg := NormalizeDeviceIP(r.IPAddress)
+	if msg != "" {
+		errs = append(errs, FieldError{"ip_address", msg})
+	}
+	r.IPAddress = ip
+	if msg := ValidateDeviceLocation(r.Location); msg != "" {
+		errs = append(errs, FieldError{"location", msg})
+	}
+	if !IsValidDeviceStatus(r.Status) {
+		errs = append(errs, FieldError{"status", "must be one of online, offline, degraded, unknown"})
+	}
+	return errs
+}
@@ -0,0 +1,108 @@
+package models
+
+import "strings"
+
+// Roles a dashboard user can be granted
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// Permissions checked on the user routes
+const (
+	PermDevicesRead     = "devices:read"
+	PermDevicesWrite    = "devices:write"
+	PermDevicesDelete   = "devices:delete"
+	PermCommandsRead    = "commands:read"
+	PermCommandsExecute = "commands:execute"
+	PermRolloutsRead    = "rollouts:read"
+	PermRolloutsManage  = "rollouts:manage"
+	PermAlertsTest      = "alerts:test"
+)
+
+var viewerPermissions = []string{PermDevicesRead, PermCommandsRead, PermRolloutsRead}
+
+// rolePermissions lists what each role may do; every role includes the
+// permissions of the roles below it
+var rolePermissions = map[string][]string{
+	RoleViewer:   viewerPermissions,
+	RoleOperator: append(append([]string{}, viewerPermissions...), PermDevicesWrite, PermCommandsExecute),
+	RoleAdmin: append(append([]string{}, viewerPermissions...), PermDevicesWrite, PermCommandsExecute,
+		PermDevicesDelete, PermRolloutsManage, PermAlertsTest),
+}
+
+// DefaultRole is granted to users created without roles
+const DefaultRole = RoleViewer
+
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RolePermissions returns the permissions of role, nil if unknown
+func RolePermissions(role string) []string {
+	return rolePermissions[role]
+}
+
+func roleHasPermission(role, perm string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleGrant gives a user a role. A grant with a location only applies to
+// devices at that location (case-insensitive); without one it applies
+// everywhere.
+type RoleGrant struct {
+	Role     string `json:"role"`
+	Location string `json:"location,omitempty"`
+}
+
+// SetRolesRequest replaces all grants of a user
+type SetRolesRequest struct {
+	Roles []RoleGrant `json:"roles" binding:"required"`
+}
+
+// Can reports whether the user may use perm on a device at location. An
+// empty location needs a grant without a location.
+func (u AuthUser) Can(perm, location string) bool {
+	for _, g := range u.Roles {
+		if !roleHasPermission(g.Role, perm) {
+			continue
+		}
+		if g.Location == "" || (location != "" && strings.EqualFold(g.Location, location)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSomewhere reports whether any grant, scoped to a location or not,
+// gives perm
+func (u AuthUser) CanSomewhere(perm string) bool {
+	for _, g := range u.Roles {
+		if roleHasPermission(g.Role, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Locations returns the locations where the user has perm; all is true
+// when a grant without a location gives it
+func (u AuthUser) Locations(perm string) (locations []string, all bool) {
+	for _, g := range u.Roles {
+		if !roleHasPermission(g.Role, perm) {
+			continue
+		}
+		if g.Location == "" {
+			return nil, true
+		}
+		locations = append(locations, g.Location)
+	}
+	return locations, false
+}
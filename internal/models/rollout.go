@@ -0,0 +1,80 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Rollout statuses
+const (
+	RolloutStatusRunning   = "running"
+	RolloutStatusPaused    = "paused"
+	RolloutStatusCompleted = "completed"
+	RolloutStatusAborted   = "aborted"
+)
+
+// Per-device rollout statuses
+const (
+	RolloutDevicePending    = "pending"
+	RolloutDeviceInProgress = "in_progress"
+	RolloutDeviceSucceeded  = "succeeded"
+	RolloutDeviceFailed     = "failed"
+	RolloutDeviceSkipped    = "skipped"
+)
+
+// FirmwareUpdateCommand is the command type agents receive for rollouts.
+// Agents may include {"version": "<new version>"} in the result to confirm
+// the upgrade before their next heartbeat.
+const FirmwareUpdateCommand = "firmware_update"
+
+type Rollout struct {
+	ID               string          `json:"id"`
+	TenantID         string          `json:"tenant_id"`
+	TargetVersion    string          `json:"target_version"`
+	FirmwareURL      string          `json:"firmware_url,omitempty"`
+	DeviceFilter     json.RawMessage `json:"device_filter"`
+	CanaryPercent    int             `json:"canary_percent"`
+	BatchSize        int             `json:"batch_size"`
+	FailureThreshold float64         `json:"failure_threshold"`
+	TimeoutSeconds   int             `json:"timeout_seconds"`
+	Status           string          `json:"status"`
+	CurrentWave      int             `json:"current_wave"`
+	TotalWaves       int             `json:"total_waves"`
+	PauseReason      string          `json:"pause_reason,omitempty"`
+	Progress         RolloutProgress `json:"progress"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+	CompletedAt      *time.Time      `json:"completed_at,omitempty"`
+	Devices          []RolloutDevice `json:"devices,omitempty"`
+}
+
+type RolloutProgress struct {
+	Total      int `json:"total"`
+	Pending    int `json:"pending"`
+	InProgress int `json:"in_progress"`
+	Succeeded  int `json:"succeeded"`
+	Failed     int `json:"failed"`
+	Skipped    int `json:"skipped"`
+}
+
+type RolloutDevice struct {
+	DeviceID        string    `json:"device_id"`
+	DeviceName      string    `json:"device_name"`
+	Wave            int       `json:"wave"`
+	Status          string    `json:"status"`
+	CommandID       string    `json:"command_id,omitempty"`
+	PreviousVersion string    `json:"previous_version,omitempty"`
+	CurrentVersion  string    `json:"current_version,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type CreateRolloutRequest struct {
+	TargetVersion    string       `json:"target_version" binding:"required,max=50"`
+	FirmwareURL      string       `json:"firmware_url"`
+	DeviceFilter     DeviceFilter `json:"device_filter"`
+	CanaryPercent    int          `json:"canary_percent"`
+	BatchSize        int          `json:"batch_size"`
+	FailureThreshold *float64     `json:"failure_threshold"`
+	TimeoutSeconds   int          `json:"timeout_seconds"`
+}
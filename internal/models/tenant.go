@@ -0,0 +1,59 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// DefaultTenantID owns devices created without an explicit tenant
+const DefaultTenantID = "default"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// IsValidTenantID reports whether id is a lowercase slug of at most 64 characters
+func IsValidTenantID(id string) bool {
+	return tenantIDPattern.MatchString(id)
+}
+
+// Quota names used in errors and usage reports
+const (
+	QuotaDevices         = "devices"
+	QuotaCommandsPerHour = "commands_per_hour"
+	QuotaAlertsPerHour   = "alerts_per_hour"
+)
+
+// TenantQuotas are the per-tenant limits; nil means unlimited
+type TenantQuotas struct {
+	MaxDevices         *int `json:"max_devices"`
+	MaxCommandsPerHour *int `json:"max_commands_per_hour"`
+	MaxAlertsPerHour   *int `json:"max_alerts_per_hour"`
+}
+
+// TenantUsage is current consumption measured against TenantQuotas.
+// Hourly figures cover a sliding one-hour window.
+type TenantUsage struct {
+	Devices          int `json:"devices"`
+	CommandsLastHour int `json:"commands_last_hour"`
+	AlertsLastHour   int `json:"alerts_last_hour"`
+}
+
+type Tenant struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Quotas    TenantQuotas `json:"quotas"`
+	Usage     TenantUsage  `json:"usage"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+type CreateTenantRequest struct {
+	ID     string       `json:"id" binding:"required"`
+	Name   string       `json:"name" binding:"required,max=200"`
+	Quotas TenantQuotas `json:"quotas"`
+}
+
+// UpdateTenantRequest replaces the name (when set) and all quotas
+type UpdateTenantRequest struct {
+	Name   string       `json:"name" binding:"max=200"`
+	Quotas TenantQuotas `json:"quotas"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// MinPasswordLength is the shortest password accepted for a user
+const MinPasswordLength = 10
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{2,63}$`)
+
+// IsValidUsername reports whether name is a lowercase login of 3 to 64
+// characters
+func IsValidUsername(name string) bool {
+	return usernamePattern.MatchString(name)
+}
+
+// User is a dashboard user. Passwords are stored as bcrypt hashes; a
+// disabled user can no longer log in or refresh tokens. The user only sees
+// and creates devices of their tenant.
+type User struct {
+	ID           string      `json:"id"`
+	Username     string      `json:"username"`
+	TenantID     string      `json:"tenant_id"`
+	PasswordHash string      `json:"-"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	DisabledAt   *time.Time  `json:"disabled_at,omitempty"`
+	Roles        []RoleGrant `json:"roles"`
+}
+
+// CreateUserRequest creates a user; without roles the user is a viewer,
+// and without a tenant they belong to the default tenant
+type CreateUserRequest struct {
+	Username string      `json:"username" binding:"required"`
+	Password string      `json:"password" binding:"required"`
+	TenantID string      `json:"tenant_id"`
+	Roles    []RoleGrant `json:"roles"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenPair is returned by login and refresh. The refresh token is single
+// use: each refresh returns a new one.
+type TokenPair struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int    `json:"refresh_expires_in"`
+}
+
+// AuthUser is the user an access token was issued to, with their tenant
+// and the roles they held when it was issued
+type AuthUser struct {
+	ID       string      `json:"id"`
+	Username string      `json:"username"`
+	TenantID string      `json:"tenant_id"`
+	Roles    []RoleGrant `json:"roles"`
+}
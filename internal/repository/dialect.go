@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"portofolionetworkapi/internal/database"
+)
+
+// sqlDialect holds what differs between the SQL backends; the queries in
+// the sql_*.go files are otherwise shared
+type sqlDialect struct {
+	// ilike is a case-insensitive LIKE
+	ilike string
+	// now is the current timestamp in the column format
+	now string
+	// epoch is the timestamp a NULL sorts as
+	epoch string
+	// forUpdate locks selected rows until the transaction ends
+	forUpdate string
+	// skipLocked is forUpdate, leaving out rows locked by others
+	skipLocked string
+	// secondsFromNow is the timestamp the bound number of seconds after now
+	secondsFromNow func(placeholder string) string
+	// addSeconds is the timestamp expression ts plus the number secs
+	addSeconds func(ts, secs string) string
+	// uuidArg and jsonArg type a bound value where the column type can't
+	// be inferred (INSERT ... SELECT, COALESCE)
+	uuidArg func(placeholder string) string
+	jsonArg func(placeholder string) string
+	// timeArg binds a timestamp so it compares correctly with stored ones
+	timeArg func(time.Time) interface{}
+	// uniqueViolation reports whether err comes from a UNIQUE constraint
+	uniqueViolation func(error) bool
+	// reserveDeviceSlot enforces the demo cap inside the create transaction
+	reserveDeviceSlot func(*sql.Tx) (int, error)
+}
+
+var postgresDialect = sqlDialect{
+	ilike:      "ILIKE",
+	now:        "NOW()",
+	epoch:      "'epoch'::timestamp",
+	forUpdate:  " FOR UPDATE",
+	skipLocked: " FOR UPDATE SKIP LOCKED",
+	secondsFromNow: func(p string) string {
+		return "(NOW() + CAST(" + p + " AS DOUBLE PRECISION) * INTERVAL '1 second')"
+	},
+	addSeconds: func(ts, secs string) string {
+		return "(" + ts + " + CAST(" + secs + " AS DOUBLE PRECISION) * INTERVAL '1 second')"
+	},
+	uuidArg: func(p string) string { return "CAST(" + p + " AS UUID)" },
+	jsonArg: func(p string) string { return "CAST(" + p + " AS JSONB)" },
+	timeArg: func(t time.Time) interface{} { return t },
+	uniqueViolation: func(err error) bool {
+		var pqErr *pq.Error
+		return errors.As(err, &pqErr) && pqErr.Code == "23505"
+	},
+	reserveDeviceSlot: database.ReserveDeviceSlot,
+}
+
+// sqliteTimeFormat is how the SQLite migrations store timestamps: UTC text
+// that sorts chronologically
+const sqliteTimeFormat = "2006-01-02 15:04:05.000"
+
+// SQLite runs one write transaction at a time (see database.OpenSQLite), so
+// there is nothing to lock; demo mode is not available on SQLite.
+var sqliteDialect = sqlDialect{
+	ilike:      "LIKE",
+	now:        "strftime('%Y-%m-%d %H:%M:%f', 'now')",
+	epoch:      "'1970-01-01 00:00:00.000'",
+	forUpdate:  "",
+	skipLocked: "",
+	secondsFromNow: func(p string) string {
+		return "strftime('%Y-%m-%d %H:%M:%f', 'now', printf('%+.3f seconds', " + p + "))"
+	},
+	addSeconds: func(ts, secs string) string {
+		return "strftime('%Y-%m-%d %H:%M:%f', " + ts + ", printf('%+.3f seconds', " + secs + "))"
+	},
+	uuidArg: func(p string) string { return p },
+	jsonArg: func(p string) string { return p },
+	timeArg: func(t time.Time) interface{} { return t.UTC().Format(sqliteTimeFormat) },
+	uniqueViolation: func(err error) bool {
+		var sqliteErr *sqlite.Error
+		if !errors.As(err, &sqliteErr) {
+			return false
+		}
+		// Text primary keys report their own code; Postgres reports both as 23505
+		code := sqliteErr.Code()
+		return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	},
+	reserveDeviceSlot: func(*sql.Tx) (int, error) { return 0, nil },
+}
@@ -0,0 +1,928 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"portofolionetworkapi/internal/database"
+	"portofolionetworkapi/internal/models"
+)
+
+// NewMemory returns empty in-memory repositories for tests and local runs
+// without a database. Devices, alerts, commands, tenants and rollouts share
+// one store so deletes cascade like the foreign keys in the migrations.
+func NewMemory() Repositories {
+	s := newMemoryStore()
+	devices := &MemoryDeviceRepository{s}
+	return Repositories{
+		Devices:  devices,
+		Alerts:   &MemoryAlertRepository{s},
+		Commands: &MemoryCommandRepository{s},
+		Tenants:  &MemoryTenantRepository{s},
+		Rollouts: &MemoryRolloutRepository{s},
+		APIKeys:  NewMemoryAPIKeyRepository(devices),
+		Users:    NewMemoryUserRepository(&MemoryTenantRepository{s}),
+	}
+}
+
+// memoryStore holds the records of the in-memory repositories behind one
+// lock, which plays the part of the SQL transactions
+type memoryStore struct {
+	mu         sync.RWMutex
+	devices    map[string]models.Device
+	staleSince map[string]time.Time
+	heartbeats map[string][]models.Heartbeat
+	nextBeatID int64
+	tenants    map[string]models.Tenant // without usage
+	alerts     []*memoryAlert
+	commands   []*memoryCommand // oldest first
+	jobs       map[string]models.Execution
+	rollouts   map[string]*memoryRollout
+}
+
+// newMemoryStore returns an empty store with the default tenant, like a
+// freshly migrated database
+func newMemoryStore() *memoryStore {
+	now := time.Now().UTC()
+	return &memoryStore{
+		devices:    map[string]models.Device{},
+		staleSince: map[string]time.Time{},
+		heartbeats: map[string][]models.Heartbeat{},
+		tenants: map[string]models.Tenant{
+			models.DefaultTenantID: {ID: models.DefaultTenantID, Name: "Default", CreatedAt: now, UpdatedAt: now},
+		},
+		jobs:     map[string]models.Execution{},
+		rollouts: map[string]*memoryRollout{},
+	}
+}
+
+// MemoryDeviceRepository keeps devices in a map. It honours the demo cap
+// and tenant device quotas like Postgres does. Names sort by byte order,
+// which matches Postgres only under the C collation.
+type MemoryDeviceRepository struct {
+	*memoryStore
+}
+
+func NewMemoryDeviceRepository() *MemoryDeviceRepository {
+	return &MemoryDeviceRepository{newMemoryStore()}
+}
+
+func (r *MemoryDeviceRepository) List(ctx context.Context, opts DeviceListOptions) ([]models.Device, int, error) {
+	if !IsValidDeviceSort(opts.Sort) {
+		return nil, 0, fmt.Errorf("unknown device sort %q", opts.Sort)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matched := []models.Device{}
+	for _, d := range r.devices {
+		if matchesDeviceFilter(d, opts.DeviceFilter) {
+			matched = append(matched, d)
+		}
+	}
+	total := len(matched)
+
+	desc := opts.Order == "desc"
+	sort.Slice(matched, func(i, j int) bool {
+		c := compareDeviceKey(opts.Sort, matched[i], sortCursor(opts.Sort, matched[j]))
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	devices := []models.Device{}
+	for _, d := range matched {
+		if opts.After != nil {
+			c := compareDeviceKey(opts.Sort, d, *opts.After)
+			if (!desc && c <= 0) || (desc && c >= 0) {
+				continue
+			}
+		}
+		if len(devices) == opts.Limit {
+			break
+		}
+		devices = append(devices, d)
+	}
+	return devices, total, nil
+}
+
+func matchesDeviceFilter(d models.Device, f DeviceFilter) bool {
+	switch {
+	case f.Status != "" && d.Status != f.Status,
+		f.Location != "" && !strings.EqualFold(d.Location, f.Location),
+		f.Locations != nil && !containsFold(f.Locations, d.Location),
+		f.Name != "" && !strings.Contains(strings.ToLower(d.Name), strings.ToLower(f.Name)),
+		f.IPPrefix != "" && !strings.HasPrefix(d.IPAddress, f.IPPrefix),
+		f.Tenant != "" && d.TenantID != f.Tenant:
+		return false
+	}
+	return true
+}
+
+// containsFold reports whether values holds s, ignoring case
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareDeviceKey orders d against a cursor by (sort key, id)
+func compareDeviceKey(sortBy string, d models.Device, cur DeviceCursor) int {
+	var c int
+	switch sortBy {
+	case SortByName:
+		c = strings.Compare(d.Name, cur.Name)
+	case SortByLastSeen:
+		c = sortKeyTime(d.LastSeen).Compare(sortKeyTime(cur.Time))
+	case SortByCreatedAt:
+		c = sortKeyTime(d.CreatedAt).Compare(sortKeyTime(cur.Time))
+	}
+	if c == 0 {
+		c = strings.Compare(d.ID, cur.ID)
+	}
+	return c
+}
+
+// sortCursor is the cursor that would point at d in the given sort
+func sortCursor(sortBy string, d models.Device) DeviceCursor {
+	cur := DeviceCursor{Name: d.Name, Time: d.LastSeen, ID: d.ID}
+	if sortBy == SortByCreatedAt {
+		cur.Time = d.CreatedAt
+	}
+	return cur
+}
+
+// sortKeyTime treats a missing timestamp as the epoch, like the Postgres sort
+func sortKeyTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Unix(0, 0)
+	}
+	return t
+}
+
+func (r *MemoryDeviceRepository) Get(ctx context.Context, id string) (models.Device, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	d, ok := r.devices[id]
+	if !ok {
+		return d, ErrNotFound
+	}
+	return d, nil
+}
+
+func (r *MemoryDeviceRepository) Create(ctx context.Context, tenantID string, req models.CreateDeviceRequest) (models.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if database.DeviceLimitEnabled() && len(r.devices) >= database.MaxDevices {
+		return models.Device{}, &DeviceLimitError{Count: len(r.devices)}
+	}
+	t, ok := r.tenants[tenantID]
+	if !ok {
+		return models.Device{}, ErrTenantNotFound
+	}
+	if limit := t.Quotas.MaxDevices; limit != nil {
+		if used := r.tenantDevices(tenantID); used+1 > *limit {
+			return models.Device{}, &QuotaExceededError{TenantID: tenantID, Quota: models.QuotaDevices,
+				Limit: *limit, Used: used, Requested: 1}
+		}
+	}
+	if r.nameTaken(req.Name, "") {
+		return models.Device{}, ErrDuplicateName
+	}
+
+	now := time.Now().UTC()
+	d := models.Device{
+		ID:        newUUID(),
+		Name:      req.Name,
+		IPAddress: req.IPAddress,
+		Location:  req.Location,
+		Status:    models.DeviceStatusUnknown,
+		LastSeen:  now,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Revision:  1,
+		TenantID:  tenantID,
+	}
+	r.devices[d.ID] = d
+	return d, nil
+}
+
+func (r *MemoryDeviceRepository) Update(ctx context.Context, id string, req models.UpdateDeviceRequest, pre Precondition) (models.Device, error) {
+	patch := DevicePatch{
+		"name":       &req.Name,
+		"ip_address": &req.IPAddress,
+		"location":   &req.Location,
+		"status":     &req.Status,
+	}
+	return r.Patch(ctx, id, patch, pre)
+}
+
+func (r *MemoryDeviceRepository) Patch(ctx context.Context, id string, patch DevicePatch, pre Precondition) (models.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.devices[id]
+	if !ok {
+		return d, ErrNotFound
+	}
+	if !pre.Matches(d.Revision) {
+		return d, ErrRevisionMismatch
+	}
+	if len(patch) == 0 {
+		return d, nil
+	}
+
+	for field, value := range patch {
+		v := ""
+		if value != nil {
+			v = *value
+		}
+		switch field {
+		case "name":
+			if r.nameTaken(v, id) {
+				return models.Device{}, ErrDuplicateName
+			}
+			d.Name = v
+		case "ip_address":
+			d.IPAddress = v
+		case "location":
+			d.Location = v
+		case "status":
+			d.Status = v
+		default:
+			return models.Device{}, fmt.Errorf("device field %q cannot be patched", field)
+		}
+	}
+	d.UpdatedAt = time.Now().UTC()
+	d.Revision++
+	r.devices[id] = d
+	return d, nil
+}
+
+// Delete also removes the device's heartbeats, commands and rollout
+// entries and unlinks its alerts, as the foreign keys do in SQL
+func (r *MemoryDeviceRepository) Delete(ctx context.Context, id string, pre Precondition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.devices[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if !pre.Matches(d.Revision) {
+		return ErrRevisionMismatch
+	}
+	delete(r.devices, id)
+	delete(r.staleSince, id)
+	delete(r.heartbeats, id)
+
+	removed := map[string]bool{}
+	kept := r.commands[:0]
+	for _, cmd := range r.commands {
+		if cmd.DeviceID == id {
+			removed[cmd.ID] = true
+			continue
+		}
+		kept = append(kept, cmd)
+	}
+	r.commands = kept
+
+	for _, ro := range r.rollouts {
+		devices := ro.devices[:0]
+		for _, rd := range ro.devices {
+			if rd.DeviceID == id {
+				continue
+			}
+			if removed[rd.CommandID] {
+				rd.CommandID = ""
+			}
+			devices = append(devices, rd)
+		}
+		ro.devices = devices
+	}
+	for _, a := range r.alerts {
+		if a.DeviceID == id {
+			a.DeviceID = ""
+		}
+	}
+	return nil
+}
+
+func (r *MemoryDeviceRepository) RecentHeartbeats(ctx context.Context, deviceID string, limit int) ([]models.Heartbeat, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Stored oldest first
+	stored := r.heartbeats[deviceID]
+	heartbeats := []models.Heartbeat{}
+	for i := len(stored) - 1; i >= 0 && len(heartbeats) < limit; i-- {
+		heartbeats = append(heartbeats, stored[i])
+	}
+	return heartbeats, nil
+}
+
+func (r *MemoryDeviceRepository) RecordHeartbeat(ctx context.Context, req models.HeartbeatRequest) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, found := r.resolve(req.DeviceID)
+	if !found {
+		return "", ErrNotFound
+	}
+
+	version := d.Version
+	if req.Version != "" {
+		version = req.Version
+	}
+	if d.Status != req.Status || d.Version != version {
+		d.Revision++
+	}
+	now := time.Now().UTC()
+	d.Status, d.Version = req.Status, version
+	d.LastSeen, d.UpdatedAt = now, now
+	r.devices[d.ID] = d
+
+	r.nextBeatID++
+	r.heartbeats[d.ID] = append(r.heartbeats[d.ID], models.Heartbeat{
+		ID:         r.nextBeatID,
+		DeviceID:   d.ID,
+		Status:     req.Status,
+		Version:    req.Version,
+		Uptime:     req.Uptime,
+		CPULoad:    req.CPULoad,
+		FreeMemory: req.FreeMemory,
+		ReceivedAt: now,
+	})
+	return d.ID, nil
+}
+
+func (r *MemoryDeviceRepository) Resolve(ctx context.Context, ref string) (models.Device, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	d, found := r.resolve(ref)
+	if !found {
+		return d, ErrNotFound
+	}
+	return d, nil
+}
+
+func (r *MemoryDeviceRepository) Match(ctx context.Context, name, ip string) (models.Device, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var (
+		byIP  models.Device
+		found bool
+	)
+	for _, d := range r.devices {
+		if strings.EqualFold(d.Name, name) {
+			return d, nil
+		}
+		if d.IPAddress == ip && (!found || d.ID < byIP.ID) {
+			byIP, found = d, true
+		}
+	}
+	if !found {
+		return byIP, ErrNotFound
+	}
+	return byIP, nil
+}
+
+func (r *MemoryDeviceRepository) MarkStale(ctx context.Context, grace time.Duration) ([]models.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	stale := []models.Device{}
+	for id, d := range r.devices {
+		if _, marked := r.staleSince[id]; marked {
+			continue
+		}
+		if d.Status != models.DeviceStatusOnline && d.Status != models.DeviceStatusDegraded {
+			continue
+		}
+		if !d.LastSeen.Before(now.Add(-grace)) {
+			continue
+		}
+		d.Status = models.DeviceStatusOffline
+		d.UpdatedAt = now
+		d.Revision++
+		r.devices[id] = d
+		r.staleSince[id] = now
+		stale = append(stale, d)
+	}
+	return stale, nil
+}
+
+func (r *MemoryDeviceRepository) MarkRecovered(ctx context.Context) ([]models.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recovered := []models.Device{}
+	for id, since := range r.staleSince {
+		if d := r.devices[id]; d.LastSeen.After(since) {
+			delete(r.staleSince, id)
+			recovered = append(recovered, d)
+		}
+	}
+	return recovered, nil
+}
+
+// resolve finds a device by UUID or name (case-insensitive); mu must be held
+func (s *memoryStore) resolve(ref string) (models.Device, bool) {
+	if d, ok := s.devices[ref]; ok {
+		return d, true
+	}
+	for _, d := range s.devices {
+		if strings.EqualFold(d.ID, ref) || strings.EqualFold(d.Name, ref) {
+			return d, true
+		}
+	}
+	return models.Device{}, false
+}
+
+// tenantDevices counts the devices of a tenant; mu must be held
+func (s *memoryStore) tenantDevices(tenantID string) int {
+	n := 0
+	for _, d := range s.devices {
+		if d.TenantID == tenantID {
+			n++
+		}
+	}
+	return n
+}
+
+// nameTaken reports whether another device than exceptID uses name
+func (r *MemoryDeviceRepository) nameTaken(name, exceptID string) bool {
+	for _, d := range r.devices {
+		if d.Name == name && d.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryAlertRepository keeps alerts in the shared store; Add seeds them
+// directly for tests
+type MemoryAlertRepository struct {
+	*memoryStore
+}
+
+type memoryAlert struct {
+	models.Alert
+	raisedAt time.Time
+}
+
+func (r *MemoryAlertRepository) Add(a models.Alert) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a.ID = int64(len(r.alerts) + 1)
+	r.alerts = append(r.alerts, &memoryAlert{Alert: a, raisedAt: time.Now()})
+}
+
+func (r *MemoryAlertRepository) OpenForDevice(ctx context.Context, deviceID string) ([]models.Alert, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	alerts := []models.Alert{}
+	for _, a := range r.alerts {
+		if a.DeviceID == deviceID && a.Status == models.AlertStatusOpen {
+			alerts = append(alerts, a.Alert)
+		}
+	}
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].OpenedAt.After(alerts[j].OpenedAt) })
+	return alerts, nil
+}
+
+func (r *MemoryAlertRepository) Raise(ctx context.Context, a models.Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, stored := range r.alerts {
+		if stored.EventID != a.EventID {
+			continue
+		}
+		stored.Status, stored.ResolvedAt = models.AlertStatusOpen, nil
+		stored.Severity, stored.Problem = a.Severity, a.Problem
+		if a.TicketID != 0 {
+			stored.TicketID = a.TicketID
+		}
+		stored.CustomersAffected, stored.SLAStatus = a.CustomersAffected, a.SLAStatus
+		stored.raisedAt = now
+		return nil
+	}
+
+	a.ID = int64(len(r.alerts) + 1)
+	a.Status, a.ResolvedAt = models.AlertStatusOpen, nil
+	r.alerts = append(r.alerts, &memoryAlert{Alert: a, raisedAt: now})
+	return nil
+}
+
+func (r *MemoryAlertRepository) Resolve(ctx context.Context, eventID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, a := range r.alerts {
+		if a.EventID == eventID && a.Status == models.AlertStatusOpen {
+			resolved := at
+			a.Status, a.ResolvedAt = models.AlertStatusResolved, &resolved
+		}
+	}
+	return nil
+}
+
+func (r *MemoryAlertRepository) CheckQuota(ctx context.Context, tenantID, eventID string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.tenants[tenantID]
+	if !ok {
+		return ErrTenantNotFound
+	}
+	limit := t.Quotas.MaxAlertsPerHour
+	if limit == nil {
+		return nil
+	}
+	used := r.alertsLastHour(tenantID, eventID)
+	if used+1 > *limit {
+		return &QuotaExceededError{TenantID: tenantID, Quota: models.QuotaAlertsPerHour,
+			Limit: *limit, Used: used, Requested: 1}
+	}
+	return nil
+}
+
+// alertsLastHour counts the tenant's alerts raised in the last hour, other
+// than exceptEvent; mu must be held
+func (s *memoryStore) alertsLastHour(tenantID, exceptEvent string) int {
+	since := time.Now().Add(-time.Hour)
+	n := 0
+	for _, a := range s.alerts {
+		if a.TenantID == tenantID && a.EventID != exceptEvent && a.raisedAt.After(since) {
+			n++
+		}
+	}
+	return n
+}
+
+// MemoryAPIKeyRepository keeps keys in a map and looks devices up in
+// devices; keys of a deleted device stop being usable
+type MemoryAPIKeyRepository struct {
+	devices DeviceRepository
+
+	mu   sync.RWMutex
+	keys map[string]models.DeviceAPIKey
+}
+
+func NewMemoryAPIKeyRepository(devices DeviceRepository) *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{devices: devices, keys: map[string]models.DeviceAPIKey{}}
+}
+
+func (r *MemoryAPIKeyRepository) Create(ctx context.Context, key models.DeviceAPIKey, grace time.Duration) (models.DeviceAPIKey, error) {
+	if _, err := r.devices.Get(ctx, key.DeviceID); err != nil {
+		return models.DeviceAPIKey{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	expiry := now.Add(grace)
+	for id, k := range r.keys {
+		if k.DeviceID != key.DeviceID || !apiKeyUsable(k, now) {
+			continue
+		}
+		if grace <= 0 {
+			k.RevokedAt = &now
+		} else if k.ExpiresAt == nil || k.ExpiresAt.After(expiry) {
+			k.ExpiresAt = &expiry
+		}
+		r.keys[id] = k
+	}
+
+	key.ID = newUUID()
+	key.CreatedAt = now
+	key.ExpiresAt, key.RevokedAt, key.LastUsedAt = nil, nil, nil
+	r.keys[key.ID] = key
+	return withKeyStatus(key, now), nil
+}
+
+func (r *MemoryAPIKeyRepository) List(ctx context.Context, deviceID string) ([]models.DeviceAPIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	keys := []models.DeviceAPIKey{}
+	for _, k := range r.keys {
+		if k.DeviceID == deviceID {
+			keys = append(keys, withKeyStatus(k, now))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.After(keys[j].CreatedAt)
+		}
+		return keys[i].ID > keys[j].ID
+	})
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepository) Revoke(ctx context.Context, deviceID, keyID string) (models.DeviceAPIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.keys[keyID]
+	if !ok || k.DeviceID != deviceID {
+		return models.DeviceAPIKey{}, ErrNotFound
+	}
+	now := time.Now().UTC()
+	if k.RevokedAt == nil {
+		k.RevokedAt = &now
+		r.keys[keyID] = k
+	}
+	return withKeyStatus(k, now), nil
+}
+
+func (r *MemoryAPIKeyRepository) FindUsable(ctx context.Context, prefix string) (models.DeviceAPIKey, string, error) {
+	r.mu.RLock()
+	var (
+		key   models.DeviceAPIKey
+		found bool
+	)
+	now := time.Now()
+	for _, k := range r.keys {
+		if k.Prefix == prefix && apiKeyUsable(k, now) {
+			key, found = withKeyStatus(k, now), true
+			break
+		}
+	}
+	r.mu.RUnlock()
+	if !found {
+		return models.DeviceAPIKey{}, "", ErrNotFound
+	}
+
+	d, err := r.devices.Get(ctx, key.DeviceID)
+	if err != nil {
+		return models.DeviceAPIKey{}, "", err
+	}
+	return key, d.Name, nil
+}
+
+func (r *MemoryAPIKeyRepository) DeviceHasUsable(ctx context.Context, deviceRef string) (bool, error) {
+	r.mu.RLock()
+	var deviceIDs []string
+	now := time.Now()
+	for _, k := range r.keys {
+		if apiKeyUsable(k, now) {
+			deviceIDs = append(deviceIDs, k.DeviceID)
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, id := range deviceIDs {
+		d, err := r.devices.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if strings.EqualFold(d.ID, deviceRef) || strings.EqualFold(d.Name, deviceRef) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryAPIKeyRepository) MarkUsed(ctx context.Context, keyID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if k, ok := r.keys[keyID]; ok {
+		now := time.Now().UTC()
+		k.LastUsedAt = &now
+		r.keys[keyID] = k
+	}
+	return nil
+}
+
+func apiKeyUsable(k models.DeviceAPIKey, now time.Time) bool {
+	status := models.KeyStatus(k, now)
+	return status == models.APIKeyStatusActive || status == models.APIKeyStatusGrace
+}
+
+func withKeyStatus(k models.DeviceAPIKey, now time.Time) models.DeviceAPIKey {
+	k.Status = models.KeyStatus(k, now)
+	return k
+}
+
+// MemoryUserRepository keeps users and refresh tokens in maps. Tenants are
+// looked up in the given repository.
+type MemoryUserRepository struct {
+	mu      sync.RWMutex
+	tenants TenantRepository
+	users   map[string]models.User
+	tokens  map[string]memoryRefreshToken // by hash
+}
+
+type memoryRefreshToken struct {
+	userID    string
+	familyID  string
+	expiresAt time.Time
+	used      bool
+	revoked   bool
+}
+
+func NewMemoryUserRepository(tenants TenantRepository) *MemoryUserRepository {
+	return &MemoryUserRepository{
+		tenants: tenants,
+		users:   map[string]models.User{},
+		tokens:  map[string]memoryRefreshToken{},
+	}
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, username, passwordHash, tenantID string, roles []models.RoleGrant) (models.User, error) {
+	if _, err := r.tenants.Get(ctx, tenantID); err != nil {
+		return models.User{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Username == username {
+			return models.User{}, ErrDuplicateUsername
+		}
+	}
+	now := time.Now().UTC()
+	u := models.User{
+		ID:           newUUID(),
+		Username:     username,
+		TenantID:     tenantID,
+		PasswordHash: passwordHash,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Roles:        sortedRoles(roles),
+	}
+	r.users[u.ID] = u
+	return u, nil
+}
+
+func (r *MemoryUserRepository) Get(ctx context.Context, id string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return u, ErrNotFound
+	}
+	return u, nil
+}
+
+func (r *MemoryUserRepository) GetByUsername(ctx context.Context, username string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []models.User{}
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (r *MemoryUserRepository) Disable(ctx context.Context, id string) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return u, ErrNotFound
+	}
+	now := time.Now().UTC()
+	if u.DisabledAt == nil {
+		u.DisabledAt = &now
+	}
+	u.UpdatedAt = now
+	r.users[id] = u
+	for hash, t := range r.tokens {
+		if t.userID == id {
+			t.revoked = true
+			r.tokens[hash] = t
+		}
+	}
+	return u, nil
+}
+
+func (r *MemoryUserRepository) SetRoles(ctx context.Context, id string, roles []models.RoleGrant) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return u, ErrNotFound
+	}
+	u.Roles = sortedRoles(roles)
+	u.UpdatedAt = time.Now().UTC()
+	r.users[id] = u
+	return u, nil
+}
+
+// sortedRoles copies roles in the order the SQL repository returns them
+func sortedRoles(roles []models.RoleGrant) []models.RoleGrant {
+	sorted := append([]models.RoleGrant{}, roles...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Role != sorted[j].Role {
+			return sorted[i].Role < sorted[j].Role
+		}
+		return sorted[i].Location < sorted[j].Location
+	})
+	return sorted
+}
+
+func (r *MemoryUserRepository) CreateRefreshToken(ctx context.Context, userID, hash string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens[hash] = memoryRefreshToken{userID: userID, familyID: newUUID(), expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (r *MemoryUserRepository) RotateRefreshToken(ctx context.Context, hash, nextHash string, ttl time.Duration) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[hash]
+	if !ok || t.revoked {
+		return models.User{}, ErrNotFound
+	}
+	if t.used {
+		r.revokeFamily(t.familyID)
+		return models.User{}, ErrTokenReused
+	}
+	u := r.users[t.userID]
+	if !time.Now().Before(t.expiresAt) || u.DisabledAt != nil {
+		return models.User{}, ErrNotFound
+	}
+
+	t.used = true
+	r.tokens[hash] = t
+	r.tokens[nextHash] = memoryRefreshToken{userID: t.userID, familyID: t.familyID, expiresAt: time.Now().Add(ttl)}
+	return u, nil
+}
+
+func (r *MemoryUserRepository) RevokeRefreshFamily(ctx context.Context, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t, ok := r.tokens[hash]; ok {
+		r.revokeFamily(t.familyID)
+	}
+	return nil
+}
+
+// revokeFamily must be called with mu held
+func (r *MemoryUserRepository) revokeFamily(familyID string) {
+	for hash, t := range r.tokens {
+		if t.familyID == familyID {
+			t.revoked = true
+			r.tokens[hash] = t
+		}
+	}
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+)
+
+// MemoryCommandRepository keeps the command queue and bulk jobs in the
+// shared store; Add seeds commands directly for tests
+type MemoryCommandRepository struct {
+	*memoryStore
+}
+
+type memoryCommand struct {
+	models.Command
+	jobID string
+}
+
+func (r *MemoryCommandRepository) Add(cmd models.Command) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cmd.ID == "" {
+		cmd.ID = newUUID()
+	}
+	r.commands = append(r.commands, &memoryCommand{Command: cmd})
+}
+
+func (r *MemoryCommandRepository) Get(ctx context.Context, id string) (models.Command, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if cmd := r.command(id); cmd != nil {
+		return cmd.Command, nil
+	}
+	return models.Command{}, ErrNotFound
+}
+
+func (r *MemoryCommandRepository) RecentForDevice(ctx context.Context, deviceID string, limit int) ([]models.Command, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cmds := []models.Command{}
+	for _, cmd := range r.commands {
+		if cmd.DeviceID == deviceID {
+			cmds = append(cmds, cmd.Command)
+		}
+	}
+	sort.SliceStable(cmds, func(i, j int) bool { return cmds[i].CreatedAt.After(cmds[j].CreatedAt) })
+	if len(cmds) > limit {
+		cmds = cmds[:limit]
+	}
+	return cmds, nil
+}
+
+func (r *MemoryCommandRepository) Enqueue(ctx context.Context, cmd models.Command) (models.Command, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.devices[cmd.DeviceID]
+	if !ok {
+		return models.Command{}, ErrNotFound
+	}
+	if err := r.reserveCommandQuota(map[string]int{d.TenantID: 1}); err != nil {
+		return models.Command{}, err
+	}
+	return r.queue(cmd, d.ID, "").Command, nil
+}
+
+func (r *MemoryCommandRepository) Claim(ctx context.Context, deviceID string, limit int) ([]models.Command, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	cmds := []models.Command{}
+	for _, cmd := range r.commands {
+		if len(cmds) == limit {
+			break
+		}
+		if cmd.DeviceID != deviceID || cmd.Status != models.CommandStatusPending {
+			continue
+		}
+		cmd.Status = models.CommandStatusDispatched
+		cmd.DispatchedAt = &now
+		cmd.UpdatedAt = now
+		cmds = append(cmds, cmd.Command)
+	}
+	return cmds, nil
+}
+
+func (r *MemoryCommandRepository) Report(ctx context.Context, id string, update CommandUpdate) (models.Command, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := r.command(id)
+	if cmd == nil {
+		return models.Command{}, ErrNotFound
+	}
+	if !models.CanTransitionCommand(cmd.Status, update.Status) {
+		return cmd.Command, ErrStatusConflict
+	}
+
+	now := time.Now().UTC()
+	cmd.Status = update.Status
+	if update.Result != nil {
+		cmd.Result = update.Result
+	}
+	cmd.Error = update.Error
+	if update.Status == models.CommandStatusExecuting {
+		cmd.StartedAt = &now
+	}
+	if models.IsTerminalCommandStatus(update.Status) {
+		cmd.CompletedAt = &now
+	}
+	cmd.UpdatedAt = now
+	return cmd.Command, nil
+}
+
+func (r *MemoryCommandRepository) ExpireTimedOut(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	var n int64
+	for _, cmd := range r.commands {
+		if cmd.Status != models.CommandStatusDispatched && cmd.Status != models.CommandStatusExecuting {
+			continue
+		}
+		if cmd.DispatchedAt == nil || !cmd.DispatchedAt.Add(time.Duration(cmd.TimeoutSeconds)*time.Second).Before(now) {
+			continue
+		}
+		cmd.Status = models.CommandStatusTimedOut
+		cmd.Error = "no result within timeout"
+		cmd.CompletedAt = &now
+		cmd.UpdatedAt = now
+		n++
+	}
+	return n, nil
+}
+
+func (r *MemoryCommandRepository) CreateJob(ctx context.Context, filter models.DeviceFilter, cmd models.Command, accept func(matched int) error) (models.Execution, error) {
+	filterJSON, err := json.Marshal(filter)
+	if err != nil {
+		return models.Execution{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	targets := r.targets(filter)
+	if err := accept(len(targets)); err != nil {
+		return models.Execution{}, err
+	}
+	requested := map[string]int{}
+	for _, d := range targets {
+		requested[d.TenantID]++
+	}
+	if err := r.reserveCommandQuota(requested); err != nil {
+		return models.Execution{}, err
+	}
+
+	exec := models.Execution{
+		ID:           newUUID(),
+		CommandType:  cmd.Type,
+		Parameters:   cmd.Parameters,
+		DeviceFilter: json.RawMessage(filterJSON),
+		TotalDevices: len(targets),
+		CreatedAt:    time.Now().UTC(),
+	}
+	r.jobs[exec.ID] = exec
+
+	exec.Devices = []models.FanOutEntry{}
+	for _, d := range targets {
+		queued := r.queue(cmd, d.ID, exec.ID)
+		exec.Devices = append(exec.Devices, models.FanOutEntry{
+			DeviceID:   d.ID,
+			DeviceName: d.Name,
+			CommandID:  queued.ID,
+			Status:     queued.Status,
+		})
+	}
+	return exec, nil
+}
+
+func (r *MemoryCommandRepository) GetJob(ctx context.Context, id string) (models.Execution, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	exec, ok := r.jobs[id]
+	if !ok {
+		return exec, ErrNotFound
+	}
+	exec.Devices = []models.FanOutEntry{}
+	for _, cmd := range r.commands {
+		if cmd.jobID != id {
+			continue
+		}
+		exec.Devices = append(exec.Devices, models.FanOutEntry{
+			DeviceID:   cmd.DeviceID,
+			DeviceName: r.devices[cmd.DeviceID].Name,
+			CommandID:  cmd.ID,
+			Status:     cmd.Status,
+		})
+	}
+	sort.SliceStable(exec.Devices, func(i, j int) bool { return exec.Devices[i].DeviceName < exec.Devices[j].DeviceName })
+	return exec, nil
+}
+
+// command returns the stored command with id; mu must be held
+func (s *memoryStore) command(id string) *memoryCommand {
+	for _, cmd := range s.commands {
+		if cmd.ID == id {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// queue stores a pending copy of cmd for a device; mu must be held
+func (s *memoryStore) queue(cmd models.Command, deviceID, jobID string) *memoryCommand {
+	now := time.Now().UTC()
+	stored := &memoryCommand{
+		Command: models.Command{
+			ID:             newUUID(),
+			DeviceID:       deviceID,
+			Type:           cmd.Type,
+			Parameters:     cmd.Parameters,
+			Status:         models.CommandStatusPending,
+			TimeoutSeconds: cmd.TimeoutSeconds,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		},
+		jobID: jobID,
+	}
+	s.commands = append(s.commands, stored)
+	return stored
+}
+
+// targets returns the devices matching a bulk filter ordered by name; mu
+// must be held
+func (s *memoryStore) targets(filter models.DeviceFilter) []models.Device {
+	var devices []models.Device
+	for _, d := range s.devices {
+		if matchesTarget(d, filter) {
+			devices = append(devices, d)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	return devices
+}
+
+// reserveCommandQuota is the in-memory reserveCommandQuota; mu must be held
+func (s *memoryStore) reserveCommandQuota(requested map[string]int) error {
+	tenants := make([]string, 0, len(requested))
+	for id := range requested {
+		tenants = append(tenants, id)
+	}
+	sort.Strings(tenants)
+
+	for _, id := range tenants {
+		t, ok := s.tenants[id]
+		if !ok || t.Quotas.MaxCommandsPerHour == nil {
+			continue
+		}
+		limit := *t.Quotas.MaxCommandsPerHour
+		if used := s.commandsLastHour(id); used+requested[id] > limit {
+			return &QuotaExceededError{TenantID: id, Quota: models.QuotaCommandsPerHour,
+				Limit: limit, Used: used, Requested: requested[id]}
+		}
+	}
+	return nil
+}
+
+// commandsLastHour counts the commands queued for a tenant's devices in the
+// last hour; mu must be held
+func (s *memoryStore) commandsLastHour(tenantID string) int {
+	since := time.Now().Add(-time.Hour)
+	n := 0
+	for _, cmd := range s.commands {
+		if d, ok := s.devices[cmd.DeviceID]; ok && d.TenantID == tenantID && cmd.CreatedAt.After(since) {
+			n++
+		}
+	}
+	return n
+}
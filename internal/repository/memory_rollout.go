@@ -0,0 +1,332 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+)
+
+// MemoryRolloutRepository keeps rollouts in the shared store. Update holds
+// the store lock while fn runs and applies its changes only if fn succeeds.
+type MemoryRolloutRepository struct {
+	*memoryStore
+}
+
+// memoryRollout is a rollout without progress, and its devices without the
+// fields read from the devices themselves
+type memoryRollout struct {
+	models.Rollout
+	devices []models.RolloutDevice
+}
+
+func (r *MemoryRolloutRepository) Create(ctx context.Context, ro models.Rollout, filter models.DeviceFilter, plan func(devices int) ([]int, int, error)) (string, error) {
+	filterJSON, err := json.Marshal(filter)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enrolled := map[string]bool{}
+	for _, stored := range r.rollouts {
+		if stored.Status == models.RolloutStatusRunning || stored.Status == models.RolloutStatusPaused {
+			for _, rd := range stored.devices {
+				enrolled[rd.DeviceID] = true
+			}
+		}
+	}
+	var targets []models.Device
+	var busy []string
+	for _, d := range r.targets(filter) {
+		if d.Version == ro.TargetVersion {
+			continue
+		}
+		if enrolled[d.ID] {
+			busy = append(busy, d.Name)
+		}
+		targets = append(targets, d)
+	}
+	if len(busy) > 0 {
+		return "", &RolloutConflictError{Devices: busy}
+	}
+	waves, totalWaves, err := plan(len(targets))
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	stored := &memoryRollout{Rollout: models.Rollout{
+		ID:               newUUID(),
+		TenantID:         ro.TenantID,
+		TargetVersion:    ro.TargetVersion,
+		FirmwareURL:      ro.FirmwareURL,
+		DeviceFilter:     json.RawMessage(filterJSON),
+		CanaryPercent:    ro.CanaryPercent,
+		BatchSize:        ro.BatchSize,
+		FailureThreshold: ro.FailureThreshold,
+		TimeoutSeconds:   ro.TimeoutSeconds,
+		Status:           models.RolloutStatusRunning,
+		TotalWaves:       totalWaves,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}}
+	for i, d := range targets {
+		stored.devices = append(stored.devices, models.RolloutDevice{
+			DeviceID:  d.ID,
+			Wave:      waves[i],
+			Status:    models.RolloutDevicePending,
+			UpdatedAt: now,
+		})
+	}
+	r.rollouts[stored.ID] = stored
+	return stored.ID, nil
+}
+
+func (r *MemoryRolloutRepository) Get(ctx context.Context, id string) (models.Rollout, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored, ok := r.rollouts[id]
+	if !ok {
+		return models.Rollout{}, ErrNotFound
+	}
+	ro := withProgress(stored)
+	ro.Devices = []models.RolloutDevice{}
+	for _, rd := range stored.devices {
+		d := r.devices[rd.DeviceID]
+		rd.DeviceName, rd.CurrentVersion = d.Name, d.Version
+		ro.Devices = append(ro.Devices, rd)
+	}
+	sort.Slice(ro.Devices, func(i, j int) bool {
+		if ro.Devices[i].Wave != ro.Devices[j].Wave {
+			return ro.Devices[i].Wave < ro.Devices[j].Wave
+		}
+		return ro.Devices[i].DeviceName < ro.Devices[j].DeviceName
+	})
+	return ro, nil
+}
+
+func (r *MemoryRolloutRepository) List(ctx context.Context, tenant string, limit int) ([]models.Rollout, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rollouts := []models.Rollout{}
+	for _, stored := range r.rollouts {
+		if stored.TenantID != tenant {
+			continue
+		}
+		rollouts = append(rollouts, withProgress(stored))
+	}
+	sort.Slice(rollouts, func(i, j int) bool { return rollouts[i].CreatedAt.After(rollouts[j].CreatedAt) })
+	if len(rollouts) > limit {
+		rollouts = rollouts[:limit]
+	}
+	return rollouts, nil
+}
+
+func (r *MemoryRolloutRepository) Running(ctx context.Context) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ids []string
+	for id, stored := range r.rollouts {
+		if stored.Status == models.RolloutStatusRunning {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *MemoryRolloutRepository) SyncDevices(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, stored := range r.rollouts {
+		for i := range stored.devices {
+			rd := &stored.devices[i]
+			if rd.Status != models.RolloutDeviceInProgress {
+				continue
+			}
+			d := r.devices[rd.DeviceID]
+			cmd := r.command(rd.CommandID)
+
+			// Versions confirmed in the command result
+			if cmd != nil && cmd.Status == models.CommandStatusSucceeded &&
+				resultVersion(cmd.Result) == stored.TargetVersion && d.Version != stored.TargetVersion {
+				d.Version = stored.TargetVersion
+				d.UpdatedAt = now
+				d.Revision++
+				r.devices[d.ID] = d
+			}
+
+			switch {
+			case d.Version == stored.TargetVersion:
+				rd.Status, rd.Error = models.RolloutDeviceSucceeded, ""
+			case cmd == nil:
+				rd.Status, rd.Error = models.RolloutDeviceFailed, "command removed"
+			case cmd.Status == models.CommandStatusFailed || cmd.Status == models.CommandStatusTimedOut:
+				rd.Status, rd.Error = models.RolloutDeviceFailed, cmd.Error
+				if rd.Error == "" {
+					rd.Error = "command " + cmd.Status
+				}
+			case cmd.Status == models.CommandStatusSucceeded && cmd.CompletedAt != nil &&
+				cmd.CompletedAt.Add(time.Duration(cmd.TimeoutSeconds)*time.Second).Before(now):
+				// The agent finished but never reported the new version
+				rd.Status, rd.Error = models.RolloutDeviceFailed, "version not confirmed after command succeeded"
+			default:
+				continue
+			}
+			rd.UpdatedAt = now
+		}
+	}
+	return nil
+}
+
+// resultVersion is the version an agent confirmed in a command result
+func resultVersion(result json.RawMessage) string {
+	var confirmed struct {
+		Version string `json:"version"`
+	}
+	if len(result) == 0 || json.Unmarshal(result, &confirmed) != nil {
+		return ""
+	}
+	return confirmed.Version
+}
+
+func (r *MemoryRolloutRepository) Update(ctx context.Context, id string, skipLocked bool, fn func(tx RolloutTx) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.rollouts[id]
+	if !ok {
+		return ErrNotFound
+	}
+	tx := &memoryRolloutTx{
+		store: r.memoryStore,
+		rollout: memoryRollout{
+			Rollout: stored.Rollout,
+			devices: append([]models.RolloutDevice{}, stored.devices...),
+		},
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	r.rollouts[id] = &tx.rollout
+	r.commands = append(r.commands, tx.queued...)
+	return nil
+}
+
+// memoryRolloutTx stages changes on a copy of the rollout until Update
+// applies them
+type memoryRolloutTx struct {
+	store   *memoryStore
+	rollout memoryRollout
+	queued  []*memoryCommand
+}
+
+func (t *memoryRolloutTx) Rollout() models.Rollout {
+	return t.rollout.Rollout
+}
+
+func (t *memoryRolloutTx) WaveProgress(wave int) (models.RolloutProgress, error) {
+	var p models.RolloutProgress
+	for _, rd := range t.rollout.devices {
+		if rd.Wave == wave {
+			countRolloutDevice(&p, rd.Status)
+		}
+	}
+	return p, nil
+}
+
+func (t *memoryRolloutTx) SetStatus(status, reason string) error {
+	now := time.Now().UTC()
+	t.rollout.Status, t.rollout.PauseReason = status, reason
+	if status == models.RolloutStatusCompleted || status == models.RolloutStatusAborted {
+		t.rollout.CompletedAt = &now
+	}
+	t.rollout.UpdatedAt = now
+	return nil
+}
+
+func (t *memoryRolloutTx) SkipPending(reason string) error {
+	now := time.Now().UTC()
+	for i := range t.rollout.devices {
+		if rd := &t.rollout.devices[i]; rd.Status == models.RolloutDevicePending {
+			rd.Status, rd.Error, rd.UpdatedAt = models.RolloutDeviceSkipped, reason, now
+		}
+	}
+	return nil
+}
+
+func (t *memoryRolloutTx) StartWave(wave int, cmd models.Command) (int, error) {
+	requested := map[string]int{}
+	for _, rd := range t.rollout.devices {
+		if rd.Wave == wave && rd.Status == models.RolloutDevicePending {
+			requested[t.store.devices[rd.DeviceID].TenantID]++
+		}
+	}
+	if err := t.store.reserveCommandQuota(requested); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	queued := 0
+	for i := range t.rollout.devices {
+		rd := &t.rollout.devices[i]
+		if rd.Wave != wave || rd.Status != models.RolloutDevicePending {
+			continue
+		}
+		stored := &memoryCommand{Command: models.Command{
+			ID:             newUUID(),
+			DeviceID:       rd.DeviceID,
+			Type:           cmd.Type,
+			Parameters:     cmd.Parameters,
+			Status:         models.CommandStatusPending,
+			TimeoutSeconds: cmd.TimeoutSeconds,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}}
+		t.queued = append(t.queued, stored)
+
+		rd.Status = models.RolloutDeviceInProgress
+		rd.CommandID = stored.ID
+		rd.PreviousVersion = t.store.devices[rd.DeviceID].Version
+		rd.UpdatedAt = now
+		queued++
+	}
+	t.rollout.CurrentWave = wave
+	t.rollout.UpdatedAt = now
+	return queued, nil
+}
+
+// withProgress returns the rollout with its devices counted by status
+func withProgress(stored *memoryRollout) models.Rollout {
+	ro := stored.Rollout
+	ro.Progress = models.RolloutProgress{}
+	for _, rd := range stored.devices {
+		countRolloutDevice(&ro.Progress, rd.Status)
+	}
+	return ro
+}
+
+func countRolloutDevice(p *models.RolloutProgress, status string) {
+	p.Total++
+	switch status {
+	case models.RolloutDevicePending:
+		p.Pending++
+	case models.RolloutDeviceInProgress:
+		p.InProgress++
+	case models.RolloutDeviceSucceeded:
+		p.Succeeded++
+	case models.RolloutDeviceFailed:
+		p.Failed++
+	case models.RolloutDeviceSkipped:
+		p.Skipped++
+	}
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+)
+
+// MemoryTenantRepository keeps tenants in the shared store, starting with
+// the default tenant
+type MemoryTenantRepository struct {
+	*memoryStore
+}
+
+func (r *MemoryTenantRepository) List(ctx context.Context) ([]models.Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenants := []models.Tenant{}
+	for _, t := range r.tenants {
+		tenants = append(tenants, r.withUsage(t))
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants, nil
+}
+
+func (r *MemoryTenantRepository) Get(ctx context.Context, id string) (models.Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.tenants[id]
+	if !ok {
+		return t, ErrTenantNotFound
+	}
+	return r.withUsage(t), nil
+}
+
+func (r *MemoryTenantRepository) Create(ctx context.Context, id, name string, quotas models.TenantQuotas) (models.Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tenants[id]; ok {
+		return models.Tenant{}, ErrDuplicateTenant
+	}
+	now := time.Now().UTC()
+	t := models.Tenant{ID: id, Name: name, Quotas: copyQuotas(quotas), CreatedAt: now, UpdatedAt: now}
+	r.tenants[id] = t
+	return r.withUsage(t), nil
+}
+
+func (r *MemoryTenantRepository) Update(ctx context.Context, id, name string, quotas models.TenantQuotas) (models.Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tenants[id]
+	if !ok {
+		return t, ErrTenantNotFound
+	}
+	if name != "" {
+		t.Name = name
+	}
+	t.Quotas = copyQuotas(quotas)
+	t.UpdatedAt = time.Now().UTC()
+	r.tenants[id] = t
+	return r.withUsage(t), nil
+}
+
+// withUsage fills in the tenant's current usage; mu must be held
+func (s *memoryStore) withUsage(t models.Tenant) models.Tenant {
+	t.Usage = models.TenantUsage{
+		Devices:          s.tenantDevices(t.ID),
+		CommandsLastHour: s.commandsLastHour(t.ID),
+		AlertsLastHour:   s.alertsLastHour(t.ID, ""),
+	}
+	return t
+}
+
+// copyQuotas keeps callers from changing stored quotas through the pointers
+func copyQuotas(q models.TenantQuotas) models.TenantQuotas {
+	clone := func(v *int) *int {
+		if v == nil {
+			return nil
+		}
+		n := *v
+		return &n
+	}
+	return models.TenantQuotas{
+		MaxDevices:         clone(q.MaxDevices),
+		MaxCommandsPerHour: clone(q.MaxCommandsPerHour),
+		MaxAlertsPerHour:   clone(q.MaxAlertsPerHour),
+	}
+}
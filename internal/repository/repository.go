@@ -0,0 +1,361 @@
+// Package repository hides how devices, alerts, commands, tenants,
+// rollouts, agent API keys and users are stored.
+// Handlers depend on the interfaces below. The SQL implementations serve
+// Postgres and SQLite (see dialect.go); the in-memory ones let the HTTP API
+// run in tests without a database.
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"portofolionetworkapi/internal/database"
+	"portofolionetworkapi/internal/models"
+)
+
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrDuplicateName    = errors.New("device name already exists")
+	ErrRevisionMismatch = errors.New("revision does not match")
+	ErrTenantNotFound   = errors.New("tenant not found")
+	ErrDuplicateTenant  = errors.New("tenant already exists")
+	// ErrStatusConflict is returned when a record's current status does
+	// not allow the requested change
+	ErrStatusConflict = errors.New("current status does not allow the change")
+
+	ErrDuplicateUsername = errors.New("username already exists")
+	ErrTokenReused       = errors.New("refresh token already used")
+)
+
+// DeviceLimitError is returned by Create when the demo device cap is full
+type DeviceLimitError struct {
+	Count int
+}
+
+func (e *DeviceLimitError) Error() string {
+	return fmt.Sprintf("device limit reached: %d devices", e.Count)
+}
+
+func (e *DeviceLimitError) Unwrap() error {
+	return database.ErrDeviceLimitReached
+}
+
+// QuotaExceededError is returned when a request would take a tenant above
+// one of its quotas. Used is the consumption before the request.
+type QuotaExceededError struct {
+	TenantID  string
+	Quota     string
+	Limit     int
+	Used      int
+	Requested int
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("tenant %s would exceed its %s quota: %d used + %d requested > %d",
+		e.TenantID, e.Quota, e.Used, e.Requested, e.Limit)
+}
+
+// Hourly reports whether the quota is a sliding one-hour window, so the
+// request may succeed later without any other change
+func (e *QuotaExceededError) Hourly() bool {
+	return e.Quota != models.QuotaDevices
+}
+
+// RolloutConflictError is returned when devices a new rollout would cover
+// are already in a running or paused rollout. Devices holds their names.
+type RolloutConflictError struct {
+	Devices []string
+}
+
+func (e *RolloutConflictError) Error() string {
+	return fmt.Sprintf("%d device(s) already in an active rollout: %s", len(e.Devices), strings.Join(e.Devices, ", "))
+}
+
+// Device sort keys accepted by DeviceRepository.List
+const (
+	SortByName      = "name"
+	SortByLastSeen  = "last_seen"
+	SortByCreatedAt = "created_at"
+)
+
+func IsValidDeviceSort(sort string) bool {
+	switch sort {
+	case SortByName, SortByLastSeen, SortByCreatedAt:
+		return true
+	}
+	return false
+}
+
+// DeviceFilter narrows a device listing; empty fields match everything.
+// Name is a case-insensitive substring, Location a case-insensitive exact
+// match and IPPrefix a literal prefix of the address. A non-nil Locations
+// keeps only devices at one of those locations (case-insensitive); an empty
+// one matches nothing.
+type DeviceFilter struct {
+	Status    string
+	Location  string
+	Locations []string
+	Name      string
+	IPPrefix  string
+	Tenant    string
+}
+
+// DeviceCursor is the (sort key, id) of the last device already returned.
+// Time is used for the timestamp sorts, where a missing value sorts as the
+// Unix epoch.
+type DeviceCursor struct {
+	Name string
+	Time time.Time
+	ID   string
+}
+
+// DeviceListOptions selects one page of devices ordered by Sort then ID,
+// both in Order (asc|desc)
+type DeviceListOptions struct {
+	DeviceFilter
+	Sort  string
+	Order string
+	Limit int
+	After *DeviceCursor
+}
+
+// Precondition is a parsed If-Match header. When Enforced, a write only
+// applies if the device revision is one of Revisions ("*" is not enforced).
+type Precondition struct {
+	Enforced  bool
+	Revisions []int64
+}
+
+func (p Precondition) Matches(revision int64) bool {
+	if !p.Enforced {
+		return true
+	}
+	for _, r := range p.Revisions {
+		if r == revision {
+			return true
+		}
+	}
+	return false
+}
+
+// DevicePatch maps field names (name, ip_address, location, status) to
+// already validated values; a nil value clears the field
+type DevicePatch map[string]*string
+
+// DeviceRepository stores the device inventory. Writes guarded by a
+// Precondition return ErrRevisionMismatch when the device exists with
+// another revision, and ErrNotFound when it does not exist.
+type DeviceRepository interface {
+	// List returns the page selected by opts and the number of devices
+	// matching the filter across all pages
+	List(ctx context.Context, opts DeviceListOptions) ([]models.Device, int, error)
+	Get(ctx context.Context, id string) (models.Device, error)
+	// Create adds a device with status unknown, enforcing the demo cap
+	// (*DeviceLimitError) and the tenant's device quota
+	// (*QuotaExceededError, ErrTenantNotFound)
+	Create(ctx context.Context, tenantID string, req models.CreateDeviceRequest) (models.Device, error)
+	Update(ctx context.Context, id string, req models.UpdateDeviceRequest, pre Precondition) (models.Device, error)
+	// Patch changes only the given fields; an empty patch returns the
+	// device unchanged
+	Patch(ctx context.Context, id string, patch DevicePatch, pre Precondition) (models.Device, error)
+	Delete(ctx context.Context, id string, pre Precondition) error
+	RecentHeartbeats(ctx context.Context, deviceID string, limit int) ([]models.Heartbeat, error)
+	// RecordHeartbeat stores an agent heartbeat and updates the device's
+	// status, version and last_seen. req.DeviceID is the device UUID or
+	// its name (case-insensitive); the resolved UUID is returned.
+	RecordHeartbeat(ctx context.Context, req models.HeartbeatRequest) (string, error)
+	// Resolve returns the device whose UUID or name (case-insensitive) is ref
+	Resolve(ctx context.Context, ref string) (models.Device, error)
+	// Match returns the device an alert refers to: the one named name
+	// (case-insensitive), otherwise one with address ip
+	Match(ctx context.Context, name, ip string) (models.Device, error)
+	// MarkStale sets online and degraded devices not seen for grace to
+	// offline and returns them. A device is returned once until
+	// MarkRecovered clears it, so several monitors never report it twice.
+	MarkStale(ctx context.Context, grace time.Duration) ([]models.Device, error)
+	// MarkRecovered clears stale devices that heartbeat again and returns them
+	MarkRecovered(ctx context.Context) ([]models.Device, error)
+}
+
+// AlertRepository stores the alerts handled by the alert orchestrator,
+// one per event ID
+type AlertRepository interface {
+	// OpenForDevice returns unresolved alerts linked to a device, newest first
+	OpenForDevice(ctx context.Context, deviceID string) ([]models.Alert, error)
+	// Raise records a.EventID as open, reopening and updating an alert
+	// already recorded for it. A zero TicketID keeps the stored ticket.
+	Raise(ctx context.Context, a models.Alert) error
+	// Resolve closes the open alert for eventID; other events are ignored
+	Resolve(ctx context.Context, eventID string, at time.Time) error
+	// CheckQuota returns *QuotaExceededError when raising eventID would
+	// take the tenant above its hourly alert quota. Re-raising an event
+	// already counted in the window is free.
+	CheckQuota(ctx context.Context, tenantID, eventID string) error
+}
+
+// CommandUpdate is a status change reported by an agent. A nil Result
+// keeps the stored one; Error replaces the stored error.
+type CommandUpdate struct {
+	Status string
+	Result json.RawMessage
+	Error  string
+}
+
+// CommandRepository stores the per-device command queue and the bulk jobs
+// fanning out to it. Enqueue and CreateJob enforce the hourly command quota
+// of the devices' tenants (*QuotaExceededError).
+type CommandRepository interface {
+	Get(ctx context.Context, id string) (models.Command, error)
+	// RecentForDevice returns the latest commands for a device UUID, newest first
+	RecentForDevice(ctx context.Context, deviceID string, limit int) ([]models.Command, error)
+	// Enqueue queues cmd for cmd.DeviceID (ErrNotFound when the device
+	// does not exist) and returns it as stored
+	Enqueue(ctx context.Context, cmd models.Command) (models.Command, error)
+	// Claim moves up to limit pending commands of a device to dispatched
+	// and returns them oldest first. Concurrent claims never hand out the
+	// same command twice.
+	Claim(ctx context.Context, deviceID string, limit int) ([]models.Command, error)
+	// Report applies update when the command may move to update.Status
+	// (models.CanTransitionCommand). Otherwise it returns the command
+	// unchanged with ErrStatusConflict.
+	Report(ctx context.Context, id string, update CommandUpdate) (models.Command, error)
+	// ExpireTimedOut marks dispatched or executing commands whose timeout
+	// has elapsed since dispatch as timed_out and returns how many
+	ExpireTimedOut(ctx context.Context) (int64, error)
+	// CreateJob stores a bulk job and queues a copy of cmd for every
+	// device matching filter, in one transaction. accept is called with
+	// the number of matched devices before anything is queued; an error
+	// from it aborts the job. The job is returned with its commands.
+	CreateJob(ctx context.Context, filter models.DeviceFilter, cmd models.Command, accept func(matched int) error) (models.Execution, error)
+	// GetJob returns a bulk job with its commands ordered by device name;
+	// devices deleted since the fan-out are left out
+	GetJob(ctx context.Context, id string) (models.Execution, error)
+}
+
+// TenantRepository stores tenants and reports their quota usage
+type TenantRepository interface {
+	// List returns every tenant ordered by ID
+	List(ctx context.Context) ([]models.Tenant, error)
+	// Get returns a tenant with its usage, or ErrTenantNotFound
+	Get(ctx context.Context, id string) (models.Tenant, error)
+	// Create adds a tenant; ErrDuplicateTenant when the ID is taken
+	Create(ctx context.Context, id, name string, quotas models.TenantQuotas) (models.Tenant, error)
+	// Update replaces the quotas, and the name unless it is empty
+	Update(ctx context.Context, id, name string, quotas models.TenantQuotas) (models.Tenant, error)
+}
+
+// RolloutRepository stores firmware rollouts and the progress of each of
+// their devices. The wave gating itself lives in the rollout service.
+type RolloutRepository interface {
+	// Create stores a running rollout of r.TenantID covering every device
+	// that matches filter and is not on r.TargetVersion. Those devices must
+	// not be in a running or paused rollout (*RolloutConflictError). plan
+	// gets their number and returns each one's wave, in name order, and the
+	// number of waves; an error from it aborts the rollout. Returns the new
+	// ID.
+	Create(ctx context.Context, r models.Rollout, filter models.DeviceFilter, plan func(devices int) ([]int, int, error)) (string, error)
+	// Get returns a rollout with its progress and devices
+	Get(ctx context.Context, id string) (models.Rollout, error)
+	// List returns the rollouts of a tenant newest first, with progress
+	// but no devices
+	List(ctx context.Context, tenant string, limit int) ([]models.Rollout, error)
+	// Running returns the IDs of running rollouts
+	Running(ctx context.Context) ([]string, error)
+	// SyncDevices settles in-progress devices from their commands: a
+	// device succeeds once its version matches the target, either from a
+	// heartbeat or from the version in the command result, and fails when
+	// the command fails, times out, disappears, or succeeds without the
+	// version being confirmed within the command timeout
+	SyncDevices(ctx context.Context) error
+	// Update runs fn against the locked rollout and commits its changes
+	// unless fn returns an error. With skipLocked, a rollout locked by
+	// another transaction is reported as ErrNotFound instead of waited for.
+	Update(ctx context.Context, id string, skipLocked bool, fn func(tx RolloutTx) error) error
+}
+
+// RolloutTx changes the rollout locked by RolloutRepository.Update
+type RolloutTx interface {
+	// Rollout returns the rollout, without progress or devices, as changed
+	// so far in the transaction
+	Rollout() models.Rollout
+	// WaveProgress counts the devices of a wave by status
+	WaveProgress(wave int) (models.RolloutProgress, error)
+	// SetStatus changes the status and pause reason (cleared when empty);
+	// completed and aborted also set completed_at
+	SetStatus(status, reason string) error
+	// SkipPending marks the devices of waves that never started skipped
+	SkipPending(reason string) error
+	// StartWave queues a copy of cmd for every pending device of wave,
+	// marks them in progress and makes wave the current one. Returns the
+	// number of devices queued, or *QuotaExceededError without queuing any
+	// when the commands would exceed a tenant's hourly command quota.
+	StartWave(wave int, cmd models.Command) (int, error)
+}
+
+// APIKeyRepository stores per-device agent keys by hash. A key is usable
+// until it is revoked or its expiry passes; keys with no expiry never
+// expire on their own.
+type APIKeyRepository interface {
+	// Create stores key for key.DeviceID (ErrNotFound when the device does
+	// not exist). The device's other usable keys then expire after grace,
+	// or are revoked at once when grace is not positive.
+	Create(ctx context.Context, key models.DeviceAPIKey, grace time.Duration) (models.DeviceAPIKey, error)
+	// List returns every key of a device, newest first
+	List(ctx context.Context, deviceID string) ([]models.DeviceAPIKey, error)
+	// Revoke revokes one key of a device and returns it; revoking twice
+	// keeps the first revocation time
+	Revoke(ctx context.Context, deviceID, keyID string) (models.DeviceAPIKey, error)
+	// FindUsable returns the usable key with prefix and the name of its
+	// device, or ErrNotFound
+	FindUsable(ctx context.Context, prefix string) (models.DeviceAPIKey, string, error)
+	// MarkUsed sets the key's last_used_at to now
+	MarkUsed(ctx context.Context, keyID string) error
+	// DeviceHasUsable reports whether the device ref (UUID or name, not
+	// case-sensitive) has at least one usable key
+	DeviceHasUsable(ctx context.Context, deviceRef string) (bool, error)
+}
+
+// UserRepository stores dashboard users and their refresh tokens. Refresh
+// tokens are stored by hash and grouped in families: each login opens a
+// family and each refresh replaces the family's current token.
+type UserRepository interface {
+	// Create adds a user of tenantID with roles; ErrDuplicateUsername when
+	// the name is taken and ErrTenantNotFound when the tenant does not
+	// exist. Users are returned with their roles.
+	Create(ctx context.Context, username, passwordHash, tenantID string, roles []models.RoleGrant) (models.User, error)
+	Get(ctx context.Context, id string) (models.User, error)
+	// GetByUsername also returns disabled users
+	GetByUsername(ctx context.Context, username string) (models.User, error)
+	// List returns every user ordered by username
+	List(ctx context.Context) ([]models.User, error)
+	// Disable marks the user disabled and revokes their refresh tokens
+	Disable(ctx context.Context, id string) (models.User, error)
+	// SetRoles replaces the user's roles
+	SetRoles(ctx context.Context, id string, roles []models.RoleGrant) (models.User, error)
+
+	// CreateRefreshToken opens a new family with a token expiring after ttl
+	CreateRefreshToken(ctx context.Context, userID, hash string, ttl time.Duration) error
+	// RotateRefreshToken marks the token used, stores nextHash in its
+	// family and returns the token's user. A token that was already used
+	// revokes its whole family and returns ErrTokenReused; unknown, expired
+	// and revoked tokens, and tokens of disabled users, return ErrNotFound.
+	RotateRefreshToken(ctx context.Context, hash, nextHash string, ttl time.Duration) (models.User, error)
+	// RevokeRefreshFamily revokes the family of the token; unknown tokens
+	// are ignored
+	RevokeRefreshFamily(ctx context.Context, hash string) error
+}
+
+// Repositories bundles one implementation of each repository
+type Repositories struct {
+	Devices  DeviceRepository
+	Alerts   AlertRepository
+	Commands CommandRepository
+	Tenants  TenantRepository
+	Rollouts RolloutRepository
+	APIKeys  APIKeyRepository
+	Users    UserRepository
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"portofolionetworkapi/internal/database"
+)
+
+// New returns the repositories for a database opened with database.Open
+func New(driver string, db *sql.DB) Repositories {
+	if driver == database.DriverSQLite {
+		return NewSQLite(db)
+	}
+	return NewPostgres(db)
+}
+
+// NewPostgres returns the Postgres-backed repositories sharing one pool
+func NewPostgres(db *sql.DB) Repositories {
+	return Repositories{
+		Devices:  NewPostgresDeviceRepository(db),
+		Alerts:   NewPostgresAlertRepository(db),
+		Commands: NewPostgresCommandRepository(db),
+		Tenants:  NewPostgresTenantRepository(db),
+		Rollouts: NewPostgresRolloutRepository(db),
+		APIKeys:  NewPostgresAPIKeyRepository(db),
+		Users:    NewPostgresUserRepository(db),
+	}
+}
+
+// NewSQLite returns the repositories backed by a database opened with
+// database.OpenSQLite
+func NewSQLite(db *sql.DB) Repositories {
+	return Repositories{
+		Devices:  NewSQLiteDeviceRepository(db),
+		Alerts:   NewSQLiteAlertRepository(db),
+		Commands: NewSQLiteCommandRepository(db),
+		Tenants:  NewSQLiteTenantRepository(db),
+		Rollouts: NewSQLiteRolloutRepository(db),
+		APIKeys:  NewSQLiteAPIKeyRepository(db),
+		Users:    NewSQLiteUserRepository(db),
+	}
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// nullIfEmpty binds an empty string as NULL, for columns such as UUIDs
+// where Postgres rejects an empty value
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// placeholders appends values to args and returns their placeholders,
+// comma-separated, for an IN list
+func placeholders(args *[]interface{}, values ...string) string {
+	list := make([]string, len(values))
+	for i, v := range values {
+		*args = append(*args, v)
+		list[i] = fmt.Sprintf("$%d", len(*args))
+	}
+	return strings.Join(list, ", ")
+}
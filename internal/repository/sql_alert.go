@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+)
+
+// SQLAlertRepository stores alerts in the alerts table of Postgres or SQLite
+type SQLAlertRepository struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func NewPostgresAlertRepository(db *sql.DB) *SQLAlertRepository {
+	return &SQLAlertRepository{db: db, dialect: postgresDialect}
+}
+
+func NewSQLiteAlertRepository(db *sql.DB) *SQLAlertRepository {
+	return &SQLAlertRepository{db: db, dialect: sqliteDialect}
+}
+
+func (r *SQLAlertRepository) OpenForDevice(ctx context.Context, deviceID string) ([]models.Alert, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, event_id, COALESCE(CAST(device_id AS TEXT), ''), tenant_id, device_name, COALESCE(ip_address, ''),
+			COALESCE(severity, ''), COALESCE(problem, ''), status, COALESCE(ticket_id, 0),
+			COALESCE(customers_affected, 0), COALESCE(sla_status, ''), opened_at, resolved_at
+		FROM alerts
+		WHERE device_id = $1 AND status = 'open'
+		ORDER BY opened_at DESC, id DESC
+	`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []models.Alert{}
+	for rows.Next() {
+		var (
+			a          models.Alert
+			resolvedAt sql.NullTime
+		)
+		if err := rows.Scan(&a.ID, &a.EventID, &a.DeviceID, &a.TenantID, &a.DeviceName, &a.IPAddress,
+			&a.Severity, &a.Problem, &a.Status, &a.TicketID, &a.CustomersAffected,
+			&a.SLAStatus, &a.OpenedAt, &resolvedAt); err != nil {
+			return nil, err
+		}
+		a.ResolvedAt = nullTimePtr(resolvedAt)
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+func (r *SQLAlertRepository) Raise(ctx context.Context, a models.Alert) error {
+	now := r.dialect.now
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO alerts (event_id, device_id, tenant_id, device_name, ip_address, severity, problem,
+			ticket_id, customers_affected, sla_status, opened_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9, $10, $11)
+		ON CONFLICT (event_id) DO UPDATE SET
+			status='open', resolved_at=NULL, severity=EXCLUDED.severity, problem=EXCLUDED.problem,
+			ticket_id=COALESCE(EXCLUDED.ticket_id, alerts.ticket_id),
+			customers_affected=EXCLUDED.customers_affected, sla_status=EXCLUDED.sla_status,
+			last_raised_at=`+now+`, updated_at=`+now,
+		a.EventID, nullIfEmpty(a.DeviceID), a.TenantID, a.DeviceName, a.IPAddress, a.Severity,
+		a.Problem, a.TicketID, a.CustomersAffected, a.SLAStatus, r.dialect.timeArg(a.OpenedAt))
+	return err
+}
+
+func (r *SQLAlertRepository) Resolve(ctx context.Context, eventID string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE alerts SET status='resolved', resolved_at=$2, updated_at=`+r.dialect.now+`
+		WHERE event_id=$1 AND status='open'
+	`, eventID, r.dialect.timeArg(at))
+	return err
+}
+
+func (r *SQLAlertRepository) CheckQuota(ctx context.Context, tenantID, eventID string) error {
+	var (
+		limit sql.NullInt64
+		used  int
+	)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT t.max_alerts_per_hour,
+			(SELECT COUNT(*) FROM alerts a
+			 WHERE a.tenant_id = t.id AND a.last_raised_at > `+r.dialect.secondsFromNow("-3600")+`
+			   AND a.event_id <> $2)
+		FROM tenants t WHERE t.id = $1
+	`, tenantID, eventID).Scan(&limit, &used)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTenantNotFound
+	}
+	if err != nil || !limit.Valid || used+1 <= int(limit.Int64) {
+		return err
+	}
+	return &QuotaExceededError{TenantID: tenantID, Quota: models.QuotaAlertsPerHour,
+		Limit: int(limit.Int64), Used: used, Requested: 1}
+}
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+)
+
+// SQLAPIKeyRepository implements APIKeyRepository on Postgres or SQLite.
+// Expiry is compared with the database clock, like the staleness monitor.
+// IDs must be valid UUIDs; Postgres rejects anything else.
+type SQLAPIKeyRepository struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func NewPostgresAPIKeyRepository(db *sql.DB) *SQLAPIKeyRepository {
+	return &SQLAPIKeyRepository{db: db, dialect: postgresDialect}
+}
+
+func NewSQLiteAPIKeyRepository(db *sql.DB) *SQLAPIKeyRepository {
+	return &SQLAPIKeyRepository{db: db, dialect: sqliteDialect}
+}
+
+// columns selects a key from device_api_keys aliased as k, with its
+// status derived at query time
+func (r *SQLAPIKeyRepository) columns() string {
+	return `k.id, k.device_id, k.prefix, k.key_hash, k.created_at,
+		k.expires_at, k.revoked_at, k.last_used_at,
+		CASE
+			WHEN k.revoked_at IS NOT NULL THEN 'revoked'
+			WHEN k.expires_at IS NULL THEN 'active'
+			WHEN k.expires_at > ` + r.dialect.now + ` THEN 'grace'
+			ELSE 'expired'
+		END`
+}
+
+// usable matches keys of k that are neither revoked nor expired
+func (r *SQLAPIKeyRepository) usable() string {
+	return `k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > ` + r.dialect.now + `)`
+}
+
+func (r *SQLAPIKeyRepository) Create(ctx context.Context, key models.DeviceAPIKey, grace time.Duration) (models.DeviceAPIKey, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.DeviceAPIKey{}, err
+	}
+	defer tx.Rollback()
+
+	var n int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM devices WHERE id = $1`, key.DeviceID).Scan(&n)
+	if err != nil {
+		return models.DeviceAPIKey{}, err
+	}
+	if n == 0 {
+		return models.DeviceAPIKey{}, ErrNotFound
+	}
+
+	// Shorten, never extend, the expiry of keys already in grace
+	if grace > 0 {
+		expiry := r.dialect.secondsFromNow("$2")
+		_, err = tx.ExecContext(ctx, `
+			UPDATE device_api_keys AS k
+			SET expires_at = CASE
+				WHEN k.expires_at IS NULL OR k.expires_at > `+expiry+` THEN `+expiry+`
+				ELSE k.expires_at END
+			WHERE k.device_id = $1 AND `+r.usable(),
+			key.DeviceID, grace.Seconds())
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE device_api_keys AS k SET revoked_at = `+r.dialect.now+`
+			WHERE k.device_id = $1 AND `+r.usable(),
+			key.DeviceID)
+	}
+	if err != nil {
+		return models.DeviceAPIKey{}, err
+	}
+
+	var id string
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO device_api_keys (device_id, prefix, key_hash)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, key.DeviceID, key.Prefix, key.Hash).Scan(&id)
+	if err != nil {
+		return models.DeviceAPIKey{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.DeviceAPIKey{}, err
+	}
+	return r.get(ctx, key.DeviceID, id)
+}
+
+func (r *SQLAPIKeyRepository) get(ctx context.Context, deviceID, keyID string) (models.DeviceAPIKey, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+r.columns()+`
+		FROM device_api_keys k
+		WHERE k.device_id = $1 AND k.id = $2
+	`, deviceID, keyID)
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, ErrNotFound
+	}
+	return key, err
+}
+
+func (r *SQLAPIKeyRepository) List(ctx context.Context, deviceID string) ([]models.DeviceAPIKey, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+r.columns()+`
+		FROM device_api_keys k
+		WHERE k.device_id = $1
+		ORDER BY k.created_at DESC, k.id DESC
+	`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.DeviceAPIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *SQLAPIKeyRepository) Revoke(ctx context.Context, deviceID, keyID string) (models.DeviceAPIKey, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE device_api_keys SET revoked_at = COALESCE(revoked_at, `+r.dialect.now+`)
+		WHERE device_id = $1 AND id = $2
+	`, deviceID, keyID)
+	if err != nil {
+		return models.DeviceAPIKey{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return models.DeviceAPIKey{}, err
+	} else if n == 0 {
+		return models.DeviceAPIKey{}, ErrNotFound
+	}
+	return r.get(ctx, deviceID, keyID)
+}
+
+func (r *SQLAPIKeyRepository) FindUsable(ctx context.Context, prefix string) (models.DeviceAPIKey, string, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+r.columns()+`, d.name
+		FROM device_api_keys k
+		JOIN devices d ON d.id = k.device_id
+		WHERE k.prefix = $1 AND `+r.usable(),
+		prefix)
+	var name string
+	key, err := scanAPIKey(row, &name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, "", ErrNotFound
+	}
+	return key, name, err
+}
+
+func (r *SQLAPIKeyRepository) MarkUsed(ctx context.Context, keyID string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE device_api_keys SET last_used_at = `+r.dialect.now+`
+		WHERE id = $1
+	`, keyID)
+	return err
+}
+
+func (r *SQLAPIKeyRepository) DeviceHasUsable(ctx context.Context, deviceRef string) (bool, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM device_api_keys k
+		JOIN devices d ON d.id = k.device_id
+		WHERE (CAST(d.id AS TEXT) = $1 OR LOWER(d.name) = LOWER($1)) AND `+r.usable(),
+		deviceRef).Scan(&n)
+	return n > 0, err
+}
+
+// scanAPIKey scans the columns selected by columns(), then extra
+func scanAPIKey(row rowScanner, extra ...interface{}) (models.DeviceAPIKey, error) {
+	var (
+		k                          models.DeviceAPIKey
+		created                    sql.NullTime
+		expires, revoked, lastUsed sql.NullTime
+	)
+	dest := []interface{}{&k.ID, &k.DeviceID, &k.Prefix, &k.Hash, &created,
+		&expires, &revoked, &lastUsed, &k.Status}
+	err := row.Scan(append(dest, extra...)...)
+	k.CreatedAt = created.Time
+	k.ExpiresAt = nullTimePtr(expires)
+	k.RevokedAt = nullTimePtr(revoked)
+	k.LastUsedAt = nullTimePtr(lastUsed)
+	return k, err
+}
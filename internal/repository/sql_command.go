@@ -0,0 +1,365 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"portofolionetworkapi/internal/models"
+)
+
+// commandColumns is the select list scanCommand expects
+const commandColumns = `id, device_id, type, parameters, status, result, COALESCE(error, ''),
+	timeout_seconds, created_at, dispatched_at, started_at, completed_at, updated_at`
+
+// SQLCommandRepository stores the command queue and bulk jobs in Postgres
+// or SQLite
+type SQLCommandRepository struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func NewPostgresCommandRepository(db *sql.DB) *SQLCommandRepository {
+	return &SQLCommandRepository{db: db, dialect: postgresDialect}
+}
+
+func NewSQLiteCommandRepository(db *sql.DB) *SQLCommandRepository {
+	return &SQLCommandRepository{db: db, dialect: sqliteDialect}
+}
+
+func (r *SQLCommandRepository) Get(ctx context.Context, id string) (models.Command, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+commandColumns+` FROM commands WHERE id = $1`, id)
+	cmd, err := scanCommand(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cmd, ErrNotFound
+	}
+	return cmd, err
+}
+
+func (r *SQLCommandRepository) RecentForDevice(ctx context.Context, deviceID string, limit int) ([]models.Command, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+commandColumns+` FROM commands
+		WHERE device_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, deviceID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanCommands(rows)
+}
+
+func (r *SQLCommandRepository) Enqueue(ctx context.Context, cmd models.Command) (models.Command, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Command{}, err
+	}
+	defer tx.Rollback()
+
+	var tenantID string
+	err = tx.QueryRowContext(ctx, `SELECT tenant_id FROM devices WHERE id = $1`+r.dialect.forUpdate, cmd.DeviceID).Scan(&tenantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Command{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Command{}, err
+	}
+	if err := reserveCommandQuota(ctx, tx, r.dialect, map[string]int{tenantID: 1}); err != nil {
+		return models.Command{}, err
+	}
+
+	stored, err := scanCommand(tx.QueryRowContext(ctx, `
+		INSERT INTO commands (device_id, type, parameters, timeout_seconds)
+		VALUES ($1, $2, `+r.dialect.jsonArg("$3")+`, $4)
+		RETURNING `+commandColumns,
+		cmd.DeviceID, cmd.Type, string(cmd.Parameters), cmd.TimeoutSeconds))
+	if err != nil {
+		return stored, err
+	}
+	return stored, tx.Commit()
+}
+
+func (r *SQLCommandRepository) Claim(ctx context.Context, deviceID string, limit int) ([]models.Command, error) {
+	now := r.dialect.now
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE commands SET status='dispatched', dispatched_at=`+now+`, updated_at=`+now+`
+		WHERE id IN (
+			SELECT id FROM commands
+			WHERE device_id = $1 AND status = 'pending'
+			ORDER BY created_at
+			LIMIT $2`+r.dialect.skipLocked+`
+		)
+		RETURNING `+commandColumns,
+		deviceID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cmds, err := scanCommands(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].CreatedAt.Before(cmds[j].CreatedAt) })
+	return cmds, nil
+}
+
+func (r *SQLCommandRepository) Report(ctx context.Context, id string, update CommandUpdate) (models.Command, error) {
+	from := models.CommandSourceStatuses(update.Status)
+	if len(from) == 0 {
+		return r.conflict(ctx, id)
+	}
+
+	var result interface{}
+	if update.Result != nil {
+		result = string(update.Result)
+	}
+	now := r.dialect.now
+	args := []interface{}{id, update.Status, result, update.Error,
+		update.Status == models.CommandStatusExecuting, models.IsTerminalCommandStatus(update.Status)}
+	in := placeholders(&args, from...)
+
+	cmd, err := scanCommand(r.db.QueryRowContext(ctx, `
+		UPDATE commands SET
+			status = $2,
+			result = COALESCE(`+r.dialect.jsonArg("$3")+`, result),
+			error = NULLIF($4, ''),
+			started_at = CASE WHEN $5 THEN `+now+` ELSE started_at END,
+			completed_at = CASE WHEN $6 THEN `+now+` ELSE completed_at END,
+			updated_at = `+now+`
+		WHERE id = $1 AND status IN (`+in+`)
+		RETURNING `+commandColumns, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return r.conflict(ctx, id)
+	}
+	return cmd, err
+}
+
+// conflict explains why Report changed nothing: the command is missing or
+// in a status the update can't follow
+func (r *SQLCommandRepository) conflict(ctx context.Context, id string) (models.Command, error) {
+	cmd, err := r.Get(ctx, id)
+	if err != nil {
+		return cmd, err
+	}
+	return cmd, ErrStatusConflict
+}
+
+func (r *SQLCommandRepository) ExpireTimedOut(ctx context.Context) (int64, error) {
+	now := r.dialect.now
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE commands SET status='timed_out', error='no result within timeout',
+			completed_at=`+now+`, updated_at=`+now+`
+		WHERE status IN ('dispatched', 'executing')
+		  AND `+r.dialect.addSeconds("dispatched_at", "timeout_seconds")+` < `+now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *SQLCommandRepository) CreateJob(ctx context.Context, filter models.DeviceFilter, cmd models.Command, accept func(matched int) error) (models.Execution, error) {
+	filterJSON, err := json.Marshal(filter)
+	if err != nil {
+		return models.Execution{}, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Execution{}, err
+	}
+	defer tx.Rollback()
+
+	// Locking the targets keeps them from being deleted before their
+	// commands are queued
+	var args []interface{}
+	where := r.dialect.targetWhere(filter, &args)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT d.id, d.name, d.tenant_id FROM devices d
+		WHERE `+where+`
+		ORDER BY d.name`+r.dialect.forUpdate, args...)
+	if err != nil {
+		return models.Execution{}, err
+	}
+	var (
+		entries   []models.FanOutEntry
+		requested = map[string]int{}
+	)
+	for rows.Next() {
+		var (
+			e      models.FanOutEntry
+			tenant string
+		)
+		if err := rows.Scan(&e.DeviceID, &e.DeviceName, &tenant); err != nil {
+			rows.Close()
+			return models.Execution{}, err
+		}
+		entries = append(entries, e)
+		requested[tenant]++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.Execution{}, err
+	}
+
+	if err := accept(len(entries)); err != nil {
+		return models.Execution{}, err
+	}
+	if err := reserveCommandQuota(ctx, tx, r.dialect, requested); err != nil {
+		return models.Execution{}, err
+	}
+
+	exec := models.Execution{
+		CommandType:  cmd.Type,
+		Parameters:   cmd.Parameters,
+		DeviceFilter: json.RawMessage(filterJSON),
+		TotalDevices: len(entries),
+		Devices:      []models.FanOutEntry{},
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO command_jobs (command_type, parameters, device_filter, total_devices)
+		VALUES ($1, `+r.dialect.jsonArg("$2")+`, `+r.dialect.jsonArg("$3")+`, $4)
+		RETURNING id, created_at
+	`, cmd.Type, string(cmd.Parameters), string(filterJSON), exec.TotalDevices).Scan(&exec.ID, &exec.CreatedAt)
+	if err != nil {
+		return models.Execution{}, err
+	}
+
+	insert, err := tx.PrepareContext(ctx, `
+		INSERT INTO commands (job_id, device_id, type, parameters, timeout_seconds)
+		VALUES ($1, $2, $3, `+r.dialect.jsonArg("$4")+`, $5)
+		RETURNING id, status
+	`)
+	if err != nil {
+		return models.Execution{}, err
+	}
+	defer insert.Close()
+	for _, e := range entries {
+		err := insert.QueryRowContext(ctx, exec.ID, e.DeviceID, cmd.Type, string(cmd.Parameters), cmd.TimeoutSeconds).
+			Scan(&e.CommandID, &e.Status)
+		if err != nil {
+			return models.Execution{}, err
+		}
+		exec.Devices = append(exec.Devices, e)
+	}
+	return exec, tx.Commit()
+}
+
+func (r *SQLCommandRepository) GetJob(ctx context.Context, id string) (models.Execution, error) {
+	var (
+		exec           models.Execution
+		params, filter []byte
+	)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, command_type, parameters, device_filter, total_devices, created_at
+		FROM command_jobs WHERE id = $1
+	`, id).Scan(&exec.ID, &exec.CommandType, &params, &filter, &exec.TotalDevices, &exec.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return exec, ErrNotFound
+	}
+	if err != nil {
+		return exec, err
+	}
+	exec.Parameters = json.RawMessage(params)
+	exec.DeviceFilter = json.RawMessage(filter)
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT c.device_id, d.name, c.id, c.status
+		FROM commands c JOIN devices d ON d.id = c.device_id
+		WHERE c.job_id = $1
+		ORDER BY d.name
+	`, id)
+	if err != nil {
+		return exec, err
+	}
+	defer rows.Close()
+
+	exec.Devices = []models.FanOutEntry{}
+	for rows.Next() {
+		var e models.FanOutEntry
+		if err := rows.Scan(&e.DeviceID, &e.DeviceName, &e.CommandID, &e.Status); err != nil {
+			return exec, err
+		}
+		exec.Devices = append(exec.Devices, e)
+	}
+	return exec, rows.Err()
+}
+
+// reserveCommandQuota runs before requested[tenant] commands are queued in
+// tx. It locks the tenants' rows, in ID order so concurrent jobs can't
+// deadlock, and rejects the transaction if any tenant would go above its
+// hourly command quota. Counting after the lock is taken sees every
+// competing transaction that already committed.
+func reserveCommandQuota(ctx context.Context, tx *sql.Tx, dialect sqlDialect, requested map[string]int) error {
+	tenants := make([]string, 0, len(requested))
+	for id := range requested {
+		tenants = append(tenants, id)
+	}
+	sort.Strings(tenants)
+
+	for _, id := range tenants {
+		var limit sql.NullInt64
+		err := tx.QueryRowContext(ctx, `SELECT max_commands_per_hour FROM tenants WHERE id = $1`+dialect.forUpdate, id).Scan(&limit)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !limit.Valid {
+			continue
+		}
+
+		var used int
+		err = tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM commands c JOIN devices d ON d.id = c.device_id
+			WHERE d.tenant_id = $1 AND c.created_at > `+dialect.secondsFromNow("-3600"), id).Scan(&used)
+		if err != nil {
+			return err
+		}
+		if used+requested[id] > int(limit.Int64) {
+			return &QuotaExceededError{TenantID: id, Quota: models.QuotaCommandsPerHour,
+				Limit: int(limit.Int64), Used: used, Requested: requested[id]}
+		}
+	}
+	return nil
+}
+
+// scanCommand reads one row selected with commandColumns
+func scanCommand(row rowScanner) (models.Command, error) {
+	var (
+		cmd                               models.Command
+		params, result                    []byte
+		dispatchedAt, startedAt, finished sql.NullTime
+	)
+	err := row.Scan(&cmd.ID, &cmd.DeviceID, &cmd.Type, &params, &cmd.Status, &result, &cmd.Error,
+		&cmd.TimeoutSeconds, &cmd.CreatedAt, &dispatchedAt, &startedAt, &finished, &cmd.UpdatedAt)
+	if err != nil {
+		return cmd, err
+	}
+
+	cmd.Parameters = json.RawMessage(params)
+	if result != nil {
+		cmd.Result = json.RawMessage(result)
+	}
+	cmd.DispatchedAt = nullTimePtr(dispatchedAt)
+	cmd.StartedAt = nullTimePtr(startedAt)
+	cmd.CompletedAt = nullTimePtr(finished)
+	return cmd, nil
+}
+
+func scanCommands(rows *sql.Rows) ([]models.Command, error) {
+	cmds := []models.Command{}
+	for rows.Next() {
+		cmd, err := scanCommand(rows)
+		if err != nil {
+			return cmds, err
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, rows.Err()
+}
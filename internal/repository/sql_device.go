@@ -0,0 +1,482 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"portofolionetworkapi/internal/database"
+	"portofolionetworkapi/internal/models"
+)
+
+const deviceColumns = `id, name, ip_address, COALESCE(location, ''), COALESCE(status, ''),
+	COALESCE(version, ''), last_seen, created_at, updated_at, revision, tenant_id`
+
+// patchableDeviceColumns are the fields DevicePatch may change
+var patchableDeviceColumns = map[string]bool{
+	"name":       true,
+	"ip_address": true,
+	"location":   true,
+	"status":     true,
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// SQLDeviceRepository stores devices in the devices table of Postgres or
+// SQLite
+type SQLDeviceRepository struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func NewPostgresDeviceRepository(db *sql.DB) *SQLDeviceRepository {
+	return &SQLDeviceRepository{db: db, dialect: postgresDialect}
+}
+
+func NewSQLiteDeviceRepository(db *sql.DB) *SQLDeviceRepository {
+	return &SQLDeviceRepository{db: db, dialect: sqliteDialect}
+}
+
+// sortColumn is the ORDER BY expression for a sort key. NULL timestamps
+// sort as the epoch so keyset comparisons stay well-defined; the
+// expressions match the indexes in the migrations.
+func (r *SQLDeviceRepository) sortColumn(sortBy string) (string, bool) {
+	switch sortBy {
+	case SortByName:
+		return "name", true
+	case SortByLastSeen:
+		return "COALESCE(last_seen, " + r.dialect.epoch + ")", true
+	case SortByCreatedAt:
+		return "COALESCE(created_at, " + r.dialect.epoch + ")", true
+	}
+	return "", false
+}
+
+func (r *SQLDeviceRepository) List(ctx context.Context, opts DeviceListOptions) ([]models.Device, int, error) {
+	col, ok := r.sortColumn(opts.Sort)
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown device sort %q", opts.Sort)
+	}
+
+	var filterArgs []interface{}
+	where := r.where(opts.DeviceFilter, &filterArgs)
+
+	var total int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM devices WHERE `+where, filterArgs...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	dir := "ASC"
+	op := ">"
+	if opts.Order == "desc" {
+		dir, op = "DESC", "<"
+	}
+
+	args := append([]interface{}{}, filterArgs...)
+	after := ""
+	if cur := opts.After; cur != nil {
+		value := r.dialect.timeArg(cur.Time)
+		if opts.Sort == SortByName {
+			value = cur.Name
+		}
+		args = append(args, value, cur.ID)
+		after = fmt.Sprintf(" AND (%s, id) %s ($%d, $%d)", col, op, len(args)-1, len(args))
+	}
+	args = append(args, opts.Limit)
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM devices
+		WHERE %s%s
+		ORDER BY %s %s, id %s
+		LIMIT $%d
+	`, deviceColumns, where, after, col, dir, dir, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return devices, total, nil
+}
+
+// where builds the filter clause shared by the page and count queries
+func (r *SQLDeviceRepository) where(f DeviceFilter, args *[]interface{}) string {
+	conds := []string{"1=1"}
+	add := func(cond string, v interface{}) {
+		*args = append(*args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(*args)))
+	}
+
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if f.Location != "" {
+		add("LOWER(location) = LOWER($%d)", f.Location)
+	}
+	if f.Locations != nil {
+		in := []string{}
+		for _, loc := range f.Locations {
+			*args = append(*args, loc)
+			in = append(in, fmt.Sprintf("LOWER($%d)", len(*args)))
+		}
+		if len(in) == 0 {
+			conds = append(conds, "1=0")
+		} else {
+			conds = append(conds, "LOWER(location) IN ("+strings.Join(in, ", ")+")")
+		}
+	}
+	if f.Name != "" {
+		add("name "+r.dialect.ilike+` $%d ESCAPE '\'`, "%"+escapeLike(f.Name)+"%")
+	}
+	if f.IPPrefix != "" {
+		add(`ip_address LIKE $%d ESCAPE '\'`, escapeLike(f.IPPrefix)+"%")
+	}
+	if f.Tenant != "" {
+		add("tenant_id = $%d", f.Tenant)
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func (r *SQLDeviceRepository) Get(ctx context.Context, id string) (models.Device, error) {
+	d, err := scanDevice(r.db.QueryRowContext(ctx, `SELECT `+deviceColumns+` FROM devices WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, ErrNotFound
+	}
+	return d, err
+}
+
+func (r *SQLDeviceRepository) Create(ctx context.Context, tenantID string, req models.CreateDeviceRequest) (models.Device, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Device{}, err
+	}
+	defer tx.Rollback()
+
+	count, err := r.dialect.reserveDeviceSlot(tx)
+	if errors.Is(err, database.ErrDeviceLimitReached) {
+		return models.Device{}, &DeviceLimitError{Count: count}
+	}
+	if err != nil {
+		return models.Device{}, err
+	}
+	if err := r.reserveTenantDeviceSlot(tx, tenantID); err != nil {
+		return models.Device{}, err
+	}
+
+	d, err := scanDevice(tx.QueryRowContext(ctx, `
+		INSERT INTO devices (name, ip_address, location, status, tenant_id)
+		VALUES ($1, $2, $3, 'unknown', $4)
+		RETURNING `+deviceColumns,
+		req.Name, req.IPAddress, req.Location, tenantID))
+	if err != nil {
+		return d, r.writeError(err)
+	}
+	return d, tx.Commit()
+}
+
+// reserveTenantDeviceSlot locks the tenant row and checks its device quota.
+// It runs in the same transaction as the INSERT so concurrent creates for
+// one tenant are serialized.
+func (r *SQLDeviceRepository) reserveTenantDeviceSlot(tx *sql.Tx, tenantID string) error {
+	var limit sql.NullInt64
+	err := tx.QueryRow(`SELECT max_devices FROM tenants WHERE id = $1`+r.dialect.forUpdate, tenantID).Scan(&limit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTenantNotFound
+	}
+	if err != nil || !limit.Valid {
+		return err
+	}
+
+	var used int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM devices WHERE tenant_id = $1`, tenantID).Scan(&used); err != nil {
+		return err
+	}
+	if used+1 > int(limit.Int64) {
+		return &QuotaExceededError{TenantID: tenantID, Quota: models.QuotaDevices,
+			Limit: int(limit.Int64), Used: used, Requested: 1}
+	}
+	return nil
+}
+
+func (r *SQLDeviceRepository) Update(ctx context.Context, id string, req models.UpdateDeviceRequest, pre Precondition) (models.Device, error) {
+	args := []interface{}{req.Name, req.IPAddress, req.Location, req.Status, id}
+	cond := revisionCondition(pre, &args)
+
+	d, err := scanDevice(r.db.QueryRowContext(ctx, `
+		UPDATE devices SET name=$1, ip_address=$2, location=$3, status=$4,
+			updated_at=`+r.dialect.now+`, revision=revision+1
+		WHERE id=$5`+cond+`
+		RETURNING `+deviceColumns, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, r.noMatch(ctx, id, pre)
+	}
+	if err != nil {
+		return d, r.writeError(err)
+	}
+	return d, nil
+}
+
+func (r *SQLDeviceRepository) Patch(ctx context.Context, id string, patch DevicePatch, pre Precondition) (models.Device, error) {
+	// Sorted so the same patch always produces the same statement
+	fields := make([]string, 0, len(patch))
+	for field := range patch {
+		if !patchableDeviceColumns[field] {
+			return models.Device{}, fmt.Errorf("device field %q cannot be patched", field)
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var (
+		sets []string
+		args []interface{}
+	)
+	for _, field := range fields {
+		if v := patch[field]; v != nil {
+			args = append(args, *v)
+		} else {
+			args = append(args, nil)
+		}
+		sets = append(sets, fmt.Sprintf("%s=$%d", field, len(args)))
+	}
+
+	args = append(args, id)
+	where := fmt.Sprintf("id=$%d", len(args)) + revisionCondition(pre, &args)
+
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE ` + where
+	if len(sets) > 0 {
+		query = fmt.Sprintf(`UPDATE devices SET %s, updated_at=%s, revision=revision+1 WHERE %s RETURNING %s`,
+			strings.Join(sets, ", "), r.dialect.now, where, deviceColumns)
+	}
+
+	d, err := scanDevice(r.db.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, r.noMatch(ctx, id, pre)
+	}
+	if err != nil {
+		return d, r.writeError(err)
+	}
+	return d, nil
+}
+
+func (r *SQLDeviceRepository) Delete(ctx context.Context, id string, pre Precondition) error {
+	args := []interface{}{id}
+	res, err := r.db.ExecContext(ctx, "DELETE FROM devices WHERE id=$1"+revisionCondition(pre, &args), args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return r.noMatch(ctx, id, pre)
+	}
+	return nil
+}
+
+func (r *SQLDeviceRepository) RecentHeartbeats(ctx context.Context, deviceID string, limit int) ([]models.Heartbeat, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, device_id, status, COALESCE(version, ''), COALESCE(uptime, ''),
+			COALESCE(cpu_load, ''), COALESCE(free_memory, ''), received_at
+		FROM device_heartbeats
+		WHERE device_id = $1
+		ORDER BY received_at DESC, id DESC
+		LIMIT $2
+	`, deviceID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	heartbeats := []models.Heartbeat{}
+	for rows.Next() {
+		var h models.Heartbeat
+		if err := rows.Scan(&h.ID, &h.DeviceID, &h.Status, &h.Version, &h.Uptime,
+			&h.CPULoad, &h.FreeMemory, &h.ReceivedAt); err != nil {
+			return nil, err
+		}
+		heartbeats = append(heartbeats, h)
+	}
+	return heartbeats, rows.Err()
+}
+
+func (r *SQLDeviceRepository) RecordHeartbeat(ctx context.Context, req models.HeartbeatRequest) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// Agents identify themselves by UUID or by device name
+	var deviceID string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM devices
+		WHERE CAST(id AS TEXT) = $1 OR LOWER(name) = LOWER($1)
+		LIMIT 1`+r.dialect.forUpdate,
+		req.DeviceID).Scan(&deviceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Keep the previously reported version when the agent omits it. The
+	// revision only moves when status or version change, so routine
+	// heartbeats don't invalidate operators' ETags.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE devices
+		SET status=$1, version=COALESCE(NULLIF($2, ''), version), last_seen=`+r.dialect.now+`, updated_at=`+r.dialect.now+`,
+			revision = revision + CASE
+				WHEN status IS DISTINCT FROM $1 OR version IS DISTINCT FROM COALESCE(NULLIF($2, ''), version)
+				THEN 1 ELSE 0 END
+		WHERE id=$3
+	`, req.Status, req.Version, deviceID)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO device_heartbeats (device_id, status, version, uptime, cpu_load, free_memory)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''))
+	`, deviceID, req.Status, req.Version, req.Uptime, req.CPULoad, req.FreeMemory)
+	if err != nil {
+		return "", err
+	}
+
+	return deviceID, tx.Commit()
+}
+
+func (r *SQLDeviceRepository) Resolve(ctx context.Context, ref string) (models.Device, error) {
+	d, err := scanDevice(r.db.QueryRowContext(ctx, `
+		SELECT `+deviceColumns+` FROM devices
+		WHERE CAST(id AS TEXT) = $1 OR LOWER(name) = LOWER($1)
+		LIMIT 1`, ref))
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, ErrNotFound
+	}
+	return d, err
+}
+
+func (r *SQLDeviceRepository) Match(ctx context.Context, name, ip string) (models.Device, error) {
+	d, err := scanDevice(r.db.QueryRowContext(ctx, `
+		SELECT `+deviceColumns+` FROM devices
+		WHERE LOWER(name) = LOWER($1) OR ip_address = $2
+		ORDER BY (LOWER(name) = LOWER($1)) DESC
+		LIMIT 1`, name, ip))
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, ErrNotFound
+	}
+	return d, err
+}
+
+// MarkStale claims each row once in the UPDATE, so several instances can
+// run the staleness monitor without raising duplicate alerts
+func (r *SQLDeviceRepository) MarkStale(ctx context.Context, grace time.Duration) ([]models.Device, error) {
+	now := r.dialect.now
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE devices SET status='offline', stale_since=`+now+`, updated_at=`+now+`, revision=revision+1
+		WHERE stale_since IS NULL
+		  AND status IN ('online', 'degraded')
+		  AND last_seen < `+r.dialect.secondsFromNow("$1")+`
+		RETURNING `+deviceColumns, -grace.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDevices(rows)
+}
+
+func (r *SQLDeviceRepository) MarkRecovered(ctx context.Context) ([]models.Device, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE devices SET stale_since=NULL
+		WHERE stale_since IS NOT NULL AND last_seen > stale_since
+		RETURNING `+deviceColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDevices(rows)
+}
+
+// noMatch explains why a conditional write touched no rows: a stale
+// revision if the device exists, otherwise a missing device
+func (r *SQLDeviceRepository) noMatch(ctx context.Context, id string, pre Precondition) error {
+	if !pre.Enforced {
+		return ErrNotFound
+	}
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM devices WHERE id = $1`, id).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrRevisionMismatch
+	}
+	return ErrNotFound
+}
+
+// writeError maps the unique index on name to ErrDuplicateName
+func (r *SQLDeviceRepository) writeError(err error) error {
+	if r.dialect.uniqueViolation(err) {
+		return ErrDuplicateName
+	}
+	return err
+}
+
+// revisionCondition appends "AND revision IN (...)" when the precondition
+// is enforced
+func revisionCondition(pre Precondition, args *[]interface{}) string {
+	if !pre.Enforced {
+		return ""
+	}
+	if len(pre.Revisions) == 0 {
+		return " AND 1=0"
+	}
+	placeholders := make([]string, len(pre.Revisions))
+	for i, rev := range pre.Revisions {
+		*args = append(*args, rev)
+		placeholders[i] = fmt.Sprintf("$%d", len(*args))
+	}
+	return " AND revision IN (" + strings.Join(placeholders, ", ") + ")"
+}
+
+func scanDevice(row rowScanner) (models.Device, error) {
+	var (
+		d                          models.Device
+		lastSeen, created, updated sql.NullTime
+	)
+	err := row.Scan(&d.ID, &d.Name, &d.IPAddress, &d.Location, &d.Status,
+		&d.Version, &lastSeen, &created, &updated, &d.Revision, &d.TenantID)
+	d.LastSeen = lastSeen.Time
+	d.CreatedAt = created.Time
+	d.UpdatedAt = updated.Time
+	return d, err
+}
+
+func scanDevices(rows *sql.Rows) ([]models.Device, error) {
+	devices := []models.Device{}
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return devices, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// escapeLike escapes LIKE metacharacters so user input matches literally
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
@@ -0,0 +1,429 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"portofolionetworkapi/internal/models"
+)
+
+// rolloutColumns is the select list scanRollout expects, over rollouts r
+const rolloutColumns = `r.id, r.tenant_id, r.target_version, COALESCE(r.firmware_url, ''), r.device_filter,
+	r.canary_percent, r.batch_size, r.failure_threshold, r.timeout_seconds,
+	r.status, r.current_wave, r.total_waves, COALESCE(r.pause_reason, ''),
+	r.created_at, r.updated_at, r.completed_at`
+
+const rolloutSelect = `
+	SELECT ` + rolloutColumns + `,
+		COUNT(rd.device_id),
+		COUNT(rd.device_id) FILTER (WHERE rd.status = 'pending'),
+		COUNT(rd.device_id) FILTER (WHERE rd.status = 'in_progress'),
+		COUNT(rd.device_id) FILTER (WHERE rd.status = 'succeeded'),
+		COUNT(rd.device_id) FILTER (WHERE rd.status = 'failed'),
+		COUNT(rd.device_id) FILTER (WHERE rd.status = 'skipped')
+	FROM rollouts r
+	LEFT JOIN rollout_devices rd ON rd.rollout_id = r.id`
+
+// SQLRolloutRepository stores rollouts in Postgres or SQLite
+type SQLRolloutRepository struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func NewPostgresRolloutRepository(db *sql.DB) *SQLRolloutRepository {
+	return &SQLRolloutRepository{db: db, dialect: postgresDialect}
+}
+
+func NewSQLiteRolloutRepository(db *sql.DB) *SQLRolloutRepository {
+	return &SQLRolloutRepository{db: db, dialect: sqliteDialect}
+}
+
+func (r *SQLRolloutRepository) Create(ctx context.Context, ro models.Rollout, filter models.DeviceFilter, plan func(devices int) ([]int, int, error)) (string, error) {
+	filterJSON, err := json.Marshal(filter)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	args := []interface{}{ro.TargetVersion}
+	where := r.dialect.targetWhere(filter, &args)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT d.id FROM devices d
+		WHERE `+where+` AND d.version IS DISTINCT FROM $1
+		ORDER BY d.name`+r.dialect.forUpdate, args...)
+	if err != nil {
+		return "", err
+	}
+	var deviceIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return "", err
+		}
+		deviceIDs = append(deviceIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	// Checked after locking the devices, so concurrent rollouts over the
+	// same devices see each other
+	if err := r.checkNotEnrolled(ctx, tx, ro.TargetVersion, filter); err != nil {
+		return "", err
+	}
+
+	waves, totalWaves, err := plan(len(deviceIDs))
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO rollouts (tenant_id, target_version, firmware_url, device_filter, canary_percent,
+			batch_size, failure_threshold, timeout_seconds, total_waves)
+		VALUES ($1, $2, NULLIF($3, ''), `+r.dialect.jsonArg("$4")+`, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, ro.TenantID, ro.TargetVersion, ro.FirmwareURL, string(filterJSON), ro.CanaryPercent,
+		ro.BatchSize, ro.FailureThreshold, ro.TimeoutSeconds, totalWaves).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	insert, err := tx.PrepareContext(ctx, `INSERT INTO rollout_devices (rollout_id, device_id, wave) VALUES ($1, $2, $3)`)
+	if err != nil {
+		return "", err
+	}
+	defer insert.Close()
+	for i, deviceID := range deviceIDs {
+		if _, err := insert.ExecContext(ctx, id, deviceID, waves[i]); err != nil {
+			return "", err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// checkNotEnrolled returns *RolloutConflictError when devices the rollout
+// would cover are in a running or paused rollout
+func (r *SQLRolloutRepository) checkNotEnrolled(ctx context.Context, tx *sql.Tx, targetVersion string, filter models.DeviceFilter) error {
+	args := []interface{}{targetVersion, models.RolloutStatusRunning, models.RolloutStatusPaused}
+	where := r.dialect.targetWhere(filter, &args)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT d.name FROM devices d
+		WHERE `+where+` AND d.version IS DISTINCT FROM $1
+			AND EXISTS (
+				SELECT 1 FROM rollout_devices rd JOIN rollouts r ON r.id = rd.rollout_id
+				WHERE rd.device_id = d.id AND r.status IN ($2, $3)
+			)
+		ORDER BY d.name`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return &RolloutConflictError{Devices: names}
+	}
+	return nil
+}
+
+func (r *SQLRolloutRepository) Get(ctx context.Context, id string) (models.Rollout, error) {
+	ro, err := scanRollout(r.db.QueryRowContext(ctx, rolloutSelect+` WHERE r.id = $1 GROUP BY r.id`, id), true)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ro, ErrNotFound
+	}
+	if err != nil {
+		return ro, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT rd.device_id, d.name, rd.wave, rd.status, COALESCE(CAST(rd.command_id AS TEXT), ''),
+			COALESCE(rd.previous_version, ''), COALESCE(d.version, ''), COALESCE(rd.error, ''), rd.updated_at
+		FROM rollout_devices rd JOIN devices d ON d.id = rd.device_id
+		WHERE rd.rollout_id = $1
+		ORDER BY rd.wave, d.name
+	`, id)
+	if err != nil {
+		return ro, err
+	}
+	defer rows.Close()
+
+	ro.Devices = []models.RolloutDevice{}
+	for rows.Next() {
+		var d models.RolloutDevice
+		if err := rows.Scan(&d.DeviceID, &d.DeviceName, &d.Wave, &d.Status, &d.CommandID,
+			&d.PreviousVersion, &d.CurrentVersion, &d.Error, &d.UpdatedAt); err != nil {
+			return ro, err
+		}
+		ro.Devices = append(ro.Devices, d)
+	}
+	return ro, rows.Err()
+}
+
+func (r *SQLRolloutRepository) List(ctx context.Context, tenant string, limit int) ([]models.Rollout, error) {
+	rows, err := r.db.QueryContext(ctx, rolloutSelect+`
+		WHERE r.tenant_id = $1
+		GROUP BY r.id
+		ORDER BY r.created_at DESC
+		LIMIT $2
+	`, tenant, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollouts := []models.Rollout{}
+	for rows.Next() {
+		ro, err := scanRollout(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		rollouts = append(rollouts, ro)
+	}
+	return rollouts, rows.Err()
+}
+
+func (r *SQLRolloutRepository) Running(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM rollouts WHERE status='running'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *SQLRolloutRepository) SyncDevices(ctx context.Context) error {
+	now := r.dialect.now
+	// Rollout devices whose command succeeded with the target version in
+	// its result, correlated to devices
+	confirmed := `
+		FROM rollout_devices rd
+		JOIN rollouts r ON r.id = rd.rollout_id
+		JOIN commands c ON c.id = rd.command_id
+		WHERE rd.device_id = devices.id AND rd.status = 'in_progress'
+		  AND c.status = 'succeeded' AND c.result->>'version' = r.target_version
+		  AND devices.version IS DISTINCT FROM r.target_version`
+
+	statements := []string{
+		// Versions confirmed in the command result
+		`UPDATE devices SET version=(SELECT r.target_version ` + confirmed + ` LIMIT 1),
+			updated_at=` + now + `, revision=revision+1
+		WHERE EXISTS (SELECT 1 ` + confirmed + `)`,
+
+		`UPDATE rollout_devices SET status='succeeded', error=NULL, updated_at=` + now + `
+		WHERE status = 'in_progress' AND EXISTS (
+			SELECT 1 FROM rollouts r, devices d
+			WHERE r.id = rollout_devices.rollout_id AND d.id = rollout_devices.device_id
+			  AND d.version = r.target_version)`,
+
+		`UPDATE rollout_devices SET status='failed',
+			error=(SELECT COALESCE(c.error, 'command ' || c.status) FROM commands c
+				WHERE c.id = rollout_devices.command_id),
+			updated_at=` + now + `
+		WHERE status = 'in_progress'
+		  AND command_id IN (SELECT id FROM commands WHERE status IN ('failed', 'timed_out'))`,
+
+		// The agent finished but never reported the new version
+		`UPDATE rollout_devices SET status='failed',
+			error='version not confirmed after command succeeded', updated_at=` + now + `
+		WHERE status = 'in_progress'
+		  AND command_id IN (
+			SELECT id FROM commands WHERE status = 'succeeded'
+			  AND ` + r.dialect.addSeconds("completed_at", "timeout_seconds") + ` < ` + now + `)`,
+
+		`UPDATE rollout_devices SET status='failed', error='command removed', updated_at=` + now + `
+		WHERE status = 'in_progress' AND command_id IS NULL`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := r.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLRolloutRepository) Update(ctx context.Context, id string, skipLocked bool, fn func(tx RolloutTx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lock := r.dialect.forUpdate
+	if skipLocked {
+		lock = r.dialect.skipLocked
+	}
+	ro, err := scanRollout(tx.QueryRowContext(ctx, `SELECT `+rolloutColumns+` FROM rollouts r WHERE r.id = $1`+lock, id), false)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&sqlRolloutTx{ctx: ctx, tx: tx, dialect: r.dialect, rollout: ro}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlRolloutTx is the RolloutTx of SQLRolloutRepository.Update
+type sqlRolloutTx struct {
+	ctx     context.Context
+	tx      *sql.Tx
+	dialect sqlDialect
+	rollout models.Rollout
+}
+
+func (t *sqlRolloutTx) Rollout() models.Rollout {
+	return t.rollout
+}
+
+func (t *sqlRolloutTx) WaveProgress(wave int) (models.RolloutProgress, error) {
+	var p models.RolloutProgress
+	err := t.tx.QueryRowContext(t.ctx, `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE status = 'pending'),
+			COUNT(*) FILTER (WHERE status = 'in_progress'),
+			COUNT(*) FILTER (WHERE status = 'succeeded'),
+			COUNT(*) FILTER (WHERE status = 'failed'),
+			COUNT(*) FILTER (WHERE status = 'skipped')
+		FROM rollout_devices WHERE rollout_id = $1 AND wave = $2
+	`, t.rollout.ID, wave).Scan(&p.Total, &p.Pending, &p.InProgress, &p.Succeeded, &p.Failed, &p.Skipped)
+	return p, err
+}
+
+func (t *sqlRolloutTx) SetStatus(status, reason string) error {
+	now := t.dialect.now
+	finished := status == models.RolloutStatusCompleted || status == models.RolloutStatusAborted
+	_, err := t.tx.ExecContext(t.ctx, `
+		UPDATE rollouts SET status=$2, pause_reason=NULLIF($3, ''),
+			completed_at=CASE WHEN $4 THEN `+now+` ELSE completed_at END, updated_at=`+now+`
+		WHERE id=$1
+	`, t.rollout.ID, status, reason, finished)
+	if err != nil {
+		return err
+	}
+	t.rollout.Status = status
+	t.rollout.PauseReason = reason
+	return nil
+}
+
+func (t *sqlRolloutTx) SkipPending(reason string) error {
+	_, err := t.tx.ExecContext(t.ctx, `
+		UPDATE rollout_devices SET status='skipped', error=$2, updated_at=`+t.dialect.now+`
+		WHERE rollout_id=$1 AND status='pending'
+	`, t.rollout.ID, reason)
+	return err
+}
+
+func (t *sqlRolloutTx) StartWave(wave int, cmd models.Command) (int, error) {
+	rows, err := t.tx.QueryContext(t.ctx, `
+		SELECT rd.device_id, COALESCE(d.version, ''), d.tenant_id
+		FROM rollout_devices rd JOIN devices d ON d.id = rd.device_id
+		WHERE rd.rollout_id = $1 AND rd.wave = $2 AND rd.status = 'pending'
+	`, t.rollout.ID, wave)
+	if err != nil {
+		return 0, err
+	}
+	type target struct{ deviceID, version string }
+	var targets []target
+	requested := map[string]int{}
+	for rows.Next() {
+		var tg target
+		var tenantID string
+		if err := rows.Scan(&tg.deviceID, &tg.version, &tenantID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		targets = append(targets, tg)
+		requested[tenantID]++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if err := reserveCommandQuota(t.ctx, t.tx, t.dialect, requested); err != nil {
+		return 0, err
+	}
+
+	now := t.dialect.now
+	for _, tg := range targets {
+		var commandID string
+		err := t.tx.QueryRowContext(t.ctx, `
+			INSERT INTO commands (device_id, type, parameters, timeout_seconds)
+			VALUES ($1, $2, `+t.dialect.jsonArg("$3")+`, $4)
+			RETURNING id
+		`, tg.deviceID, cmd.Type, string(cmd.Parameters), cmd.TimeoutSeconds).Scan(&commandID)
+		if err != nil {
+			return 0, err
+		}
+		_, err = t.tx.ExecContext(t.ctx, `
+			UPDATE rollout_devices SET status='in_progress', command_id=$3,
+				previous_version=NULLIF($4, ''), updated_at=`+now+`
+			WHERE rollout_id=$1 AND device_id=$2
+		`, t.rollout.ID, tg.deviceID, commandID, tg.version)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := t.tx.ExecContext(t.ctx, `UPDATE rollouts SET current_wave=$2, updated_at=`+now+` WHERE id=$1`, t.rollout.ID, wave); err != nil {
+		return 0, err
+	}
+	t.rollout.CurrentWave = wave
+	return len(targets), nil
+}
+
+// scanRollout reads a row selected with rolloutColumns, followed by the
+// progress counts of rolloutSelect when withProgress is set
+func scanRollout(row rowScanner, withProgress bool) (models.Rollout, error) {
+	var (
+		r           models.Rollout
+		filter      []byte
+		completedAt sql.NullTime
+	)
+	dest := []interface{}{&r.ID, &r.TenantID, &r.TargetVersion, &r.FirmwareURL, &filter,
+		&r.CanaryPercent, &r.BatchSize, &r.FailureThreshold, &r.TimeoutSeconds,
+		&r.Status, &r.CurrentWave, &r.TotalWaves, &r.PauseReason,
+		&r.CreatedAt, &r.UpdatedAt, &completedAt}
+	if withProgress {
+		dest = append(dest, &r.Progress.Total, &r.Progress.Pending, &r.Progress.InProgress,
+			&r.Progress.Succeeded, &r.Progress.Failed, &r.Progress.Skipped)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return r, err
+	}
+	r.DeviceFilter = json.RawMessage(filter)
+	r.CompletedAt = nullTimePtr(completedAt)
+	return r, nil
+}
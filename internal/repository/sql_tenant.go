@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"portofolionetworkapi/internal/models"
+)
+
+// SQLTenantRepository stores tenants in Postgres or SQLite
+type SQLTenantRepository struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func NewPostgresTenantRepository(db *sql.DB) *SQLTenantRepository {
+	return &SQLTenantRepository{db: db, dialect: postgresDialect}
+}
+
+func NewSQLiteTenantRepository(db *sql.DB) *SQLTenantRepository {
+	return &SQLTenantRepository{db: db, dialect: sqliteDialect}
+}
+
+func (r *SQLTenantRepository) selectTenants() string {
+	hourAgo := r.dialect.secondsFromNow("-3600")
+	return `
+		SELECT t.id, t.name, t.max_devices, t.max_commands_per_hour, t.max_alerts_per_hour,
+			(SELECT COUNT(*) FROM devices d WHERE d.tenant_id = t.id),
+			(SELECT COUNT(*) FROM commands c JOIN devices d ON d.id = c.device_id
+			 WHERE d.tenant_id = t.id AND c.created_at > ` + hourAgo + `),
+			(SELECT COUNT(*) FROM alerts a
+			 WHERE a.tenant_id = t.id AND a.last_raised_at > ` + hourAgo + `),
+			t.created_at, t.updated_at
+		FROM tenants t`
+}
+
+func (r *SQLTenantRepository) List(ctx context.Context) ([]models.Tenant, error) {
+	rows, err := r.db.QueryContext(ctx, r.selectTenants()+` ORDER BY t.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []models.Tenant{}
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+func (r *SQLTenantRepository) Get(ctx context.Context, id string) (models.Tenant, error) {
+	t, err := scanTenant(r.db.QueryRowContext(ctx, r.selectTenants()+` WHERE t.id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, ErrTenantNotFound
+	}
+	return t, err
+}
+
+func (r *SQLTenantRepository) Create(ctx context.Context, id, name string, quotas models.TenantQuotas) (models.Tenant, error) {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO tenants (id, name, max_devices, max_commands_per_hour, max_alerts_per_hour)
+		VALUES ($1, $2, $3, $4, $5)
+	`, id, name, quotas.MaxDevices, quotas.MaxCommandsPerHour, quotas.MaxAlertsPerHour)
+	if r.dialect.uniqueViolation(err) {
+		return models.Tenant{}, ErrDuplicateTenant
+	}
+	if err != nil {
+		return models.Tenant{}, err
+	}
+	return r.Get(ctx, id)
+}
+
+func (r *SQLTenantRepository) Update(ctx context.Context, id, name string, quotas models.TenantQuotas) (models.Tenant, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE tenants SET name = COALESCE(NULLIF($2, ''), name),
+			max_devices = $3, max_commands_per_hour = $4, max_alerts_per_hour = $5,
+			updated_at = `+r.dialect.now+`
+		WHERE id = $1
+	`, id, name, quotas.MaxDevices, quotas.MaxCommandsPerHour, quotas.MaxAlertsPerHour)
+	if err != nil {
+		return models.Tenant{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.Tenant{}, ErrTenantNotFound
+	}
+	return r.Get(ctx, id)
+}
+
+func scanTenant(row rowScanner) (models.Tenant, error) {
+	var (
+		t                             models.Tenant
+		maxDevices, maxCmds, maxAlert sql.NullInt64
+	)
+	err := row.Scan(&t.ID, &t.Name, &maxDevices, &maxCmds, &maxAlert,
+		&t.Usage.Devices, &t.Usage.CommandsLastHour, &t.Usage.AlertsLastHour,
+		&t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return t, err
+	}
+	t.Quotas = models.TenantQuotas{
+		MaxDevices:         nullIntPtr(maxDevices),
+		MaxCommandsPerHour: nullIntPtr(maxCmds),
+		MaxAlertsPerHour:   nullIntPtr(maxAlert),
+	}
+	return t, nil
+}
+
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
@@ -0,0 +1,330 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+)
+
+const userColumns = `u.id, u.username, u.tenant_id, u.password_hash, u.created_at, u.updated_at, u.disabled_at`
+
+// SQLUserRepository implements UserRepository on Postgres or SQLite. IDs
+// must be valid UUIDs; Postgres rejects anything else.
+type SQLUserRepository struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func NewPostgresUserRepository(db *sql.DB) *SQLUserRepository {
+	return &SQLUserRepository{db: db, dialect: postgresDialect}
+}
+
+func NewSQLiteUserRepository(db *sql.DB) *SQLUserRepository {
+	return &SQLUserRepository{db: db, dialect: sqliteDialect}
+}
+
+func (r *SQLUserRepository) Create(ctx context.Context, username, passwordHash, tenantID string, roles []models.RoleGrant) (models.User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	// Checked here rather than by the foreign key, which SQLite lacks
+	var exists int
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM tenants WHERE id = $1`, tenantID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrTenantNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	var id string
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (username, password_hash, tenant_id) VALUES ($1, $2, $3)
+		RETURNING id
+	`, username, passwordHash, tenantID).Scan(&id)
+	if r.dialect.uniqueViolation(err) {
+		return models.User{}, ErrDuplicateUsername
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	if err := insertRoles(ctx, tx, id, roles); err != nil {
+		return models.User{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.User{}, err
+	}
+	return r.Get(ctx, id)
+}
+
+func (r *SQLUserRepository) Get(ctx context.Context, id string) (models.User, error) {
+	return r.getWhere(ctx, `u.id = $1`, id)
+}
+
+func (r *SQLUserRepository) GetByUsername(ctx context.Context, username string) (models.User, error) {
+	return r.getWhere(ctx, `u.username = $1`, username)
+}
+
+func (r *SQLUserRepository) getWhere(ctx context.Context, cond string, arg string) (models.User, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users u WHERE `+cond, arg)
+	u, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrNotFound
+	}
+	if err != nil {
+		return u, err
+	}
+	u.Roles, err = userRoles(ctx, r.db, u.ID)
+	return u, err
+}
+
+func (r *SQLUserRepository) List(ctx context.Context) ([]models.User, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users u ORDER BY u.username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	roles, err := r.db.QueryContext(ctx, `SELECT user_id, role, location FROM user_roles ORDER BY role, location`)
+	if err != nil {
+		return nil, err
+	}
+	defer roles.Close()
+
+	byUser := map[string][]models.RoleGrant{}
+	for roles.Next() {
+		var (
+			userID string
+			g      models.RoleGrant
+		)
+		if err := roles.Scan(&userID, &g.Role, &g.Location); err != nil {
+			return nil, err
+		}
+		byUser[userID] = append(byUser[userID], g)
+	}
+	for i := range users {
+		users[i].Roles = append([]models.RoleGrant{}, byUser[users[i].ID]...)
+	}
+	return users, roles.Err()
+}
+
+func (r *SQLUserRepository) Disable(ctx context.Context, id string) (models.User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE users SET disabled_at = COALESCE(disabled_at, `+r.dialect.now+`), updated_at = `+r.dialect.now+`
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return models.User{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return models.User{}, err
+	} else if n == 0 {
+		return models.User{}, ErrNotFound
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = `+r.dialect.now+`
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return models.User{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.User{}, err
+	}
+	return r.Get(ctx, id)
+}
+
+func (r *SQLUserRepository) SetRoles(ctx context.Context, id string, roles []models.RoleGrant) (models.User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE users SET updated_at = `+r.dialect.now+` WHERE id = $1`, id)
+	if err != nil {
+		return models.User{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return models.User{}, err
+	} else if n == 0 {
+		return models.User{}, ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1`, id); err != nil {
+		return models.User{}, err
+	}
+	if err := insertRoles(ctx, tx, id, roles); err != nil {
+		return models.User{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.User{}, err
+	}
+	return r.Get(ctx, id)
+}
+
+func (r *SQLUserRepository) CreateRefreshToken(ctx context.Context, userID, hash string, ttl time.Duration) error {
+	return r.insertRefreshToken(ctx, r.db, userID, newUUID(), hash, ttl)
+}
+
+func (r *SQLUserRepository) insertRefreshToken(ctx context.Context, db execer, userID, familyID, hash string, ttl time.Duration) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, `+r.dialect.secondsFromNow("$4")+`)
+	`, userID, familyID, hash, ttl.Seconds())
+	return err
+}
+
+func (r *SQLUserRepository) RotateRefreshToken(ctx context.Context, hash, nextHash string, ttl time.Duration) (models.User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	var (
+		tokenID, familyID    string
+		revoked, used, valid bool
+	)
+	row := tx.QueryRowContext(ctx, `
+		SELECT t.id, t.family_id, t.revoked_at IS NOT NULL, t.used_at IS NOT NULL,
+			t.expires_at > `+r.dialect.now+` AND u.disabled_at IS NULL, `+userColumns+`
+		FROM refresh_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1`+r.dialect.forUpdate,
+		hash)
+	u, err := scanUser(row, &tokenID, &familyID, &revoked, &used, &valid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	switch {
+	case revoked:
+		return models.User{}, ErrNotFound
+	case used:
+		// Someone replayed a token that was already exchanged: the family
+		// may be stolen, so end it for the legitimate holder too
+		if err := r.revokeFamily(ctx, tx, familyID); err != nil {
+			return models.User{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return models.User{}, err
+		}
+		return models.User{}, ErrTokenReused
+	case !valid:
+		return models.User{}, ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = `+r.dialect.now+` WHERE id = $1`, tokenID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if err := r.insertRefreshToken(ctx, tx, u.ID, familyID, nextHash, ttl); err != nil {
+		return models.User{}, err
+	}
+	if u.Roles, err = userRoles(ctx, tx, u.ID); err != nil {
+		return models.User{}, err
+	}
+	return u, tx.Commit()
+}
+
+func (r *SQLUserRepository) RevokeRefreshFamily(ctx context.Context, hash string) error {
+	var familyID string
+	err := r.db.QueryRowContext(ctx, `SELECT family_id FROM refresh_tokens WHERE token_hash = $1`, hash).Scan(&familyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.revokeFamily(ctx, r.db, familyID)
+}
+
+func (r *SQLUserRepository) revokeFamily(ctx context.Context, db execer, familyID string) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = `+r.dialect.now+`
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`, familyID)
+	return err
+}
+
+// execer is a *sql.DB or *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// queryer is a *sql.DB or *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func insertRoles(ctx context.Context, db execer, userID string, roles []models.RoleGrant) error {
+	for _, g := range roles {
+		_, err := db.ExecContext(ctx, `INSERT INTO user_roles (user_id, role, location) VALUES ($1, $2, $3)`,
+			userID, g.Role, g.Location)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func userRoles(ctx context.Context, db queryer, userID string) ([]models.RoleGrant, error) {
+	rows, err := db.QueryContext(ctx, `SELECT role, location FROM user_roles WHERE user_id = $1 ORDER BY role, location`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []models.RoleGrant{}
+	for rows.Next() {
+		var g models.RoleGrant
+		if err := rows.Scan(&g.Role, &g.Location); err != nil {
+			return nil, err
+		}
+		roles = append(roles, g)
+	}
+	return roles, rows.Err()
+}
+
+// scanUser scans prefix, then the userColumns
+func scanUser(row rowScanner, prefix ...interface{}) (models.User, error) {
+	var (
+		u                models.User
+		created, updated sql.NullTime
+		disabled         sql.NullTime
+	)
+	dest := append(prefix, &u.ID, &u.Username, &u.TenantID, &u.PasswordHash, &created, &updated, &disabled)
+	err := row.Scan(dest...)
+	u.CreatedAt = created.Time
+	u.UpdatedAt = updated.Time
+	u.DisabledAt = nullTimePtr(disabled)
+	return u, err
+}
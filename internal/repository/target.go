@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"portofolionetworkapi/internal/models"
+)
+
+// targetWhere turns the device filter of a bulk job or rollout into a
+// WHERE clause over devices aliased as d, appending its arguments to args.
+// The filter must already be validated; with no criteria it matches every
+// device.
+func (dl sqlDialect) targetWhere(f models.DeviceFilter, args *[]interface{}) string {
+	conds := []string{"1=1"}
+	next := func(v interface{}) string {
+		*args = append(*args, v)
+		return fmt.Sprintf("$%d", len(*args))
+	}
+
+	if len(f.IDs) > 0 {
+		in := make([]string, len(f.IDs))
+		for i, id := range f.IDs {
+			in[i] = next(strings.ToLower(id))
+		}
+		conds = append(conds, "d.id IN ("+strings.Join(in, ", ")+")")
+	}
+	if f.Location != "" {
+		conds = append(conds, "LOWER(d.location) = LOWER("+next(f.Location)+")")
+	}
+	if f.Status != "" {
+		conds = append(conds, "d.status = "+next(f.Status))
+	}
+	if f.Name != "" {
+		conds = append(conds, "d.name "+dl.ilike+" "+next(globToLike(f.Name))+` ESCAPE '\'`)
+	}
+	if f.Tenant != "" {
+		conds = append(conds, "d.tenant_id = "+next(f.Tenant))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// globToLike converts a shell-style glob (* and ?) into a LIKE pattern,
+// escaping LIKE metacharacters in the literal parts
+func globToLike(glob string) string {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		case '%', '_', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// matchesTarget is targetWhere for the in-memory repositories
+func matchesTarget(d models.Device, f models.DeviceFilter) bool {
+	if len(f.IDs) > 0 && !containsFold(f.IDs, d.ID) {
+		return false
+	}
+	if f.Location != "" && !strings.EqualFold(d.Location, f.Location) {
+		return false
+	}
+	if f.Status != "" && d.Status != f.Status {
+		return false
+	}
+	if f.Tenant != "" && d.TenantID != f.Tenant {
+		return false
+	}
+	return f.Name == "" || globToRegexp(f.Name).MatchString(d.Name)
+}
+
+// globToRegexp compiles a glob into a case-insensitive regexp
+func globToRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
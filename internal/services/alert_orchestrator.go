@@ -1,9 +1,16 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"portofolionetworkapi/internal/repository"
 )
 
 type AlertPayload struct {
@@ -18,33 +25,150 @@ type AlertPayload struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// Notifiers are the alert channels and ticket routing HandleAlert uses.
+// They are replaced as a whole (see AlertOrchestrator.SetNotifiers), never
+// modified in place.
+type Notifiers struct {
+	Telegram *TelegramService
+	Odoo     *OdooService
+	// TeamID is the Odoo helpdesk team new tickets go to
+	TeamID int
+	// DefaultUserID is assigned when the caller doesn't pick a user
+	DefaultUserID int
+}
+
 type AlertOrchestrator struct {
-	telegram *TelegramService
-	odoo     *OdooService
-	teamID   int
+	notifiers atomic.Pointer[Notifiers]
+	// devices and alerts are nil when alerts are not stored
+	devices repository.DeviceRepository
+	alerts  repository.AlertRepository
+
+	// inFlight counts HandleAlert calls so shutdown can wait for a delivery
+	// that already sent Telegram to also create its ticket
+	inFlight sync.WaitGroup
+	active   int64
 }
 
-func NewAlertOrchestrator(telegram *TelegramService, odoo *OdooService, teamID int) *AlertOrchestrator {
-	return &AlertOrchestrator{
-		telegram: telegram,
-		odoo:     odoo,
-		teamID:   teamID,
-	}
+// NewAlertOrchestrator creates the orchestrator. Alerts are matched to
+// devices and recorded when devices and alerts are set; either may be nil.
+func NewAlertOrchestrator(notifiers *Notifiers, devices repository.DeviceRepository, alerts repository.AlertRepository) *AlertOrchestrator {
+	o := &AlertOrchestrator{devices: devices, alerts: alerts}
+	o.notifiers.Store(notifiers)
+	return o
+}
+
+// SetNotifiers swaps the alert channels. Alerts already being handled finish
+// with the notifiers they started with.
+func (o *AlertOrchestrator) SetNotifiers(n *Notifiers) {
+	o.notifiers.Store(n)
+}
+
+func (o *AlertOrchestrator) Notifiers() *Notifiers {
+	return o.notifiers.Load()
+}
+
+// ErrNotConfigured is returned by a notifier Ping when the channel is off
+var ErrNotConfigured = errors.New("not configured")
+
+// PingTelegram and PingOdoo check the current notifiers, so health checks
+// follow a reload
+func (o *AlertOrchestrator) PingTelegram(ctx context.Context) error {
+	return o.notifiers.Load().Telegram.Ping(ctx)
+}
+
+func (o *AlertOrchestrator) PingOdoo(ctx context.Context) error {
+	return o.notifiers.Load().Odoo.Ping(ctx)
 }
 
 type HandleAlertResult struct {
 	TelegramSent bool   `json:"telegram_sent"`
 	TicketID     int    `json:"ticket_id,omitempty"`
+	Suppressed   bool   `json:"suppressed,omitempty"`
 	Message      string `json:"message"`
 	Error        string `json:"error,omitempty"`
 }
 
-func (o *AlertOrchestrator) HandleAlert(alert AlertPayload, assignUserID int) HandleAlertResult {
-	result := HandleAlertResult{
-		Message: "Alert processed successfully",
+// Drain waits until no alert is being handled, or until ctx is done. Callers
+// stop new alerts first (HTTP server shut down, staleness monitor stopped).
+func (o *AlertOrchestrator) Drain(ctx context.Context) error {
+	if n := atomic.LoadInt64(&o.active); n > 0 {
+		log.Printf("[INFO] Waiting for %d in-flight alert(s)", n)
+	}
+	done := make(chan struct{})
+	go func() {
+		o.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d alert(s) still in flight: %w", atomic.LoadInt64(&o.active), ctx.Err())
+	}
+}
+
+// AlertPlan is what HandleAlert does with an alert: where it is routed,
+// the Telegram message and the Odoo ticket. DryRun returns it as is.
+type AlertPlan struct {
+	Alert AlertPayload `json:"alert"`
+	// DeviceID is the inventory device the alert matched, if any
+	DeviceID         string        `json:"device_id,omitempty"`
+	TenantID         string        `json:"tenant_id"`
+	Suppressed       bool          `json:"suppressed"`
+	SuppressedReason string        `json:"suppressed_reason,omitempty"`
+	Telegram         *TelegramPlan `json:"telegram,omitempty"`
+	Ticket           *TicketPlan   `json:"ticket,omitempty"`
+
+	target    alertTarget
+	notifiers *Notifiers
+}
+
+// TelegramPlan is the message for the alert chat. Configured is false when
+// sending would fail for lack of a token or chat ID.
+type TelegramPlan struct {
+	Configured bool                   `json:"configured"`
+	Payload    map[string]interface{} `json:"payload"`
+	// FollowUp is sent after the ticket is created; {ticket_id} stands for
+	// its ID
+	FollowUp string `json:"follow_up,omitempty"`
+
+	text string
+}
+
+// TicketPlan is the Odoo ticket for the alert. No ticket is created when
+// Odoo is not configured.
+type TicketPlan struct {
+	Configured bool                   `json:"configured"`
+	Model      string                 `json:"model"`
+	Values     map[string]interface{} `json:"values"`
+
+	title, description string
+	userID             int
+}
+
+// plan routes and formats the alert without side effects. It takes one
+// notifiers snapshot, so a reload can't send the message to one chat and
+// the ticket to another team.
+func (o *AlertOrchestrator) plan(alert AlertPayload, assignUserID int) AlertPlan {
+	n := o.notifiers.Load()
+	if assignUserID == 0 {
+		assignUserID = n.DefaultUserID
 	}
 
-	// 1. Format and send Telegram Message
+	target := o.lookupAlertTarget(alert)
+	p := AlertPlan{Alert: alert, DeviceID: target.DeviceID, TenantID: target.TenantID, target: target, notifiers: n}
+
+	// Tenants over their hourly alert quota still get the alert recorded,
+	// but no Telegram message or ticket. Resolutions always go through.
+	if alert.Status != "RESOLVED" {
+		if quotaErr := o.alertQuotaExceeded(target, alert.EventID); quotaErr != nil {
+			p.Suppressed = true
+			p.SuppressedReason = quotaErr.Error()
+			return p
+		}
+	}
+
+	// 1. Format the Telegram Message
 	msg := fmt.Sprintf(
 		"🚨 <b>Network Alert: %s</b>\n"+
 			"<b>Device:</b> %s (%s)\n"+
@@ -62,37 +186,90 @@ func (o *AlertOrchestrator) HandleAlert(alert AlertPayload, assignUserID int) Ha
 		alert.SLA,
 		alert.Timestamp.Format(time.RFC1123),
 	)
+	p.Telegram = &TelegramPlan{
+		Configured: n.Telegram.Configured(),
+		Payload:    n.Telegram.MessagePayload(msg),
+		text:       msg,
+	}
+
+	// 2. Only create Odoo ticket if severity is high enough and status is PROBLEM
+	//    Many setups only want tickets on new problems, not on resolution initially.
+	//    We can adjust this logic, but let's default to creating tickets on PROBLEM.
+	if alert.Status == "PROBLEM" && (alert.Severity == "DISASTER" || alert.Severity == "HIGH" || alert.Severity == "AVERAGE") {
+		title := fmt.Sprintf("[%s] %s - %s", alert.Severity, alert.Device, alert.Problem)
+		desc := fmt.Sprintf(
+			"Event ID: %s\nDevice: %s\nIP: %s\nSeverity: %s\nProblem: %s\nCustomers Affected: %d\nSLA: %s",
+			alert.EventID, alert.Device, alert.IP, alert.Severity, alert.Problem, alert.Customers, alert.SLA,
+		)
+		p.Ticket = &TicketPlan{
+			Configured:  n.Odoo.Configured(),
+			Model:       OdooTicketModel,
+			Values:      TicketValues(title, desc, n.TeamID, assignUserID),
+			title:       title,
+			description: desc,
+			userID:      assignUserID,
+		}
+		if p.Ticket.Configured {
+			p.Telegram.FollowUp = ticketFollowUp("{ticket_id}", alert.Device)
+		}
+	}
+	return p
+}
+
+// ticketFollowUp is the Telegram message announcing a new ticket
+func ticketFollowUp(ticketID, device string) string {
+	return fmt.Sprintf("✅ Ticket #%s created for issue on %s", ticketID, device)
+}
+
+// DryRun runs the alert through the same routing, quota check and
+// templating as HandleAlert and returns the plan. Nothing is sent,
+// ticketed or recorded.
+func (o *AlertOrchestrator) DryRun(alert AlertPayload, assignUserID int) AlertPlan {
+	return o.plan(alert, assignUserID)
+}
 
-	if err := o.telegram.SendMessage(msg); err != nil {
+// HandleAlert notifies Telegram and opens an Odoo ticket for the alert. An
+// assignUserID of 0 assigns the ticket to the configured default user.
+func (o *AlertOrchestrator) HandleAlert(alert AlertPayload, assignUserID int) HandleAlertResult {
+	o.inFlight.Add(1)
+	atomic.AddInt64(&o.active, 1)
+	defer func() {
+		atomic.AddInt64(&o.active, -1)
+		o.inFlight.Done()
+	}()
+
+	p := o.plan(alert, assignUserID)
+	n := p.notifiers
+
+	result := HandleAlertResult{
+		Message: "Alert processed successfully",
+	}
+
+	if p.Suppressed {
+		log.Printf("[WARN] Alert %s suppressed: %s", alert.EventID, p.SuppressedReason)
+		o.recordAlert(alert, p.target, 0)
+		result.Suppressed = true
+		result.Message = "Alert recorded; notifications suppressed: " + p.SuppressedReason
+		return result
+	}
+
+	if err := n.Telegram.SendMessage(p.Telegram.text); err != nil {
 		log.Printf("[ERROR] Failed to send Telegram message: %v", err)
 		result.Error += fmt.Sprintf("Telegram Error: %v; ", err)
 	} else {
 		result.TelegramSent = true
 	}
 
-	// 2. Only create Odoo ticket if severity is high enough and status is PROBLEM
-	//    Many setups only want tickets on new problems, not on resolution initially.
-	//    We can adjust this logic, but let's default to creating tickets on PROBLEM.
-	if alert.Status == "PROBLEM" && (alert.Severity == "DISASTER" || alert.Severity == "HIGH" || alert.Severity == "AVERAGE") {
-		// Attempt login if not already done or handle session logic inside login
-		if o.odoo.url != "" {
-			title := fmt.Sprintf("[%s] %s - %s", alert.Severity, alert.Device, alert.Problem)
-			desc := fmt.Sprintf(
-				"Event ID: %s\nDevice: %s\nIP: %s\nSeverity: %s\nProblem: %s\nCustomers Affected: %d\nSLA: %s",
-				alert.EventID, alert.Device, alert.IP, alert.Severity, alert.Problem, alert.Customers, alert.SLA,
-			)
-
-			ticketID, err := o.odoo.CreateTicket(title, desc, o.teamID, assignUserID)
-			if err != nil {
-				log.Printf("[ERROR] Failed to create Odoo ticket: %v", err)
-				result.Error += fmt.Sprintf("Odoo Error: %v", err)
-			} else {
-				result.TicketID = ticketID
-
-				// Send a followup message to Telegram with the ticket ID
-				ticketMsg := fmt.Sprintf("✅ Ticket #%d created for issue on %s", ticketID, alert.Device)
-				o.telegram.SendMessage(ticketMsg)
-			}
+	if t := p.Ticket; t != nil && t.Configured {
+		ticketID, err := n.Odoo.CreateTicket(t.title, t.description, n.TeamID, t.userID)
+		if err != nil {
+			log.Printf("[ERROR] Failed to create Odoo ticket: %v", err)
+			result.Error += fmt.Sprintf("Odoo Error: %v", err)
+		} else {
+			result.TicketID = ticketID
+
+			// Send a followup message to Telegram with the ticket ID
+			n.Telegram.SendMessage(ticketFollowUp(strconv.Itoa(ticketID), alert.Device))
 		}
 	}
 
@@ -100,5 +277,7 @@ func (o *AlertOrchestrator) HandleAlert(alert AlertPayload, assignUserID int) Ha
 		result.Message = "Processed with errors"
 	}
 
+	o.recordAlert(alert, p.target, result.TicketID)
+
 	return result
 }
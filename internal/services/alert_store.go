@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+// alertTarget is the device an alert refers to and the tenant it is
+// charged to. Alerts for unknown devices belong to the default tenant.
+type alertTarget struct {
+	DeviceID string
+	TenantID string
+}
+
+// lookupAlertTarget matches the alert's device by name, then by IP
+func (o *AlertOrchestrator) lookupAlertTarget(alert AlertPayload) alertTarget {
+	target := alertTarget{TenantID: models.DefaultTenantID}
+	if o.devices == nil {
+		return target
+	}
+
+	d, err := o.devices.Match(context.Background(), alert.Device, alert.IP)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("[WARN] Failed to match alert %s to a device: %v", alert.EventID, err)
+		}
+		return target
+	}
+	target.DeviceID = d.ID
+	if d.TenantID != "" {
+		target.TenantID = d.TenantID
+	}
+	return target
+}
+
+// alertQuotaExceeded reports whether raising this alert would take the
+// tenant above its hourly alert quota. Errors fail open so alerts are never
+// lost to a quota lookup.
+func (o *AlertOrchestrator) alertQuotaExceeded(target alertTarget, eventID string) *repository.QuotaExceededError {
+	if o.alerts == nil {
+		return nil
+	}
+
+	var quotaErr *repository.QuotaExceededError
+	if err := o.alerts.CheckQuota(context.Background(), target.TenantID, eventID); errors.As(err, &quotaErr) {
+		return quotaErr
+	}
+	return nil
+}
+
+// recordAlert persists the outcome of HandleAlert. PROBLEM events open (or
+// reopen) the alert; RESOLVED events close the alert with the same event ID.
+// Failures are logged only, so notification delivery never depends on it.
+func (o *AlertOrchestrator) recordAlert(alert AlertPayload, target alertTarget, ticketID int) {
+	if o.alerts == nil {
+		return
+	}
+
+	ctx := context.Background()
+	var err error
+	if alert.Status == "RESOLVED" {
+		err = o.alerts.Resolve(ctx, alert.EventID, alert.Timestamp.UTC())
+	} else {
+		err = o.alerts.Raise(ctx, models.Alert{
+			EventID:           alert.EventID,
+			DeviceID:          target.DeviceID,
+			TenantID:          target.TenantID,
+			DeviceName:        alert.Device,
+			IPAddress:         alert.IP,
+			Severity:          alert.Severity,
+			Problem:           alert.Problem,
+			TicketID:          ticketID,
+			CustomersAffected: alert.Customers,
+			SLAStatus:         alert.SLA,
+			OpenedAt:          alert.Timestamp.UTC(),
+		})
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to record alert %s: %v", alert.EventID, err)
+	}
+}
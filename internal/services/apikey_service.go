@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+)
+
+// Device keys look like "ndk_<12 hex prefix>_<64 hex secret>". The prefix
+// finds the stored row; the whole key is hashed and compared.
+const (
+	deviceKeyScheme    = "ndk_"
+	deviceKeyPrefixLen = 12
+	deviceKeySecretLen = 64
+)
+
+// lastUsedResolution limits last_used_at writes to one per key per minute
+const lastUsedResolution = time.Minute
+
+// APIKeyService issues per-device agent keys and authenticates agents
+// presenting them
+type APIKeyService struct {
+	keys  repository.APIKeyRepository
+	grace time.Duration
+}
+
+// NewAPIKeyService creates the service. When a key is issued, the device's
+// previous keys keep working for grace unless the request overrides it.
+func NewAPIKeyService(keys repository.APIKeyRepository, grace time.Duration) *APIKeyService {
+	return &APIKeyService{keys: keys, grace: grace}
+}
+
+// Issue creates a key for a device and returns it with its plaintext,
+// which is not stored. grace, when set, overrides the default grace period
+// for the keys being rotated out.
+func (s *APIKeyService) Issue(ctx context.Context, deviceID string, grace *time.Duration) (models.IssuedAPIKey, error) {
+	if !models.IsValidUUID(deviceID) {
+		return models.IssuedAPIKey{}, ErrDeviceNotFound
+	}
+	g := s.grace
+	if grace != nil {
+		g = *grace
+	}
+
+	plaintext, prefix, err := generateDeviceKey()
+	if err != nil {
+		return models.IssuedAPIKey{}, err
+	}
+	key, err := s.keys.Create(ctx, models.DeviceAPIKey{
+		DeviceID: strings.ToLower(deviceID),
+		Prefix:   prefix,
+		Hash:     hashDeviceKey(plaintext),
+	}, g)
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.IssuedAPIKey{}, ErrDeviceNotFound
+	}
+	if err != nil {
+		return models.IssuedAPIKey{}, err
+	}
+	return models.IssuedAPIKey{DeviceAPIKey: key, Key: plaintext}, nil
+}
+
+// List returns a device's keys, newest first, without their hashes
+func (s *APIKeyService) List(ctx context.Context, deviceID string) ([]models.DeviceAPIKey, error) {
+	if !models.IsValidUUID(deviceID) {
+		return []models.DeviceAPIKey{}, nil
+	}
+	return s.keys.List(ctx, strings.ToLower(deviceID))
+}
+
+// Revoke stops a key from authenticating immediately
+func (s *APIKeyService) Revoke(ctx context.Context, deviceID, keyID string) (models.DeviceAPIKey, error) {
+	if !models.IsValidUUID(deviceID) || !models.IsValidUUID(keyID) {
+		return models.DeviceAPIKey{}, ErrAPIKeyNotFound
+	}
+	key, err := s.keys.Revoke(ctx, strings.ToLower(deviceID), strings.ToLower(keyID))
+	if errors.Is(err, repository.ErrNotFound) {
+		return key, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// IsDeviceKey reports whether token has the shape of a per-device key
+func IsDeviceKey(token string) bool {
+	_, ok := deviceKeyPrefix(token)
+	return ok
+}
+
+// AuthenticateAgent returns the device a per-device key belongs to, or
+// ErrInvalidAPIKey when the key is unknown, revoked or expired
+func (s *APIKeyService) AuthenticateAgent(ctx context.Context, token string) (models.AgentIdentity, error) {
+	prefix, ok := deviceKeyPrefix(token)
+	if !ok {
+		return models.AgentIdentity{}, ErrInvalidAPIKey
+	}
+	key, deviceName, err := s.keys.FindUsable(ctx, prefix)
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.AgentIdentity{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return models.AgentIdentity{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashDeviceKey(token)), []byte(key.Hash)) != 1 {
+		return models.AgentIdentity{}, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) >= lastUsedResolution {
+		if err := s.keys.MarkUsed(ctx, key.ID); err != nil {
+			log.Printf("[WARN] Failed to record use of api key %s: %v", key.Prefix, err)
+		}
+	}
+	return models.AgentIdentity{DeviceID: key.DeviceID, DeviceName: deviceName, KeyID: key.ID}, nil
+}
+
+// DeviceHasKey reports whether the device ref (UUID or name) has a usable
+// per-device key. The shared fleet key may not act for such devices.
+func (s *APIKeyService) DeviceHasKey(ctx context.Context, deviceRef string) (bool, error) {
+	return s.keys.DeviceHasUsable(ctx, deviceRef)
+}
+
+// generateDeviceKey returns a new key and its public prefix
+func generateDeviceKey() (string, string, error) {
+	b := make([]byte, (deviceKeyPrefixLen+deviceKeySecretLen)/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("generating api key: %w", err)
+	}
+	raw := hex.EncodeToString(b)
+	prefix := deviceKeyScheme + raw[:deviceKeyPrefixLen]
+	return prefix + "_" + raw[deviceKeyPrefixLen:], prefix, nil
+}
+
+// deviceKeyPrefix extracts the stored prefix ("ndk_" and 12 hex digits)
+// from a well-formed key
+func deviceKeyPrefix(token string) (string, bool) {
+	prefixEnd := len(deviceKeyScheme) + deviceKeyPrefixLen
+	if len(token) != prefixEnd+1+deviceKeySecretLen ||
+		!strings.HasPrefix(token, deviceKeyScheme) || token[prefixEnd] != '_' {
+		return "", false
+	}
+	if !isLowerHex(token[len(deviceKeyScheme):prefixEnd]) || !isLowerHex(token[prefixEnd+1:]) {
+		return "", false
+	}
+	return token[:prefixEnd], true
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func hashDeviceKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+var (
+	ErrInvalidCredentials  = errors.New("invalid username or password")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrInvalidAccessToken  = errors.New("invalid or expired access token")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrUserExists          = errors.New("username already exists")
+	ErrInvalidUser         = errors.New("invalid user")
+)
+
+// tokenIssuer is the iss claim of access tokens
+const tokenIssuer = "netops-integration-api"
+
+// accessClaims are the claims of an access token; the subject is the user
+// ID. Roles are copied in at issue time, so role changes apply from the
+// next refresh.
+type accessClaims struct {
+	Username string             `json:"username"`
+	Tenant   string             `json:"tenant"`
+	Roles    []models.RoleGrant `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// AuthService logs dashboard users in and issues their tokens: short-lived
+// HS256 access tokens and single-use refresh tokens that rotate on every
+// refresh
+type AuthService struct {
+	users      repository.UserRepository
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	// dummyHash is compared against when the username is unknown, so
+	// unknown and known users take the same time to reject
+	dummyHash []byte
+}
+
+// NewAuthService creates the service. An empty secret leaves user
+// authentication disabled (see Enabled).
+func NewAuthService(users repository.UserRepository, secret string, accessTTL, refreshTTL time.Duration) *AuthService {
+	dummy, _ := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	return &AuthService{
+		users:      users,
+		secret:     []byte(secret),
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		dummyHash:  dummy,
+	}
+}
+
+// Enabled reports whether a signing secret is configured
+func (s *AuthService) Enabled() bool {
+	return len(s.secret) > 0
+}
+
+// Login checks the password and opens a new refresh token family
+func (s *AuthService) Login(ctx context.Context, username, password string) (models.TokenPair, error) {
+	u, err := s.users.GetByUsername(ctx, strings.ToLower(username))
+	if errors.Is(err, repository.ErrNotFound) {
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return models.TokenPair{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil || u.DisabledAt != nil {
+		return models.TokenPair{}, ErrInvalidCredentials
+	}
+
+	refresh, hash, err := generateRefreshToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if err := s.users.CreateRefreshToken(ctx, u.ID, hash, s.refreshTTL); err != nil {
+		return models.TokenPair{}, err
+	}
+	return s.tokenPair(u, refresh)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Presenting a
+// refresh token a second time revokes every token descended from the same
+// login, so a stolen token stops working for both parties.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (models.TokenPair, error) {
+	next, nextHash, err := generateRefreshToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	u, err := s.users.RotateRefreshToken(ctx, hashToken(refreshToken), nextHash, s.refreshTTL)
+	if errors.Is(err, repository.ErrTokenReused) {
+		log.Printf("[WARN] Refresh token reused; revoked the session family")
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	return s.tokenPair(u, next)
+}
+
+// Logout revokes the refresh token and every token rotated from the same
+// login. Access tokens already issued stay valid until they expire.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	return s.users.RevokeRefreshFamily(ctx, hashToken(refreshToken))
+}
+
+// VerifyAccessToken checks the signature, issuer and expiry of an access
+// token and returns its user. Tokens without a tenant, issued before users
+// had one, are rejected.
+func (s *AuthService) VerifyAccessToken(token string) (models.AuthUser, error) {
+	if !s.Enabled() {
+		return models.AuthUser{}, ErrInvalidAccessToken
+	}
+	var claims accessClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || claims.Subject == "" || !models.IsValidTenantID(claims.Tenant) {
+		return models.AuthUser{}, ErrInvalidAccessToken
+	}
+	return models.AuthUser{ID: claims.Subject, Username: claims.Username, TenantID: claims.Tenant, Roles: claims.Roles}, nil
+}
+
+// CreateUser adds a user with a bcrypt-hashed password. Usernames are
+// stored lowercase; users created without roles are viewers, and without a
+// tenant they join the default tenant.
+func (s *AuthService) CreateUser(ctx context.Context, req models.CreateUserRequest) (models.User, error) {
+	username := strings.ToLower(strings.TrimSpace(req.Username))
+	if !models.IsValidUsername(username) {
+		return models.User{}, fmt.Errorf("%w: username must be 3-64 characters of a-z, 0-9, '.', '_' or '-'", ErrInvalidUser)
+	}
+	if len(req.Password) < models.MinPasswordLength {
+		return models.User{}, fmt.Errorf("%w: password must be at least %d characters", ErrInvalidUser, models.MinPasswordLength)
+	}
+	// bcrypt ignores everything past 72 bytes
+	if len(req.Password) > 72 {
+		return models.User{}, fmt.Errorf("%w: password must be at most 72 bytes", ErrInvalidUser)
+	}
+	if req.TenantID == "" {
+		req.TenantID = models.DefaultTenantID
+	}
+	if !models.IsValidTenantID(req.TenantID) {
+		return models.User{}, fmt.Errorf("%w: invalid tenant_id", ErrInvalidUser)
+	}
+	if len(req.Roles) == 0 {
+		req.Roles = []models.RoleGrant{{Role: models.DefaultRole}}
+	}
+	roles, err := normalizeRoles(req.Roles)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, err
+	}
+	u, err := s.users.Create(ctx, username, string(hash), req.TenantID, roles)
+	if errors.Is(err, repository.ErrDuplicateUsername) {
+		return u, ErrUserExists
+	}
+	if errors.Is(err, repository.ErrTenantNotFound) {
+		return u, fmt.Errorf("%w: unknown tenant %s", ErrInvalidUser, req.TenantID)
+	}
+	return u, err
+}
+
+func (s *AuthService) ListUsers(ctx context.Context) ([]models.User, error) {
+	return s.users.List(ctx)
+}
+
+// DisableUser blocks the user from logging in and ends their sessions
+func (s *AuthService) DisableUser(ctx context.Context, id string) (models.User, error) {
+	if !models.IsValidUUID(id) {
+		return models.User{}, ErrUserNotFound
+	}
+	u, err := s.users.Disable(ctx, strings.ToLower(id))
+	if errors.Is(err, repository.ErrNotFound) {
+		return u, ErrUserNotFound
+	}
+	return u, err
+}
+
+// SetRoles replaces the user's roles. Access tokens already issued keep the
+// old roles until they expire.
+func (s *AuthService) SetRoles(ctx context.Context, id string, roles []models.RoleGrant) (models.User, error) {
+	if !models.IsValidUUID(id) {
+		return models.User{}, ErrUserNotFound
+	}
+	roles, err := normalizeRoles(roles)
+	if err != nil {
+		return models.User{}, err
+	}
+	u, err := s.users.SetRoles(ctx, strings.ToLower(id), roles)
+	if errors.Is(err, repository.ErrNotFound) {
+		return u, ErrUserNotFound
+	}
+	return u, err
+}
+
+// normalizeRoles validates grants, trims locations and drops duplicates
+// (locations compare case-insensitively)
+func normalizeRoles(roles []models.RoleGrant) ([]models.RoleGrant, error) {
+	out := []models.RoleGrant{}
+	seen := map[models.RoleGrant]bool{}
+	for _, g := range roles {
+		if !models.IsValidRole(g.Role) {
+			return nil, fmt.Errorf("%w: role must be one of viewer, operator, admin", ErrInvalidUser)
+		}
+		g.Location = strings.TrimSpace(g.Location)
+		if msg := models.ValidateDeviceLocation(g.Location); msg != "" {
+			return nil, fmt.Errorf("%w: location %s", ErrInvalidUser, msg)
+		}
+		key := models.RoleGrant{Role: g.Role, Location: strings.ToLower(g.Location)}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, g)
+	}
+	return out, nil
+}
+
+func (s *AuthService) tokenPair(u models.User, refresh string) (models.TokenPair, error) {
+	now := time.Now()
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return models.TokenPair{}, err
+	}
+	access, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims{
+		Username: u.Username,
+		Tenant:   u.TenantID,
+		Roles:    u.Roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   u.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+			ID:        hex.EncodeToString(id),
+		},
+	}).SignedString(s.secret)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	return models.TokenPair{
+		AccessToken:      access,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(s.accessTTL.Seconds()),
+		RefreshToken:     refresh,
+		RefreshExpiresIn: int(s.refreshTTL.Seconds()),
+	}, nil
+}
+
+// generateRefreshToken returns a new opaque refresh token and its hash
+func generateRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("generating refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
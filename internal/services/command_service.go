@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+var (
+	ErrDeviceNotFound           = errors.New("device not found")
+	ErrCommandNotFound          = errors.New("command not found")
+	ErrInvalidCommand           = errors.New("invalid command")
+	ErrInvalidCommandTransition = errors.New("invalid command status transition")
+	ErrExecutionNotFound        = errors.New("execution not found")
+)
+
+// FanOutLimitError is returned when a bulk job matches more devices than
+// allowed without explicit confirmation
+type FanOutLimitError struct {
+	Matched int
+	Max     int
+}
+
+func (e *FanOutLimitError) Error() string {
+	return fmt.Sprintf("filter matches %d devices, above the limit of %d; resend with \"confirm\": true to proceed", e.Matched, e.Max)
+}
+
+// CommandService manages the per-device command queue that agents poll
+type CommandService struct {
+	devices   repository.DeviceRepository
+	commands  repository.CommandRepository
+	maxFanOut int
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewCommandService creates the service. Bulk jobs targeting more than
+// maxFanOut devices require confirmation; 0 disables the check.
+func NewCommandService(devices repository.DeviceRepository, commands repository.CommandRepository, maxFanOut int) *CommandService {
+	return &CommandService{
+		devices:   devices,
+		commands:  commands,
+		maxFanOut: maxFanOut,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Enqueue queues a command for a single device. deviceRef may be the device
+// UUID or its name.
+func (s *CommandService) Enqueue(ctx context.Context, deviceRef string, req models.EnqueueCommandRequest) (*models.Command, error) {
+	params, err := normalizeParameters(req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := commandTimeout(req.TimeoutSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceID, err := s.resolveDeviceID(ctx, deviceRef)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, err := s.commands.Enqueue(ctx, models.Command{
+		DeviceID:       deviceID,
+		Type:           req.Type,
+		Parameters:     json.RawMessage(params),
+		TimeoutSeconds: timeout,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+func (s *CommandService) Get(ctx context.Context, id string) (*models.Command, error) {
+	if !models.IsValidUUID(id) {
+		return nil, ErrCommandNotFound
+	}
+
+	cmd, err := s.commands.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrCommandNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+// ListForDevice returns the most recent commands for a device, newest first
+func (s *CommandService) ListForDevice(ctx context.Context, deviceRef string, limit int) ([]models.Command, error) {
+	deviceID, err := s.resolveDeviceID(ctx, deviceRef)
+	if err != nil {
+		return nil, err
+	}
+	return s.commands.RecentForDevice(ctx, deviceID, limit)
+}
+
+// Claim atomically moves up to limit pending commands for a device to
+// dispatched and returns them oldest first. Concurrent polls never receive
+// the same command twice.
+func (s *CommandService) Claim(ctx context.Context, deviceRef string, limit int) ([]models.Command, error) {
+	deviceID, err := s.resolveDeviceID(ctx, deviceRef)
+	if err != nil {
+		return nil, err
+	}
+	return s.commands.Claim(ctx, deviceID, limit)
+}
+
+// ReportResult applies a status update posted by an agent. Only transitions
+// allowed by the command state machine are accepted.
+func (s *CommandService) ReportResult(ctx context.Context, id string, req models.CommandResultRequest) (*models.Command, error) {
+	switch req.Status {
+	case models.CommandStatusExecuting, models.CommandStatusSucceeded, models.CommandStatusFailed:
+	default:
+		return nil, fmt.Errorf("%w: agents may only report executing, succeeded or failed", ErrInvalidCommandTransition)
+	}
+	if !models.IsValidUUID(id) {
+		return nil, ErrCommandNotFound
+	}
+
+	update := repository.CommandUpdate{Status: req.Status, Error: req.Error}
+	if len(req.Result) > 0 && string(req.Result) != "null" {
+		if !json.Valid(req.Result) {
+			return nil, fmt.Errorf("%w: result must be valid JSON", ErrInvalidCommand)
+		}
+		update.Result = req.Result
+	}
+
+	cmd, err := s.commands.Report(ctx, id, update)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return nil, ErrCommandNotFound
+	case errors.Is(err, repository.ErrStatusConflict):
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidCommandTransition, cmd.Status, req.Status)
+	case err != nil:
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+// BulkConfigure creates a job and queues one command for every device
+// matching the filter, all in a single transaction
+func (s *CommandService) BulkConfigure(ctx context.Context, req models.BulkConfigureRequest) (*models.Execution, error) {
+	params, err := normalizeParameters(req.Command.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := commandTimeout(req.Command.TimeoutSeconds)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDeviceFilter(req.DeviceFilter); err != nil {
+		return nil, err
+	}
+
+	cmd := models.Command{
+		Type:           req.Command.Type,
+		Parameters:     json.RawMessage(params),
+		TimeoutSeconds: timeout,
+	}
+	exec, err := s.commands.CreateJob(ctx, req.DeviceFilter, cmd, func(matched int) error {
+		if matched == 0 {
+			return fmt.Errorf("%w: filter matched no devices", ErrInvalidDeviceFilter)
+		}
+		if s.maxFanOut > 0 && matched > s.maxFanOut && !req.Confirm {
+			return &FanOutLimitError{Matched: matched, Max: s.maxFanOut}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	summarizeExecution(&exec)
+
+	log.Printf("[BULK] Job %s queued %s on %d device(s)", exec.ID, exec.CommandType, exec.TotalDevices)
+	return &exec, nil
+}
+
+// GetExecution returns a bulk job with per-device command status and
+// aggregated progress
+func (s *CommandService) GetExecution(ctx context.Context, id string) (*models.Execution, error) {
+	if !models.IsValidUUID(id) {
+		return nil, ErrExecutionNotFound
+	}
+
+	exec, err := s.commands.GetJob(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrExecutionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	summarizeExecution(&exec)
+	return &exec, nil
+}
+
+// summarizeExecution counts the job's commands by status and derives its
+// progress and overall status. Devices deleted after fan-out drop out of
+// the totals.
+func summarizeExecution(exec *models.Execution) {
+	exec.Pending, exec.Running, exec.Completed, exec.Failed = 0, 0, 0, 0
+	for _, e := range exec.Devices {
+		switch e.Status {
+		case models.CommandStatusPending:
+			exec.Pending++
+		case models.CommandStatusDispatched, models.CommandStatusExecuting:
+			exec.Running++
+		case models.CommandStatusSucceeded:
+			exec.Completed++
+		default:
+			exec.Failed++
+		}
+	}
+
+	total := len(exec.Devices)
+	exec.Progress = 0
+	if total > 0 {
+		exec.Progress = (exec.Completed + exec.Failed) * 100 / total
+	}
+	switch {
+	case total == 0 || exec.Pending == total:
+		exec.Status = "queued"
+	case exec.Pending+exec.Running > 0:
+		exec.Status = "executing"
+	case exec.Failed > 0:
+		exec.Status = "completed_with_errors"
+	default:
+		exec.Status = "completed"
+	}
+}
+
+// ExpireTimedOut marks dispatched or executing commands whose timeout has
+// elapsed since dispatch as timed_out
+func (s *CommandService) ExpireTimedOut(ctx context.Context) (int64, error) {
+	return s.commands.ExpireTimedOut(ctx)
+}
+
+// StartSweeper periodically expires commands that agents never finished
+func (s *CommandService) StartSweeper(interval time.Duration) {
+	go func() {
+		defer close(s.done)
+
+		ctx, cancel := stopContext(s.stop)
+		defer cancel()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				n, err := s.ExpireTimedOut(ctx)
+				if err != nil {
+					log.Printf("[ERROR] Command timeout sweep failed: %v", err)
+				} else if n > 0 {
+					log.Printf("[WARN] %d command(s) timed out", n)
+				}
+			}
+		}
+	}()
+}
+
+func (s *CommandService) StopSweeper() {
+	close(s.stop)
+	<-s.done
+}
+
+// resolveDeviceID accepts a device UUID or name and returns the UUID
+func (s *CommandService) resolveDeviceID(ctx context.Context, ref string) (string, error) {
+	d, err := s.devices.Resolve(ctx, ref)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", ErrDeviceNotFound
+	}
+	return d.ID, err
+}
+
+// Device returns a device given its UUID or name
+func (s *CommandService) Device(ctx context.Context, ref string) (models.Device, error) {
+	d, err := s.devices.Resolve(ctx, ref)
+	if errors.Is(err, repository.ErrNotFound) {
+		return d, ErrDeviceNotFound
+	}
+	return d, err
+}
+
+// stopContext returns a context canceled once stop is closed, so a
+// background loop does not wait on a query during shutdown
+func stopContext(stop <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// commandTimeout applies the default timeout and enforces the upper bound
+func commandTimeout(seconds int) (int, error) {
+	if seconds <= 0 {
+		return models.DefaultCommandTimeout, nil
+	}
+	if seconds > models.MaxCommandTimeout {
+		return 0, fmt.Errorf("%w: timeout_seconds must not exceed %d", ErrInvalidCommand, models.MaxCommandTimeout)
+	}
+	return seconds, nil
+}
+
+// normalizeParameters ensures parameters are a JSON object, defaulting to {}
+func normalizeParameters(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "{}", nil
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return "", fmt.Errorf("%w: parameters must be a JSON object", ErrInvalidCommand)
+	}
+	return string(raw), nil
+}
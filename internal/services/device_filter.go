@@ -0,0 +1,28 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"portofolionetworkapi/internal/models"
+)
+
+var ErrInvalidDeviceFilter = errors.New("invalid device filter")
+
+// validateDeviceFilter checks a bulk or rollout filter before the
+// repositories turn it into a query. A filter without criteria must set All
+// explicitly to target every device.
+func validateDeviceFilter(f models.DeviceFilter) error {
+	for _, id := range f.IDs {
+		if !models.IsValidUUID(id) {
+			return fmt.Errorf("%w: %q is not a valid device id", ErrInvalidDeviceFilter, id)
+		}
+	}
+	if f.Status != "" && !models.IsValidDeviceStatus(f.Status) {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidDeviceFilter, f.Status)
+	}
+	if len(f.IDs) == 0 && f.Location == "" && f.Status == "" && f.Name == "" && !f.All {
+		return fmt.Errorf("%w: no criteria given; set \"all\": true to target every device", ErrInvalidDeviceFilter)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -50,6 +51,44 @@ type OdooError struct {
 	} `json:"data"`
 }
 
+func (s *OdooService) Configured() bool {
+	return s.url != ""
+}
+
+// Ping checks that Odoo answers JSON-RPC (common.version, no login needed)
+func (s *OdooService) Ping(ctx context.Context) error {
+	if !s.Configured() {
+		return fmt.Errorf("odoo url is %w", ErrNotConfigured)
+	}
+
+	body, err := json.Marshal(OdooRequest{
+		Jsonrpc: "2.0",
+		Method:  "call",
+		Params:  map[string]interface{}{"service": "common", "method": "version", "args": []interface{}{}},
+		Id:      1,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal version payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/jsonrpc", s.url), bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create version request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute version request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("odoo returned non-200 status code for version: %d", resp.StatusCode)
+	}
+	return nil
+}
+
 func (s *OdooService) Login() error {
 	if s.url == "" {
 		return fmt.Errorf("odoo url is not configured")
@@ -109,30 +148,34 @@ type OdooCreateTicketResponse struct {
 	Error  *OdooError `json:"error,omitempty"`
 }
 
+// In Odoo, tickets are usually managed by the 'helpdesk.ticket' or 'project.task' module.
+// Since the codebase refers to 'ticketing management' we will try 'helpdesk.ticket'
+// If the user's Odoo doesn't use this, they can modify this code or let us know.
+const OdooTicketModel = "helpdesk.ticket"
+
+// TicketValues are the fields CreateTicket sets on the new ticket
+func TicketValues(title string, description string, teamID int, userID int) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        title,
+		"description": description,
+		"team_id":     teamID,
+		"user_id":     userID,
+	}
+}
+
 func (s *OdooService) CreateTicket(title string, description string, teamID int, userID int) (int, error) {
 	if s.uid == 0 {
 		return 0, fmt.Errorf("not logged into odoo")
 	}
 
-	// In Odoo, tickets are usually managed by the 'helpdesk.ticket' or 'project.task' module.
-	// Since the codebase refers to 'ticketing management' we will try 'helpdesk.ticket'
-	// If the user's Odoo doesn't use this, they can modify this code or let us know.
-	model := "helpdesk.ticket"
-
+	model := OdooTicketModel
 	args := []interface{}{
 		s.db,
 		s.uid,
 		s.password,
 		model,
 		"create",
-		[]map[string]interface{}{
-			{
-				"name":        title,
-				"description": description,
-				"team_id":     teamID,
-				"user_id":     userID,
-			},
-		},
+		[]map[string]interface{}{TicketValues(title, description, teamID, userID)},
 	}
 
 	payload := OdooRequest{
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+var (
+	ErrRolloutNotFound      = errors.New("rollout not found")
+	ErrInvalidRollout       = errors.New("invalid rollout")
+	ErrInvalidRolloutAction = errors.New("invalid rollout action")
+)
+
+// RolloutService orchestrates staged firmware updates. Devices are split
+// into waves: a canary wave followed by fixed-size batches. Each wave is
+// queued as firmware_update commands; the next wave only starts once every
+// device in the current one has finished and the failure rate stayed at or
+// below the rollout's threshold. Otherwise the rollout pauses until an
+// operator resumes or aborts it.
+type RolloutService struct {
+	rollouts repository.RolloutRepository
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewRolloutService(rollouts repository.RolloutRepository, interval time.Duration) *RolloutService {
+	return &RolloutService{
+		rollouts: rollouts,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Create plans the waves for every matching device that is not already on
+// the target version and starts the canary wave. The rollout belongs to the
+// tenant of the filter, which must be set.
+func (s *RolloutService) Create(ctx context.Context, req models.CreateRolloutRequest) (*models.Rollout, error) {
+	if req.CanaryPercent == 0 {
+		req.CanaryPercent = 10
+	}
+	if req.CanaryPercent < 1 || req.CanaryPercent > 100 {
+		return nil, fmt.Errorf("%w: canary_percent must be between 1 and 100", ErrInvalidRollout)
+	}
+	if req.BatchSize == 0 {
+		req.BatchSize = 10
+	}
+	if req.BatchSize < 1 {
+		return nil, fmt.Errorf("%w: batch_size must be positive", ErrInvalidRollout)
+	}
+	threshold := 0.2
+	if req.FailureThreshold != nil {
+		threshold = *req.FailureThreshold
+	}
+	if threshold < 0 || threshold > 1 {
+		return nil, fmt.Errorf("%w: failure_threshold must be between 0 and 1", ErrInvalidRollout)
+	}
+	if req.TimeoutSeconds == 0 {
+		req.TimeoutSeconds = 1800
+	}
+	if _, err := commandTimeout(req.TimeoutSeconds); err != nil {
+		return nil, err
+	}
+
+	if err := validateDeviceFilter(req.DeviceFilter); err != nil {
+		return nil, err
+	}
+	if !models.IsValidTenantID(req.DeviceFilter.Tenant) {
+		return nil, fmt.Errorf("%w: device_filter has no tenant", ErrInvalidRollout)
+	}
+
+	rollout := models.Rollout{
+		TenantID:         req.DeviceFilter.Tenant,
+		TargetVersion:    req.TargetVersion,
+		FirmwareURL:      req.FirmwareURL,
+		CanaryPercent:    req.CanaryPercent,
+		BatchSize:        req.BatchSize,
+		FailureThreshold: threshold,
+		TimeoutSeconds:   req.TimeoutSeconds,
+	}
+	var devices, totalWaves int
+	id, err := s.rollouts.Create(ctx, rollout, req.DeviceFilter, func(n int) ([]int, int, error) {
+		if n == 0 {
+			return nil, 0, fmt.Errorf("%w: no matching devices need version %s", ErrInvalidDeviceFilter, req.TargetVersion)
+		}
+		waves, total := planWaves(n, req.CanaryPercent, req.BatchSize)
+		devices, totalWaves = n, total
+		return waves, total, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[ROLLOUT] %s created: %d device(s) to %s in %d wave(s)", id, devices, req.TargetVersion, totalWaves)
+	if err := s.advance(ctx, id); err != nil {
+		log.Printf("[ERROR] Rollout %s failed to start: %v", id, err)
+	}
+	return s.Get(ctx, rollout.TenantID, id)
+}
+
+// planWaves assigns each device index a wave number. Wave 1 is the canary
+// (at least one device); the rest are split into batches of batchSize.
+func planWaves(n, canaryPercent, batchSize int) ([]int, int) {
+	canary := (n*canaryPercent + 99) / 100
+	if canary < 1 {
+		canary = 1
+	}
+	if canary > n {
+		canary = n
+	}
+
+	waves := make([]int, n)
+	total := 1
+	for i := range waves {
+		if i < canary {
+			waves[i] = 1
+			continue
+		}
+		waves[i] = 2 + (i-canary)/batchSize
+		total = waves[i]
+	}
+	return waves, total
+}
+
+// Get returns a rollout of tenant; rollouts of other tenants are not found
+func (s *RolloutService) Get(ctx context.Context, tenant, id string) (*models.Rollout, error) {
+	if !models.IsValidUUID(id) {
+		return nil, ErrRolloutNotFound
+	}
+
+	r, err := s.rollouts.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && r.TenantID != tenant) {
+		return nil, ErrRolloutNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// List returns the rollouts of tenant newest first, without per-device detail
+func (s *RolloutService) List(ctx context.Context, tenant string, limit int) ([]models.Rollout, error) {
+	return s.rollouts.List(ctx, tenant, limit)
+}
+
+// Pause stops a running rollout from starting further waves. Commands
+// already queued for the current wave keep running.
+func (s *RolloutService) Pause(ctx context.Context, tenant, id string) (*models.Rollout, error) {
+	err := s.transition(ctx, tenant, id, func(tx repository.RolloutTx) error {
+		if status := tx.Rollout().Status; status != models.RolloutStatusRunning {
+			return fmt.Errorf("%w: cannot pause a %s rollout", ErrInvalidRolloutAction, status)
+		}
+		return tx.SetStatus(models.RolloutStatusPaused, "paused by operator")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, tenant, id)
+}
+
+// Resume continues a paused rollout. If the current wave has finished, the
+// next wave starts immediately regardless of its failure rate — resuming is
+// the operator's decision to accept those failures.
+func (s *RolloutService) Resume(ctx context.Context, tenant, id string) (*models.Rollout, error) {
+	err := s.transition(ctx, tenant, id, func(tx repository.RolloutTx) error {
+		if status := tx.Rollout().Status; status != models.RolloutStatusPaused {
+			return fmt.Errorf("%w: cannot resume a %s rollout", ErrInvalidRolloutAction, status)
+		}
+		if err := tx.SetStatus(models.RolloutStatusRunning, ""); err != nil {
+			return err
+		}
+		return s.step(tx, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[ROLLOUT] %s resumed", id)
+	return s.Get(ctx, tenant, id)
+}
+
+// Abort ends a rollout. Devices in waves that never started are skipped.
+func (s *RolloutService) Abort(ctx context.Context, tenant, id string) (*models.Rollout, error) {
+	err := s.transition(ctx, tenant, id, func(tx repository.RolloutTx) error {
+		status := tx.Rollout().Status
+		if status != models.RolloutStatusRunning && status != models.RolloutStatusPaused {
+			return fmt.Errorf("%w: cannot abort a %s rollout", ErrInvalidRolloutAction, status)
+		}
+		if err := tx.SetStatus(models.RolloutStatusAborted, ""); err != nil {
+			return err
+		}
+		return tx.SkipPending("rollout aborted")
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[ROLLOUT] %s aborted", id)
+	return s.Get(ctx, tenant, id)
+}
+
+func (s *RolloutService) Start() {
+	log.Printf("[OK] Rollout engine started (interval %s)", s.interval)
+	go func() {
+		defer close(s.done)
+
+		ctx, cancel := stopContext(s.stop)
+		defer cancel()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.tick(ctx)
+			}
+		}
+	}()
+}
+
+func (s *RolloutService) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *RolloutService) tick(ctx context.Context) {
+	if err := s.rollouts.SyncDevices(ctx); err != nil {
+		log.Printf("[ERROR] Rollout device sync failed: %v", err)
+		return
+	}
+
+	ids, err := s.rollouts.Running(ctx)
+	if err != nil {
+		log.Printf("[ERROR] Rollout scan failed: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if err := s.advance(ctx, id); err != nil {
+			log.Printf("[ERROR] Rollout %s: %v", id, err)
+		}
+	}
+}
+
+// advance moves a running rollout forward if no other instance holds it
+func (s *RolloutService) advance(ctx context.Context, id string) error {
+	err := s.rollouts.Update(ctx, id, true, func(tx repository.RolloutTx) error {
+		if tx.Rollout().Status != models.RolloutStatusRunning {
+			return nil
+		}
+		return s.step(tx, false)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// transition runs an operator action against a locked rollout of tenant
+func (s *RolloutService) transition(ctx context.Context, tenant, id string, fn func(tx repository.RolloutTx) error) error {
+	if !models.IsValidUUID(id) {
+		return ErrRolloutNotFound
+	}
+
+	err := s.rollouts.Update(ctx, id, false, func(tx repository.RolloutTx) error {
+		if tx.Rollout().TenantID != tenant {
+			return ErrRolloutNotFound
+		}
+		return fn(tx)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrRolloutNotFound
+	}
+	return err
+}
+
+// step evaluates the current wave and starts the next one, pauses, or
+// completes the rollout. skipGate bypasses the failure threshold check.
+func (s *RolloutService) step(tx repository.RolloutTx, skipGate bool) error {
+	r := tx.Rollout()
+	if r.CurrentWave > 0 {
+		wave, err := tx.WaveProgress(r.CurrentWave)
+		if err != nil {
+			return err
+		}
+		if wave.Pending+wave.InProgress > 0 {
+			return nil
+		}
+
+		if !skipGate && wave.Total > 0 {
+			rate := float64(wave.Failed) / float64(wave.Total)
+			if rate > r.FailureThreshold {
+				reason := fmt.Sprintf("wave %d failure rate %.0f%% exceeded threshold %.0f%%",
+					r.CurrentWave, rate*100, r.FailureThreshold*100)
+				log.Printf("[ROLLOUT] %s paused: %s", r.ID, reason)
+				return tx.SetStatus(models.RolloutStatusPaused, reason)
+			}
+		}
+	}
+
+	if r.CurrentWave >= r.TotalWaves {
+		log.Printf("[ROLLOUT] %s completed", r.ID)
+		return tx.SetStatus(models.RolloutStatusCompleted, "")
+	}
+
+	return s.startWave(tx, r.CurrentWave+1)
+}
+
+// startWave queues a firmware_update command for every pending device in the wave
+func (s *RolloutService) startWave(tx repository.RolloutTx, wave int) error {
+	r := tx.Rollout()
+	params, err := json.Marshal(map[string]string{
+		"version":      r.TargetVersion,
+		"firmware_url": r.FirmwareURL,
+		"rollout_id":   r.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	queued, err := tx.StartWave(wave, models.Command{
+		Type:           models.FirmwareUpdateCommand,
+		Parameters:     json.RawMessage(params),
+		TimeoutSeconds: r.TimeoutSeconds,
+	})
+	// Over the command quota the wave waits for an operator to resume it
+	var quotaErr *repository.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		reason := fmt.Sprintf("wave %d not started: %v", wave, quotaErr)
+		log.Printf("[ROLLOUT] %s paused: %s", r.ID, reason)
+		return tx.SetStatus(models.RolloutStatusPaused, reason)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[ROLLOUT] %s wave %d/%d started on %d device(s)", r.ID, wave, r.TotalWaves, queued)
+	return nil
+}
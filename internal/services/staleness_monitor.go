@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"portofolionetworkapi/internal/repository"
+)
+
+// StalenessMonitor marks devices offline when their heartbeats stop and
+// raises a PROBLEM alert through the orchestrator. A RESOLVED alert is sent
+// once the device heartbeats again.
+type StalenessMonitor struct {
+	orchestrator *AlertOrchestrator
+	devices      repository.DeviceRepository
+	interval     time.Duration
+	grace        time.Duration
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+func NewStalenessMonitor(orchestrator *AlertOrchestrator, devices repository.DeviceRepository, interval, grace time.Duration) *StalenessMonitor {
+	return &StalenessMonitor{
+		orchestrator: orchestrator,
+		devices:      devices,
+		interval:     interval,
+		grace:        grace,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+func (m *StalenessMonitor) Start() {
+	log.Printf("[OK] Staleness monitor started (interval %s, grace %s)", m.interval, m.grace)
+	go m.supervise()
+}
+
+// Stop signals the worker and waits for the current scan to finish
+func (m *StalenessMonitor) Stop() {
+	close(m.stop)
+	<-m.done
+}
+
+// supervise restarts the scan loop if it panics, backing off between attempts
+func (m *StalenessMonitor) supervise() {
+	defer close(m.done)
+
+	backoff := time.Second
+	for {
+		if m.run() {
+			return
+		}
+
+		log.Printf("[WARN] Staleness monitor restarting in %s", backoff)
+		select {
+		case <-m.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+// run returns true when the monitor was stopped, false after a panic
+func (m *StalenessMonitor) run() (stopped bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[ERROR] Staleness monitor panic: %v", r)
+			stopped = false
+		}
+	}()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return true
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+func (m *StalenessMonitor) check() {
+	// MarkStale claims each device once, so several instances can run the
+	// monitor without raising duplicate alerts
+	ctx := context.Background()
+	stale, err := m.devices.MarkStale(ctx, m.grace)
+	if err != nil {
+		log.Printf("[ERROR] Staleness scan failed: %v", err)
+	}
+	for _, d := range stale {
+		log.Printf("[STALE] %s (%s) marked offline, last seen %s", d.Name, d.IPAddress, d.LastSeen.Format(time.RFC3339))
+		m.orchestrator.HandleAlert(AlertPayload{
+			EventID:   "stale-" + d.ID,
+			Device:    d.Name,
+			IP:        d.IPAddress,
+			Severity:  "HIGH",
+			Problem:   fmt.Sprintf("No heartbeat for %s", time.Since(d.LastSeen).Round(time.Second)),
+			Status:    "PROBLEM",
+			SLA:       "AT_RISK",
+			Timestamp: time.Now(),
+		}, 0)
+	}
+
+	recovered, err := m.devices.MarkRecovered(ctx)
+	if err != nil {
+		log.Printf("[ERROR] Recovery scan failed: %v", err)
+	}
+	for _, d := range recovered {
+		log.Printf("[STALE] %s (%s) is heartbeating again", d.Name, d.IPAddress)
+		m.orchestrator.HandleAlert(AlertPayload{
+			EventID:   "stale-" + d.ID,
+			Device:    d.Name,
+			IP:        d.IPAddress,
+			Severity:  "HIGH",
+			Problem:   "Heartbeat restored",
+			Status:    "RESOLVED",
+			SLA:       "OK",
+			Timestamp: time.Now(),
+		}, 0)
+	}
+}
@@ -2,10 +2,13 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -23,20 +26,56 @@ func NewTelegramService(token, chatID string) *TelegramService {
 	}
 }
 
-func (s *TelegramService) SendMessage(message string) error {
-	if s.token == "" || s.chatID == "" {
-		return fmt.Errorf("telegram token or chat ID is not configured")
+func (s *TelegramService) Configured() bool {
+	return s.token != "" && s.chatID != ""
+}
+
+// Ping checks that the Bot API is reachable and accepts the token (getMe)
+func (s *TelegramService) Ping(ctx context.Context) error {
+	if !s.Configured() {
+		return fmt.Errorf("telegram token or chat ID is %w", ErrNotConfigured)
 	}
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", s.token)
-	
-	payload := map[string]interface{}{
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("https://api.telegram.org/bot%s/getMe", s.token), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create telegram request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// *url.Error embeds the URL, which contains the token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from telegram: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MessagePayload is the sendMessage body SendMessage posts for message
+func (s *TelegramService) MessagePayload(message string) map[string]interface{} {
+	return map[string]interface{}{
 		"chat_id":    s.chatID,
 		"text":       message,
 		"parse_mode": "HTML",
 	}
+}
+
+func (s *TelegramService) SendMessage(message string) error {
+	if s.token == "" || s.chatID == "" {
+		return fmt.Errorf("telegram token or chat ID is not configured")
+	}
+
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", s.token)
 
-	body, err := json.Marshal(payload)
+	body, err := json.Marshal(s.MessagePayload(message))
 	if err != nil {
 		return fmt.Errorf("failed to marshal telegram payload: %w", err)
 	}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+var (
+	ErrTenantNotFound = repository.ErrTenantNotFound
+	ErrTenantExists   = repository.ErrDuplicateTenant
+	ErrInvalidTenant  = errors.New("invalid tenant")
+)
+
+// TenantService manages tenants and reports their quota usage
+type TenantService struct {
+	tenants repository.TenantRepository
+}
+
+func NewTenantService(tenants repository.TenantRepository) *TenantService {
+	return &TenantService{tenants: tenants}
+}
+
+func (s *TenantService) List() ([]models.Tenant, error) {
+	return s.tenants.List(context.Background())
+}
+
+func (s *TenantService) Get(id string) (*models.Tenant, error) {
+	t, err := s.tenants.Get(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *TenantService) Create(req models.CreateTenantRequest) (*models.Tenant, error) {
+	if !models.IsValidTenantID(req.ID) {
+		return nil, fmt.Errorf("%w: id must be a lowercase slug of letters, digits and '-' (max 64)", ErrInvalidTenant)
+	}
+	if err := validateQuotas(req.Quotas); err != nil {
+		return nil, err
+	}
+
+	t, err := s.tenants.Create(context.Background(), req.ID, req.Name, req.Quotas)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Update replaces all quotas; a nil quota removes the limit
+func (s *TenantService) Update(id string, req models.UpdateTenantRequest) (*models.Tenant, error) {
+	if err := validateQuotas(req.Quotas); err != nil {
+		return nil, err
+	}
+
+	t, err := s.tenants.Update(context.Background(), id, req.Name, req.Quotas)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func validateQuotas(q models.TenantQuotas) error {
+	quotas := []struct {
+		name  string
+		value *int
+	}{
+		{"max_devices", q.MaxDevices},
+		{"max_commands_per_hour", q.MaxCommandsPerHour},
+		{"max_alerts_per_hour", q.MaxAlertsPerHour},
+	}
+	for _, quota := range quotas {
+		if quota.value != nil && *quota.value < 0 {
+			return fmt.Errorf("%w: %s must be >= 0 or null", ErrInvalidTenant, quota.name)
+		}
+	}
+	return nil
+}
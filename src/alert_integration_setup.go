@@ -2,65 +2,91 @@ package main
 
 import (
 	"log"
-	"os"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 
 	// ✅ Sama dengan import di main.go — dari internal/
+	"portofolionetworkapi/internal/config"
 	"portofolionetworkapi/internal/handlers"
+	"portofolionetworkapi/internal/middleware"
+	"portofolionetworkapi/internal/repository"
 	"portofolionetworkapi/internal/services"
 )
 
-func setupAlertIntegration(router *gin.Engine) {
-	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-	chatID := os.Getenv("TELEGRAM_CHAT_ID")
-	odooURL := os.Getenv("ODOO_URL")
-	odooDB := os.Getenv("ODOO_DB")
-	odooUser := os.Getenv("ODOO_USER")
-	odooPass := os.Getenv("ODOO_PASSWORD")
-
-	if botToken == "" || chatID == "" {
+// setupAlertIntegration registers the signed Zabbix webhook on v1 and the
+// test alert route on the /alerts group, and starts the staleness monitor.
+// Telegram and Odoo settings follow config reloads. Returns the alert
+// channels for the readiness check.
+func setupAlertIntegration(store *config.Store, v1, alerts *gin.RouterGroup, repos repository.Repositories, stop *shutdown) []handlers.Dependency {
+	cfg := store.Current()
+	if cfg.Telegram.BotToken == "" {
 		log.Println("[WARN] TELEGRAM_BOT_TOKEN / TELEGRAM_CHAT_ID not set")
 	}
-	if odooURL == "" {
+	if cfg.Odoo.URL == "" {
 		log.Println("[WARN] ODOO_URL not set — Odoo ticketing disabled")
 	}
 
-	telegram := services.NewTelegramService(botToken, chatID)
-	odoo := services.NewOdooService(odooURL, odooDB, odooUser, odooPass)
+	orchestrator := services.NewAlertOrchestrator(newNotifiers(cfg), repos.Devices, repos.Alerts)
+	store.OnReload(func(cfg *config.Config) {
+		orchestrator.SetNotifiers(newNotifiers(cfg))
+		log.Printf("[OK] Alert notifiers reloaded (Odoo team %d)", cfg.Odoo.TeamID)
+	})
+	// Runs after the HTTP server and the monitor stop feeding it alerts
+	stop.add("alert deliveries", orchestrator.Drain)
+	alertHandler := handlers.NewAlertHandler(orchestrator)
 
-	if odooURL != "" {
-		if err := odoo.Login(); err != nil {
-			log.Printf("[WARN] Odoo login failed: %v", err)
-		} else {
-			log.Println("[OK] Odoo connected")
-		}
+	staleInterval := cfg.Staleness.CheckInterval
+	staleGrace := cfg.Staleness.GracePeriod
+	if staleInterval > 0 {
+		monitor := services.NewStalenessMonitor(orchestrator, repos.Devices, staleInterval, staleGrace)
+		monitor.Start()
+		stop.addFunc("staleness monitor", monitor.Stop)
+	} else {
+		log.Println("[WARN] STALENESS_CHECK_INTERVAL is 0 — staleness monitor disabled")
 	}
 
-	teamID := envInt("ODOO_TEAM_ID", 1)
-	defaultUserID := envInt("ODOO_DEFAULT_USER_ID", 1)
-
-	orchestrator := services.NewAlertOrchestrator(telegram, odoo, teamID)
-	alertHandler := handlers.NewAlertHandler(orchestrator, defaultUserID)
-
-	v1 := router.Group("/api/v1")
-	{
-		v1.POST("/webhooks/zabbix", alertHandler.HandleZabbixWebhook)
-		v1.POST("/alerts/test", alertHandler.HandleZabbixWebhook)
+	// Signature, timestamp, replay and source IP checks; validated by config
+	zabbix := cfg.Webhooks.Zabbix
+	allowedIPs, _ := config.ParseIPList(zabbix.AllowedIPs)
+	if len(allowedIPs) > 0 && cfg.App.TrustedProxies == "" {
+		log.Println("[WARN] ZABBIX_WEBHOOK_ALLOWED_IPS is set but TRUSTED_PROXIES is not — X-Forwarded-For is trusted from any peer")
 	}
+	zabbixVerifier := middleware.NewWebhookVerifier("zabbix", middleware.WebhookOptions{
+		Secret:          zabbix.Secret,
+		SignatureHeader: zabbix.SignatureHeader,
+		TimestampHeader: zabbix.TimestampHeader,
+		Tolerance:       zabbix.Tolerance,
+		AllowedIPs:      allowedIPs,
+	})
+	stop.addFunc("zabbix webhook replay cache", zabbixVerifier.Stop)
+	v1.POST("/webhooks/zabbix", zabbixVerifier.Middleware(), alertHandler.HandleZabbixWebhook)
+	// Dry run only: nothing is sent, ticketed or recorded
+	alerts.POST("/test", alertHandler.DryRunZabbixWebhook)
 
 	log.Println("[OK] Alert routes registered")
+
+	return []handlers.Dependency{
+		{Name: "odoo", Ping: orchestrator.PingOdoo},
+		{Name: "telegram", Ping: orchestrator.PingTelegram},
+	}
 }
 
-func envInt(key string, def int) int {
-	v := os.Getenv(key)
-	if v == "" {
-		return def
+// newNotifiers builds the alert channels for cfg, logging into Odoo first
+// so the swap never exposes a session-less client
+func newNotifiers(cfg *config.Config) *services.Notifiers {
+	odoo := services.NewOdooService(cfg.Odoo.URL, cfg.Odoo.DB, cfg.Odoo.User, cfg.Odoo.Password)
+	if odoo.Configured() {
+		if err := odoo.Login(); err != nil {
+			log.Printf("[WARN] Odoo login failed: %v", err)
+		} else {
+			log.Println("[OK] Odoo connected")
+		}
 	}
-	n, err := strconv.Atoi(v)
-	if err != nil {
-		return def
+
+	return &services.Notifiers{
+		Telegram:      services.NewTelegramService(cfg.Telegram.BotToken, cfg.Telegram.ChatID),
+		Odoo:          odoo,
+		TeamID:        cfg.Odoo.TeamID,
+		DefaultUserID: cfg.Odoo.DefaultUserID,
 	}
-	return n
-}
\ No newline at end of file
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"portofolionetworkapi/internal/config"
+	"portofolionetworkapi/internal/handlers"
+	"portofolionetworkapi/internal/repository"
+	"portofolionetworkapi/internal/services"
+)
+
+// setupFleetFeatures starts the workers and registers the routes for the
+// command queue, rollouts, tenant admin and demo mode. Demo mode resets the
+// Postgres inventory, so on SQLite its routes answer 501. The user route
+// groups come with their permission checks from main.
+func setupFleetFeatures(cfg *config.Config, routes routeGroups, repos repository.Repositories, postgres bool, stop *shutdown) {
+	v1, agent, admin := routes.v1, routes.agent, routes.admin
+	// Command queue
+	commandService := services.NewCommandService(repos.Devices, repos.Commands, cfg.Commands.BulkMaxDevices)
+	commandService.StartSweeper(cfg.Commands.TimeoutSweepInterval)
+	stop.addFunc("command sweeper", commandService.StopSweeper)
+	commandHandler := handlers.NewCommandHandler(commandService)
+
+	// Firmware rollouts
+	rolloutService := services.NewRolloutService(repos.Rollouts, cfg.Rollouts.TickInterval)
+	rolloutService.Start()
+	stop.addFunc("rollout engine", rolloutService.Stop)
+	rolloutHandler := handlers.NewRolloutHandler(rolloutService)
+
+	// Tenants and quotas
+	tenantHandler := handlers.NewTenantHandler(services.NewTenantService(repos.Tenants))
+
+	agent.GET("/commands/:deviceId", commandHandler.PollCommands)
+	agent.POST("/commands/:commandId/result", commandHandler.ReportCommandResult)
+
+	routes.deviceCommands.GET("/:id/commands", commandHandler.ListDeviceCommands)
+	routes.deviceCommands.POST("/:id/commands", commandHandler.EnqueueCommand)
+	routes.deviceCommands.POST("/bulk/configure", commandHandler.BulkConfigure)
+
+	{
+		admin.GET("/tenants", tenantHandler.ListTenants)
+		admin.POST("/tenants", tenantHandler.CreateTenant)
+		admin.GET("/tenants/:id", tenantHandler.GetTenant)
+		admin.PUT("/tenants/:id", tenantHandler.UpdateTenant)
+	}
+
+	if postgres {
+		v1.GET("/demo/status", handlers.GetDemoStatus)
+		admin.POST("/demo/reset", handlers.ResetDemo)
+		admin.GET("/demo/resets", handlers.ListDemoResets)
+		admin.POST("/demo/resets/:id/undo", handlers.UndoDemoReset)
+	} else {
+		v1.GET("/demo/status", handlers.DemoUnavailable)
+		admin.POST("/demo/reset", handlers.DemoUnavailable)
+		admin.GET("/demo/resets", handlers.DemoUnavailable)
+		admin.POST("/demo/resets/:id/undo", handlers.DemoUnavailable)
+	}
+
+	routes.commands.GET("/commands/:id", commandHandler.GetCommand)
+	routes.commands.GET("/executions/:id", commandHandler.GetExecution)
+
+	rollouts := routes.rollouts
+	{
+		rollouts.GET("", rolloutHandler.ListRollouts)
+		rollouts.POST("", rolloutHandler.CreateRollout)
+		rollouts.GET("/:id", rolloutHandler.GetRollout)
+		rollouts.POST("/:id/pause", rolloutHandler.PauseRollout)
+		rollouts.POST("/:id/resume", rolloutHandler.ResumeRollout)
+		rollouts.POST("/:id/abort", rolloutHandler.AbortRollout)
+	}
+}
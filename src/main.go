@@ -1,41 +1,97 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	
+	"portofolionetworkapi/internal/config"
 	"portofolionetworkapi/internal/database"
 	"portofolionetworkapi/internal/handlers"
 	"portofolionetworkapi/internal/middleware"
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+	"portofolionetworkapi/internal/services"
 )
 
 func main() {
-	godotenv.Load()
+	// Fail fast on malformed settings instead of running on defaults. The
+	// loader also serves reloads (SIGHUP, POST /admin/config/reload).
+	loader := config.NewLoader(".env")
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	store := config.NewStore(loader, cfg)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(cfg, os.Args[2:])
+		return
+	}
 
-	if os.Getenv("APP_ENV") == "production" {
+	if cfg.Production() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	// Connect to database
-	if err := database.Connect(); err != nil {
-		log.Fatal("Failed to connect to database:", err)
+	driver := cfg.Database.Driver
+	// Every feature runs on both drivers except demo mode, which resets
+	// the Postgres inventory
+	postgres := driver == database.DriverPostgres
+
+	// Demo mode (device cap + inventory reset) is opt-in and never runs in
+	// production. MAX_DEVICES=0 keeps demo mode without the cap.
+	demoMode := cfg.Demo.Enabled
+	if demoMode && cfg.Production() {
+		log.Println("[WARN] DEMO_MODE ignored because APP_ENV=production")
+		demoMode = false
 	}
+	if demoMode && !postgres {
+		log.Println("[WARN] DEMO_MODE ignored because it requires DB_DRIVER=postgres")
+		demoMode = false
+	}
+	database.ConfigureDemoMode(demoMode, cfg.Demo.MaxDevices, cfg.Demo.ResetInterval)
+
+	// Connect to database, waiting for it to come up
+	db := openDatabase(cfg)
 
-	// Run migrations
-	if err := database.RunMigrations(); err != nil {
-		log.Println("Warning: Migration failed:", err)
+	// Run migrations; AUTO_MIGRATE=false leaves it to "api migrate up"
+	if cfg.Database.AutoMigrate {
+		if err := database.RunMigrations(db, driver); err != nil {
+			log.Fatal("Failed to run migrations:", err)
+		}
 	}
+	// Background workers register their stop hooks here; the database is
+	// closed last
+	var stop shutdown
+	stop.add("database", func(context.Context) error { return db.Close() })
+	database.StartDemoAutoReset()
+	stop.addFunc("demo auto-reset", database.StopDemoAutoReset)
 
 	router := gin.Default()
+	if cfg.App.TrustedProxies != "" {
+		proxies := strings.Split(cfg.App.TrustedProxies, ",")
+		for i := range proxies {
+			proxies[i] = strings.TrimSpace(proxies[i])
+		}
+		if err := router.SetTrustedProxies(proxies); err != nil {
+			log.Fatal("Invalid TRUSTED_PROXIES:", err)
+		}
+	}
 
 	// CORS
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -44,7 +100,9 @@ func main() {
 	})
 
 	// Rate limiting - 100 requests per minute per IP
-	router.Use(middleware.RateLimit(100))
+	limiter := middleware.NewRateLimiter(100)
+	stop.addFunc("rate limiter", limiter.Stop)
+	router.Use(limiter.Middleware())
 
 	// Static files
 	router.Static("/static", "./static")
@@ -52,39 +110,170 @@ func main() {
 		c.File("./static/index.html")
 	})
 
-	// Health (no rate limit)
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy", "service": "netops-integration-api"})
-	})
+	repos := repository.New(driver, db)
+	deviceHandler := handlers.NewDeviceHandler(repos)
+	// Per-device agent keys; AGENT_API_KEY stays accepted as an unbound
+	// fleet key while agents move over
+	apiKeys := services.NewAPIKeyService(repos.APIKeys, cfg.Auth.AgentKeyGrace)
 
 	// API routes with rate limiting
 	v1 := router.Group("/api/v1")
-	{
-		v1.POST("/agent/heartbeat", func(c *gin.Context) {
-			c.JSON(200, gin.H{"message": "Heartbeat received"})
-		})
-
-		devices := v1.Group("/devices")
-		{
-			devices.GET("", handlers.ListDevices)
-			devices.POST("", handlers.CreateDevice)
-			devices.PUT("/:id", handlers.UpdateDevice)
-			devices.DELETE("/:id", handlers.DeleteDevice)
-		}
-	}
+	agent := v1.Group("/agent", middleware.AgentAuth(apiKeys, cfg.Auth.AgentAPIKey, cfg.Auth.AgentAuthDisabled))
+	agent.POST("/heartbeat", deviceHandler.RecordHeartbeat)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = os.Getenv("APP_PORT")
-	}
-	if port == "" {
-		port = "8080"
+	// Dashboard users log in for short-lived access tokens; device,
+	// command, rollout and test-alert routes require one
+	auth := services.NewAuthService(repos.Users, cfg.Auth.JWTSecret, cfg.Auth.AccessTokenTTL, cfg.Auth.RefreshTokenTTL)
+	requireUser := middleware.UserAuth(auth)
+	authHandler := handlers.NewAuthHandler(auth)
+	authHandler.Register(v1.Group("/auth"), requireUser)
+	user := v1.Group("", requireUser)
+
+	// Permissions per route group: Read guards GET, Delete guards DELETE
+	// and Write the other methods. Roles scoped to a location pass the
+	// device groups, whose handlers then check the device's location.
+	routes := routeGroups{
+		devices: user.Group("/devices", middleware.Tenant(), middleware.Authorize(middleware.Permissions{
+			Read:           models.PermDevicesRead,
+			Write:          models.PermDevicesWrite,
+			Delete:         models.PermDevicesDelete,
+			LocationScoped: true,
+		})),
+		deviceCommands: user.Group("/devices", middleware.Tenant(), middleware.Authorize(middleware.Permissions{
+			Read:           models.PermCommandsRead,
+			Write:          models.PermCommandsExecute,
+			LocationScoped: true,
+		})),
+		commands: user.Group("", middleware.Tenant(), middleware.Authorize(middleware.Permissions{
+			Read:           models.PermCommandsRead,
+			LocationScoped: true,
+		})),
+		rollouts: user.Group("/rollouts", middleware.Tenant(), middleware.Authorize(middleware.Permissions{
+			Read:  models.PermRolloutsRead,
+			Write: models.PermRolloutsManage,
+		})),
+		alerts: user.Group("/alerts", middleware.Authorize(middleware.Permissions{
+			Write: models.PermAlertsTest,
+		})),
 	}
+	deviceHandler.Register(routes.devices)
+
+	admin := v1.Group("/admin", middleware.AdminAuth(cfg.Auth.AdminAPIKey))
+	configHandler := handlers.NewConfigHandler(store)
+	admin.GET("/config", configHandler.GetConfig)
+	admin.POST("/config/reload", configHandler.ReloadConfig)
+	handlers.NewAPIKeyHandler(apiKeys, repos.Devices).Register(admin)
+	authHandler.RegisterAdmin(admin)
+	routes.v1, routes.agent, routes.admin = v1, agent, admin
+
+	setupFleetFeatures(cfg, routes, repos, postgres, &stop)
+
+	port := strconv.Itoa(cfg.App.Port)
 
 	log.Printf("🚀 Server starting on port %s", port)
 	log.Printf("🛡️ Rate limit: 100 requests/min per IP")
 
-	setupAlertIntegration(router)
-	
-	router.Run(":" + port)
-}
\ No newline at end of file
+	dependencies := setupAlertIntegration(store, v1, routes.alerts, repos, &stop)
+
+	// Health: liveness, and readiness covering the database, migrations and
+	// the alert channels. /health is kept as an alias of /health/ready.
+	health, err := handlers.NewHealthHandler(db, driver,
+		cfg.Health.CheckTimeout, cfg.Health.DependencyCache, dependencies...)
+	if err != nil {
+		log.Fatal("Failed to set up health checks:", err)
+	}
+	router.GET("/health", health.Ready)
+	router.GET("/health/live", health.Live)
+	router.GET("/health/ready", health.Ready)
+
+	srv := &http.Server{Addr: ":" + port, Handler: router}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	// SIGTERM (Railway, docker stop) and Ctrl+C start a graceful shutdown:
+	// stop accepting connections, let in-flight requests finish (an alert
+	// webhook may be between Telegram and Odoo), then stop the workers
+	signals, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	go reloadOnSIGHUP(signals, store)
+	select {
+	case err := <-serveErr:
+		log.Fatal("Server failed:", err)
+	case <-signals.Done():
+	}
+	cancel()
+
+	timeout := cfg.App.ShutdownTimeout
+	log.Printf("[INFO] Shutting down, draining for up to %s", timeout)
+	ctx, cancelDrain := context.WithTimeout(context.Background(), timeout)
+	defer cancelDrain()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("[WARN] HTTP server did not drain: %v", err)
+	} else {
+		log.Println("[OK] HTTP server drained")
+	}
+	stop.run(ctx)
+	log.Println("[OK] Shutdown complete")
+}
+
+// routeGroups are the API route groups. The user groups each carry the
+// permission check for their routes.
+type routeGroups struct {
+	v1, agent, admin *gin.RouterGroup
+
+	devices        *gin.RouterGroup
+	deviceCommands *gin.RouterGroup
+	commands       *gin.RouterGroup
+	rollouts       *gin.RouterGroup
+	alerts         *gin.RouterGroup
+}
+
+// openDatabase applies the pool settings and connects, retrying while the
+// database starts
+func openDatabase(cfg *config.Config) *sql.DB {
+	d := cfg.Database
+	database.ConfigurePool(database.PoolConfig{
+		MaxOpenConns:    d.MaxOpenConns,
+		MaxIdleConns:    d.MaxIdleConns,
+		ConnMaxLifetime: d.ConnMaxLifetime,
+		ConnMaxIdleTime: d.ConnMaxIdleTime,
+	}, database.RetryPolicy{
+		Attempts:     d.ConnectAttempts,
+		InitialDelay: d.ConnectRetryDelay,
+		MaxDelay:     d.ConnectRetryMaxDelay,
+	})
+
+	db, err := database.Open(d.Driver, d.DSN())
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	return db
+}
+
+// reloadOnSIGHUP reloads the configuration on every SIGHUP until ctx is done
+func reloadOnSIGHUP(ctx context.Context, store *config.Store) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Println("[INFO] SIGHUP received, reloading configuration")
+			result, err := store.Reload()
+			if err != nil {
+				log.Printf("[ERROR] Config reload failed, keeping the running configuration: %v", err)
+				continue
+			}
+			if len(result.RestartRequired) > 0 {
+				log.Printf("[WARN] Changed settings need a restart to apply: %v", result.RestartRequired)
+			}
+			log.Printf("[OK] Config reloaded (applied: %v)", result.Applied)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"portofolionetworkapi/internal/config"
+	"portofolionetworkapi/internal/database"
+)
+
+const migrateUsage = `usage: api migrate <command>
+
+commands:
+  up [version]   apply pending migrations, up to version if given
+  down [steps]   roll back the last applied migrations (default 1, at least 1)
+  status         list migrations and whether they are applied`
+
+// runMigrateCommand implements "api migrate ..." and exits the process
+func runMigrateCommand(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+
+	n := 0
+	if len(args) > 1 {
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 0 {
+			log.Fatalf("invalid argument %q: expected a non-negative number", args[1])
+		}
+	}
+	switch {
+	case args[0] == "down" && len(args) == 1:
+		n = 1
+	case args[0] == "down" && n < 1:
+		// Zero steps would otherwise read as the default of one
+		fmt.Println(migrateUsage)
+		log.Fatalf("invalid argument %q: down needs at least 1 step", args[1])
+	}
+
+	db := openDatabase(cfg)
+	migrator, err := database.NewMigrator(db, cfg.Database.Driver)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx, n)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d migration(s) applied\n", len(applied))
+	case "down":
+		reverted, err := migrator.Down(ctx, n)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d migration(s) rolled back\n", len(reverted))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if st.Modified {
+				state += " (file changed since applied)"
+			}
+			fmt.Printf("%03d_%-40s %s\n", st.Version, st.Name, state)
+		}
+	default:
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+}
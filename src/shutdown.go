@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// shutdown collects the stop hooks of background workers. They run in
+// reverse registration order after the HTTP server has drained, so a worker
+// never outlives something it depends on.
+type shutdown struct {
+	hooks []shutdownHook
+}
+
+type shutdownHook struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+func (s *shutdown) add(name string, stop func(ctx context.Context) error) {
+	s.hooks = append(s.hooks, shutdownHook{name: name, stop: stop})
+}
+
+// addFunc registers a Stop method that blocks until the worker has finished
+// its current iteration; shutdown stops waiting for it when ctx is done
+func (s *shutdown) addFunc(name string, stop func()) {
+	s.add(name, func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			stop()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+func (s *shutdown) run(ctx context.Context) {
+	for i := len(s.hooks) - 1; i >= 0; i-- {
+		h := s.hooks[i]
+		if err := h.stop(ctx); err != nil {
+			log.Printf("[WARN] Stopping %s: %v", h.name, err)
+			continue
+		}
+		log.Printf("[OK] Stopped %s", h.name)
+	}
+}
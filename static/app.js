@@ -44,10 +44,14 @@ const LIMIT_RESET_KEY = 'netops_device_limit_reset_at';
 let deviceLimitWarningShown = false;
 let deviceLimitReachedShown = false;
 let isAutoResetting = false;
+// Quota reported by GET /api/v1/demo/status; null until loaded or when the
+// API is unreachable, in which case the local limit and timer are used
+let serverLimit = null;
 
 document.addEventListener('DOMContentLoaded', () => {
     loadDevices();
     updateStats();
+    fetchDemoStatus();
 
     const addDeviceForm = document.getElementById('add-device-form');
     const editDeviceForm = document.getElementById('edit-device-form');
@@ -132,6 +136,7 @@ document.addEventListener('DOMContentLoaded', () => {
     setInterval(() => {
         loadDevices();
         updateStats();
+        fetchDemoStatus();
     }, 30000);
 
     setInterval(() => {
@@ -366,8 +371,24 @@ function handleAddDevice(e) {
     showNotification('✅ Device added successfully!');
 }
 
+// Load the server-enforced quota; falls back to the local limit on failure
+async function fetchDemoStatus() {
+    try {
+        const res = await fetch('/api/v1/demo/status');
+        if (!res.ok) throw new Error(`HTTP ${res.status}`);
+        const status = await res.json();
+        serverLimit = status.enabled ? status : null;
+    } catch (err) {
+        serverLimit = null;
+    }
+}
+
 // Show limit warning if needed
 function checkDeviceLimit(meta = {}) {
+    if (serverLimit) {
+        return checkServerDeviceLimit(meta);
+    }
+
     const total = Number.isFinite(meta.total) ? meta.total : devices.length;
     const limit = Number.isFinite(meta.limit) ? meta.limit : DEVICE_LIMIT;
     const warningRatio = Number.isFinite(meta.warningRatio) ? meta.warningRatio : DEVICE_LIMIT_WARNING_RATIO;
@@ -388,11 +409,33 @@ function checkDeviceLimit(meta = {}) {
         return { total, limit, warningAt, reached: false, resetAt: null };
     }
 
+    return applyDeviceLimitState({ total, limit, warningAt, reached, remainingMs, resetAt });
+}
+
+// The server owns the count, the limit and the reset time; the countdown
+// only ticks locally between status polls
+function checkServerDeviceLimit(meta = {}) {
+    const total = serverLimit.device_count;
+    const limit = serverLimit.max_devices;
+    const warningRatio = Number.isFinite(meta.warningRatio) ? meta.warningRatio : DEVICE_LIMIT_WARNING_RATIO;
+    const warningAt = Math.max(1, Math.floor(limit * warningRatio));
+    const reached = serverLimit.limit_reached;
+    const resetAt = reached ? Date.parse(serverLimit.next_reset_at) : null;
+    const remainingMs = resetAt ? Math.max(0, resetAt - Date.now()) : 0;
+
+    if (reached && remainingMs === 0) {
+        fetchDemoStatus();
+    }
+
+    return applyDeviceLimitState({ total, limit, warningAt, reached, remainingMs, resetAt });
+}
+
+function applyDeviceLimitState({ total, limit, warningAt, reached, remainingMs, resetAt }) {
     updateLimitUI({ total, limit, warningAt, reached, remainingMs, resetAt });
 
     if (reached) {
         if (!deviceLimitReachedShown) {
-            showNotification(`⚠️ Device limit reached (${total}/${limit}). Auto reset in 1 hour.`, 'warning');
+            showNotification(`⚠️ Device limit reached (${total}/${limit}). Auto reset in ${formatCountdown(remainingMs)}.`, 'warning');
             deviceLimitReachedShown = true;
         }
         return { total, limit, warningAt, reached: true, resetAt };
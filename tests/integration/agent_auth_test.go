@@ -0,0 +1,196 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/handlers"
+	"portofolionetworkapi/internal/middleware"
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/services"
+)
+
+const fleetKey = "fleet-secret"
+
+// newAgentAPI adds the agent heartbeat and the admin key routes, wired as
+// in src/main.go, to the device API
+func newAgentAPI(t *testing.T, grace time.Duration) *api {
+	a := newAPI(t)
+	keys := services.NewAPIKeyService(a.repos.APIKeys, grace)
+	v1 := a.router.Group("/api/v1")
+	agent := v1.Group("/agent", middleware.AgentAuth(keys, fleetKey, false))
+	agent.POST("/heartbeat", handlers.NewDeviceHandler(a.repos).RecordHeartbeat)
+	handlers.NewAPIKeyHandler(keys, a.repos.Devices).Register(v1.Group("/admin"))
+	return a
+}
+
+func (a *api) issueKey(deviceID string, body interface{}) models.IssuedAPIKey {
+	a.t.Helper()
+	w := a.do(http.MethodPost, "/api/v1/admin/devices/"+deviceID+"/api-keys", body)
+	if w.Code != http.StatusCreated {
+		a.t.Fatalf("issue key: status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data models.IssuedAPIKey `json:"data"`
+	}
+	decode(a.t, w, &resp)
+	return resp.Data
+}
+
+func (a *api) heartbeat(token, deviceRef string) int {
+	a.t.Helper()
+	w := a.do(http.MethodPost, "/api/v1/agent/heartbeat",
+		gin.H{"device_id": deviceRef, "status": "online"}, "Authorization", "Bearer "+token)
+	return w.Code
+}
+
+// tamper changes the last character of a key
+func tamper(key string) string {
+	last := "0"
+	if strings.HasSuffix(key, last) {
+		last = "1"
+	}
+	return key[:len(key)-1] + last
+}
+
+func TestAgentHeartbeat(t *testing.T) {
+	a := newAgentAPI(t, time.Hour)
+	id := a.createDevice("Router-BDG-01", "10.0.0.1")
+	beat := func(body gin.H) *httptest.ResponseRecorder {
+		return a.do(http.MethodPost, "/api/v1/agent/heartbeat", body, "Authorization", "Bearer "+fleetKey)
+	}
+
+	// Agents may report by name; the response carries the device ID
+	w := beat(gin.H{"device_id": "router-bdg-01", "version": "7.2", "uptime": "3d"})
+	var resp struct {
+		DeviceID string `json:"device_id"`
+	}
+	decode(t, w, &resp)
+	if w.Code != http.StatusOK || resp.DeviceID != id {
+		t.Fatalf("heartbeat by name: status %d: %s", w.Code, w.Body)
+	}
+	d, err := a.repos.Devices.Get(context.Background(), id)
+	if err != nil || d.Status != models.DeviceStatusOnline || d.Version != "7.2" || d.LastSeen.IsZero() {
+		t.Fatalf("device after heartbeat = %+v, %v", d, err)
+	}
+
+	// A degraded report changes the status and keeps the version
+	if w := beat(gin.H{"device_id": id, "status": "degraded"}); w.Code != http.StatusOK {
+		t.Fatalf("degraded heartbeat: status %d: %s", w.Code, w.Body)
+	}
+	if d, _ := a.repos.Devices.Get(context.Background(), id); d.Status != "degraded" || d.Version != "7.2" {
+		t.Fatalf("device after degraded heartbeat = %+v", d)
+	}
+
+	for _, tc := range []struct {
+		body gin.H
+		want int
+	}{
+		{gin.H{"device_id": id, "status": "exploded"}, http.StatusBadRequest},
+		{gin.H{"status": "online"}, http.StatusBadRequest},
+		{gin.H{"device_id": "Router-XXX-99"}, http.StatusNotFound},
+	} {
+		if w := beat(tc.body); w.Code != tc.want {
+			t.Errorf("heartbeat %v: status %d, want %d: %s", tc.body, w.Code, tc.want, w.Body)
+		}
+	}
+}
+
+func TestAgentKeyBoundToDevice(t *testing.T) {
+	a := newAgentAPI(t, time.Hour)
+	bdg := a.createDevice("Router-BDG-01", "10.0.0.1")
+	jkt := a.createDevice("Router-JKT-01", "10.0.1.1")
+
+	key := a.issueKey(bdg, nil)
+	if !strings.HasPrefix(key.Key, key.Prefix+"_") || key.Status != models.APIKeyStatusActive {
+		t.Fatalf("issued key = %+v", key)
+	}
+
+	cases := []struct {
+		name, token, device string
+		want                int
+	}{
+		{"own device by id", key.Key, bdg, http.StatusOK},
+		{"own device by name", key.Key, "router-bdg-01", http.StatusOK},
+		{"other device", key.Key, jkt, http.StatusForbidden},
+		{"other device by name", key.Key, "Router-JKT-01", http.StatusForbidden},
+		{"tampered key", tamper(key.Key), bdg, http.StatusUnauthorized},
+		{"unknown token", "not-a-key", bdg, http.StatusUnauthorized},
+		{"fleet key", fleetKey, jkt, http.StatusOK},
+		{"fleet key for a keyed device", fleetKey, bdg, http.StatusForbidden},
+		{"fleet key for a keyed device by name", fleetKey, "ROUTER-BDG-01", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		if got := a.heartbeat(tc.token, tc.device); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	w := a.do(http.MethodPost, "/api/v1/agent/heartbeat", gin.H{"device_id": bdg})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("no key: status %d, want 401", w.Code)
+	}
+}
+
+func TestAgentKeyRotationAndRevocation(t *testing.T) {
+	a := newAgentAPI(t, time.Hour)
+	id := a.createDevice("Router-BDG-01", "10.0.0.1")
+
+	old := a.issueKey(id, nil)
+	current := a.issueKey(id, nil)
+	if a.heartbeat(old.Key, id) != http.StatusOK || a.heartbeat(current.Key, id) != http.StatusOK {
+		t.Fatal("both keys should work during the grace period")
+	}
+
+	w := a.do(http.MethodGet, "/api/v1/admin/devices/"+id+"/api-keys", nil)
+	var list struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	decode(t, w, &list)
+	if w.Code != http.StatusOK || len(list.Data) != 2 || list.Data[1]["status"] != models.APIKeyStatusGrace {
+		t.Fatalf("list: status %d: %s", w.Code, w.Body)
+	}
+	for _, k := range list.Data {
+		if _, ok := k["key"]; ok {
+			t.Fatalf("listing exposes the key: %v", k)
+		}
+		if k["last_used_at"] == nil {
+			t.Fatalf("last_used_at not recorded: %v", k)
+		}
+	}
+
+	// Rotating without grace cuts off the current key at once
+	next := a.issueKey(id, gin.H{"grace_period": "0s"})
+	if a.heartbeat(current.Key, id) != http.StatusUnauthorized || a.heartbeat(next.Key, id) != http.StatusOK {
+		t.Fatal("grace_period 0s should revoke the previous keys")
+	}
+
+	w = a.do(http.MethodDelete, "/api/v1/admin/devices/"+id+"/api-keys/"+next.ID, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d: %s", w.Code, w.Body)
+	}
+	if a.heartbeat(next.Key, id) != http.StatusUnauthorized {
+		t.Fatal("revoked key still accepted")
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		body         interface{}
+		want         int
+	}{
+		{http.MethodPost, "/api/v1/admin/devices/00000000-0000-4000-8000-000000000000/api-keys", nil, http.StatusNotFound},
+		{http.MethodGet, "/api/v1/admin/devices/not-a-uuid/api-keys", nil, http.StatusNotFound},
+		{http.MethodDelete, "/api/v1/admin/devices/" + id + "/api-keys/00000000-0000-4000-8000-000000000000", nil, http.StatusNotFound},
+		{http.MethodPost, "/api/v1/admin/devices/" + id + "/api-keys", gin.H{"grace_period": "soon"}, http.StatusBadRequest},
+	} {
+		if w := a.do(tc.method, tc.path, tc.body); w.Code != tc.want {
+			t.Errorf("%s %s: status %d, want %d: %s", tc.method, tc.path, w.Code, tc.want, w.Body)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/models"
+)
+
+type dryRunResponse struct {
+	DryRun bool `json:"dry_run"`
+	Data   struct {
+		Alert struct {
+			SLA string `json:"sla_status"`
+		} `json:"alert"`
+		Suppressed bool `json:"suppressed"`
+		Telegram   *struct {
+			Configured bool `json:"configured"`
+			Payload    struct {
+				ChatID    string `json:"chat_id"`
+				Text      string `json:"text"`
+				ParseMode string `json:"parse_mode"`
+			} `json:"payload"`
+			FollowUp string `json:"follow_up"`
+		} `json:"telegram"`
+		Ticket *struct {
+			Configured bool   `json:"configured"`
+			Model      string `json:"model"`
+			Values     struct {
+				Name   string `json:"name"`
+				TeamID int    `json:"team_id"`
+				UserID int    `json:"user_id"`
+			} `json:"values"`
+		} `json:"ticket"`
+	} `json:"data"`
+}
+
+// Odoo answering at all fails the test (see newUserAPI), so every case
+// here also checks that nothing is ticketed
+func TestAlertTestIsDryRun(t *testing.T) {
+	a, auth := newUserAPI(t, jwtSecret, time.Minute)
+	admin := a.bearerFor(auth, "admin", models.RoleGrant{Role: models.RoleAdmin})
+
+	dryRun := func(path string, body gin.H) dryRunResponse {
+		t.Helper()
+		w := a.do(http.MethodPost, path, body, "Authorization", admin)
+		if w.Code != http.StatusOK {
+			t.Fatalf("dry run: status %d: %s", w.Code, w.Body)
+		}
+		var resp dryRunResponse
+		decode(t, w, &resp)
+		if !resp.DryRun {
+			t.Fatalf("dry_run missing: %s", w.Body)
+		}
+		return resp
+	}
+
+	resp := dryRun("/api/v1/alerts/test", testAlert)
+	d := resp.Data
+	if d.Alert.SLA != "BREACHED" || d.Suppressed {
+		t.Fatalf("alert: %+v", d)
+	}
+	if d.Telegram == nil || !d.Telegram.Configured || d.Telegram.Payload.ChatID != "-100200" ||
+		d.Telegram.Payload.ParseMode != "HTML" || !strings.Contains(d.Telegram.Payload.Text, "Router-BDG-01") ||
+		!strings.Contains(d.Telegram.Payload.Text, "BREACHED") {
+		t.Fatalf("telegram: %+v", d.Telegram)
+	}
+	if !strings.Contains(d.Telegram.FollowUp, "{ticket_id}") {
+		t.Fatalf("follow up: %q", d.Telegram.FollowUp)
+	}
+	if d.Ticket == nil || !d.Ticket.Configured || d.Ticket.Model != "helpdesk.ticket" ||
+		d.Ticket.Values.Name != "[HIGH] Router-BDG-01 - Link down" || d.Ticket.Values.TeamID != 3 || d.Ticket.Values.UserID != 7 {
+		t.Fatalf("ticket: %+v", d.Ticket)
+	}
+
+	// assign_user routes the ticket like on the real webhook
+	if resp := dryRun("/api/v1/alerts/test?assign_user=9", testAlert); resp.Data.Ticket == nil || resp.Data.Ticket.Values.UserID != 9 {
+		t.Fatalf("assign_user: ticket %+v", resp.Data.Ticket)
+	}
+
+	// Resolutions and low severities only notify
+	for name, change := range map[string]gin.H{
+		"resolved": {"status": "RESOLVED"},
+		"info":     {"severity": "INFO"},
+	} {
+		body := gin.H{}
+		for k, v := range testAlert {
+			body[k] = v
+		}
+		for k, v := range change {
+			body[k] = v
+		}
+		if resp := dryRun("/api/v1/alerts/test", body); resp.Data.Telegram == nil || resp.Data.Ticket != nil {
+			t.Fatalf("%s: telegram %+v, ticket %+v", name, resp.Data.Telegram, resp.Data.Ticket)
+		}
+	}
+
+	if w := a.do(http.MethodPost, "/api/v1/alerts/test", gin.H{"device": "Router-BDG-01"}, "Authorization", admin); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid payload: status %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,384 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/database"
+	"portofolionetworkapi/internal/handlers"
+	"portofolionetworkapi/internal/middleware"
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+// api wires the device routes to in-memory repositories, the same way
+// src/main.go wires them to Postgres
+type api struct {
+	t      *testing.T
+	router *gin.Engine
+	repos  repository.Repositories
+}
+
+func newAPI(t *testing.T) *api {
+	return newAPIWith(t, repository.NewMemory())
+}
+
+// newAPIWith is newAPI over the given repositories
+func newAPIWith(t *testing.T, repos repository.Repositories) *api {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(signedIn)
+	v1 := router.Group("/api/v1")
+	handlers.NewDeviceHandler(repos).Register(v1.Group("/devices", middleware.Tenant()))
+	return &api{t: t, router: router, repos: repos}
+}
+
+// testTenantHeader names the tenant of the signed-in test user; requests
+// without it are made by a user of the default tenant. auth_test.go covers
+// tenants carried in real access tokens.
+const testTenantHeader = "X-Test-Tenant"
+
+// signedIn stands in for UserAuth: every request is made by a signed-in
+// admin
+func signedIn(c *gin.Context) {
+	tenant := c.GetHeader(testTenantHeader)
+	if tenant == "" {
+		tenant = models.DefaultTenantID
+	}
+	c.Set(middleware.UserContextKey, models.AuthUser{
+		ID:       "00000000-0000-4000-8000-000000000001",
+		Username: "tester",
+		TenantID: tenant,
+		Roles:    []models.RoleGrant{{Role: models.RoleAdmin}},
+	})
+	c.Next()
+}
+
+func (a *api) do(method, path string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	return w
+}
+
+func (a *api) createDevice(name, ip string) string {
+	a.t.Helper()
+	w := a.do(http.MethodPost, "/api/v1/devices", gin.H{"name": name, "ip_address": ip, "location": "Bandung"})
+	if w.Code != http.StatusCreated {
+		a.t.Fatalf("create %s: status %d: %s", name, w.Code, w.Body)
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	decode(a.t, w, &resp)
+	return resp.ID
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body, err)
+	}
+}
+
+func TestDeviceLifecycle(t *testing.T) {
+	a := newAPI(t)
+
+	id := a.createDevice("Router-BDG-01", "10.0.0.1")
+
+	w := a.do(http.MethodGet, "/api/v1/devices/"+id, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("get: status %d: %s", w.Code, w.Body)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("get: ETag = %s, want \"1\"", etag)
+	}
+
+	update := gin.H{"name": "Router-BDG-01", "ip_address": "10.0.0.2", "location": "Bandung", "status": "online"}
+	w = a.do(http.MethodPut, "/api/v1/devices/"+id, update, "If-Match", `"1"`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: status %d: %s", w.Code, w.Body)
+	}
+	var updated struct {
+		Data models.Device `json:"data"`
+	}
+	decode(t, w, &updated)
+	if updated.Data.IPAddress != "10.0.0.2" || updated.Data.Status != "online" || updated.Data.Revision != 2 {
+		t.Fatalf("update: got %+v", updated.Data)
+	}
+
+	// The first revision is stale now
+	w = a.do(http.MethodDelete, "/api/v1/devices/"+id, nil, "If-Match", `"1"`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale delete: status %d, want 412", w.Code)
+	}
+
+	w = a.do(http.MethodDelete, "/api/v1/devices/"+id, nil, "If-Match", `"2"`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: status %d: %s", w.Code, w.Body)
+	}
+	if w = a.do(http.MethodGet, "/api/v1/devices/"+id, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("get after delete: status %d, want 404", w.Code)
+	}
+}
+
+func TestCreateDeviceValidation(t *testing.T) {
+	a := newAPI(t)
+
+	w := a.do(http.MethodPost, "/api/v1/devices", gin.H{"name": " bad", "ip_address": "300.1.1.1"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+	var resp struct {
+		Details []models.FieldError `json:"details"`
+	}
+	decode(t, w, &resp)
+	if len(resp.Details) != 3 {
+		t.Fatalf("details = %+v, want name, ip_address and location", resp.Details)
+	}
+
+	a.createDevice("Router-JKT-01", "10.0.0.1")
+	w = a.do(http.MethodPost, "/api/v1/devices", gin.H{"name": "Router-JKT-01", "ip_address": "10.0.0.9", "location": "Jakarta"})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("duplicate name: status %d, want 409", w.Code)
+	}
+}
+
+func TestPatchDevice(t *testing.T) {
+	a := newAPI(t)
+	id := a.createDevice("Router-SBY-01", "10.0.0.1")
+
+	w := a.do(http.MethodPatch, "/api/v1/devices/"+id, gin.H{"location": nil, "status": "degraded"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch: status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data models.Device `json:"data"`
+	}
+	decode(t, w, &resp)
+	if resp.Data.Location != "" || resp.Data.Status != "degraded" || resp.Data.Name != "Router-SBY-01" {
+		t.Fatalf("patch: got %+v", resp.Data)
+	}
+
+	w = a.do(http.MethodPatch, "/api/v1/devices/"+id, gin.H{"name": nil, "version": "7.1"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid patch: status %d, want 400", w.Code)
+	}
+}
+
+func TestListDevicesPagination(t *testing.T) {
+	a := newAPI(t)
+	names := []string{"edge-a", "edge-b", "edge-c", "edge-d", "edge-e"}
+	for i, name := range []string{"edge-c", "edge-a", "edge-e", "edge-b", "edge-d"} {
+		a.createDevice(name, fmt.Sprintf("10.0.1.%d", i+1))
+	}
+
+	var got []string
+	path := "/api/v1/devices?sort=name&limit=2"
+	for pages := 0; ; pages++ {
+		if pages > len(names) {
+			t.Fatal("pagination does not terminate")
+		}
+		w := a.do(http.MethodGet, path, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: status %d: %s", w.Code, w.Body)
+		}
+		var page struct {
+			Data  []models.Device `json:"data"`
+			Total int             `json:"total"`
+			Meta  struct {
+				HasMore    bool   `json:"has_more"`
+				NextCursor string `json:"next_cursor"`
+			} `json:"meta"`
+		}
+		decode(t, w, &page)
+		if page.Total != len(names) {
+			t.Fatalf("total = %d, want %d", page.Total, len(names))
+		}
+		for _, d := range page.Data {
+			got = append(got, d.Name)
+		}
+		if !page.Meta.HasMore {
+			break
+		}
+		path = "/api/v1/devices?sort=name&limit=2&cursor=" + page.Meta.NextCursor
+	}
+
+	if len(got) != len(names) {
+		t.Fatalf("got %v, want %v", got, names)
+	}
+	for i := range names {
+		if got[i] != names[i] {
+			t.Fatalf("got %v, want %v", got, names)
+		}
+	}
+}
+
+func TestListDevicesETag(t *testing.T) {
+	a := newAPI(t)
+	a.createDevice("Router-BDG-01", "10.0.0.1")
+
+	w := a.do(http.MethodGet, "/api/v1/devices", nil)
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("list has no ETag")
+	}
+	if w = a.do(http.MethodGet, "/api/v1/devices", nil, "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Fatalf("status %d, want 304", w.Code)
+	}
+
+	a.createDevice("Router-BDG-02", "10.0.0.2")
+	if w = a.do(http.MethodGet, "/api/v1/devices", nil, "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Fatalf("status %d after a change, want 200", w.Code)
+	}
+}
+
+func TestDevicesAreScopedToUserTenant(t *testing.T) {
+	a := newAPI(t)
+	if _, err := a.repos.Tenants.Create(context.Background(), "acme", "Acme", models.TenantQuotas{}); err != nil {
+		t.Fatal(err)
+	}
+	own := a.createDevice("Router-BDG-01", "10.0.0.1")
+	w := a.do(http.MethodPost, "/api/v1/devices", gin.H{"name": "acme-01", "ip_address": "10.0.0.2", "location": "Jakarta"},
+		testTenantHeader, "acme")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	decode(t, w, &created)
+
+	// Each tenant lists only its own devices, whatever the query says
+	list := func(path string, headers ...string) []models.Device {
+		t.Helper()
+		w := a.do(http.MethodGet, path, nil, headers...)
+		var resp struct {
+			Data []models.Device `json:"data"`
+		}
+		decode(t, w, &resp)
+		return resp.Data
+	}
+	if got := list("/api/v1/devices", testTenantHeader, "acme"); len(got) != 1 || got[0].Name != "acme-01" || got[0].TenantID != "acme" {
+		t.Fatalf("acme devices: got %+v", got)
+	}
+	if got := list("/api/v1/devices?tenant=acme"); len(got) != 1 || got[0].Name != "Router-BDG-01" {
+		t.Fatalf("default devices with ?tenant=acme: got %+v", got)
+	}
+
+	// Devices of another tenant are not found
+	if w := a.do(http.MethodGet, "/api/v1/devices/"+created.ID, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("get other tenant's device: status %d, want 404", w.Code)
+	}
+	if w := a.do(http.MethodDelete, "/api/v1/devices/"+own, nil, testTenantHeader, "acme"); w.Code != http.StatusNotFound {
+		t.Fatalf("delete other tenant's device: status %d, want 404", w.Code)
+	}
+	if w := a.do(http.MethodPatch, "/api/v1/devices/"+own, gin.H{"status": "online"}, testTenantHeader, "acme"); w.Code != http.StatusNotFound {
+		t.Fatalf("patch other tenant's device: status %d, want 404", w.Code)
+	}
+	if w := a.do(http.MethodGet, "/api/v1/devices/"+created.ID, nil, testTenantHeader, "acme"); w.Code != http.StatusOK {
+		t.Fatalf("get own device: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestTenantRequiresSignedInUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/devices", middleware.Tenant(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/no-tenant", func(c *gin.Context) {
+		c.Set(middleware.UserContextKey, models.AuthUser{ID: "u", Username: "legacy"})
+	}, middleware.Tenant(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for path, want := range map[string]int{"/devices": http.StatusUnauthorized, "/no-tenant": http.StatusForbidden} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Tenant-ID", models.DefaultTenantID)
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: status %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestGetDeviceDetail(t *testing.T) {
+	a := newAPI(t)
+	id := a.createDevice("Router-BDG-01", "10.0.0.1")
+
+	now := time.Now()
+	if _, err := a.repos.Devices.RecordHeartbeat(context.Background(), models.HeartbeatRequest{DeviceID: id, Status: "online"}); err != nil {
+		t.Fatal(err)
+	}
+	a.repos.Alerts.(*repository.MemoryAlertRepository).Add(models.Alert{
+		EventID: "evt-1", DeviceID: id, Status: models.AlertStatusOpen, TicketID: 42, OpenedAt: now,
+	})
+	a.repos.Alerts.(*repository.MemoryAlertRepository).Add(models.Alert{
+		EventID: "evt-0", DeviceID: id, Status: models.AlertStatusResolved, OpenedAt: now.Add(-time.Hour),
+	})
+	a.repos.Commands.(*repository.MemoryCommandRepository).Add(models.Command{
+		DeviceID: id, Type: "reboot", Status: models.CommandStatusPending, CreatedAt: now,
+	})
+
+	w := a.do(http.MethodGet, "/api/v1/devices/"+id, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			Heartbeats     []models.Heartbeat `json:"heartbeats"`
+			OpenAlerts     []models.Alert     `json:"open_alerts"`
+			OpenTicketIDs  []int              `json:"open_ticket_ids"`
+			RecentCommands []models.Command   `json:"recent_commands"`
+		} `json:"data"`
+	}
+	decode(t, w, &resp)
+	d := resp.Data
+	if len(d.Heartbeats) != 1 || len(d.OpenAlerts) != 1 || len(d.RecentCommands) != 1 {
+		t.Fatalf("got %+v", d)
+	}
+	if len(d.OpenTicketIDs) != 1 || d.OpenTicketIDs[0] != 42 {
+		t.Fatalf("open_ticket_ids = %v, want [42]", d.OpenTicketIDs)
+	}
+
+	// The heartbeat changed the status, so the revision is now 2
+	if etag := w.Header().Get("ETag"); etag != `"2"` {
+		t.Fatalf("ETag = %s, want \"2\"", etag)
+	}
+	if w = a.do(http.MethodGet, "/api/v1/devices/"+id, nil, "If-None-Match", `"2"`); w.Code != http.StatusNotModified {
+		t.Fatalf("conditional get: status %d, want 304", w.Code)
+	}
+}
+
+func TestDemoDeviceLimit(t *testing.T) {
+	database.ConfigureDemoMode(true, 1, 0)
+	t.Cleanup(func() { database.ConfigureDemoMode(false, 25, 0) })
+
+	a := newAPI(t)
+	a.createDevice("Router-BDG-01", "10.0.0.1")
+
+	w := a.do(http.MethodPost, "/api/v1/devices", gin.H{"name": "Router-BDG-02", "ip_address": "10.0.0.2", "location": "Bandung"})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("429 without Retry-After")
+	}
+}
@@ -0,0 +1,262 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"portofolionetworkapi/internal/handlers"
+	"portofolionetworkapi/internal/middleware"
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+	"portofolionetworkapi/internal/services"
+)
+
+const jwtSecret = "test-secret-test-secret-test-secret"
+
+// newUserAPI wires login, and the device and dry-run test alert routes behind
+// UserAuth and their permission checks, as in src/main.go
+func newUserAPI(t *testing.T, secret string, accessTTL time.Duration) (*api, *services.AuthService) {
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewMemory()
+	auth := services.NewAuthService(repos.Users, secret, accessTTL, time.Hour)
+	requireUser := middleware.UserAuth(auth)
+
+	router := gin.New()
+	v1 := router.Group("/api/v1")
+	h := handlers.NewAuthHandler(auth)
+	h.Register(v1.Group("/auth"), requireUser)
+	h.RegisterAdmin(v1.Group("/admin"))
+	handlers.NewDeviceHandler(repos).Register(v1.Group("/devices", requireUser, middleware.Tenant(),
+		middleware.Authorize(middleware.Permissions{
+			Read:           models.PermDevicesRead,
+			Write:          models.PermDevicesWrite,
+			Delete:         models.PermDevicesDelete,
+			LocationScoped: true,
+		})))
+	commandHandler := handlers.NewCommandHandler(services.NewCommandService(repos.Devices, repos.Commands, 10))
+	commands := v1.Group("", requireUser, middleware.Tenant(), middleware.Authorize(middleware.Permissions{
+		Read:           models.PermCommandsRead,
+		LocationScoped: true,
+	}))
+	commands.GET("/commands/:id", commandHandler.GetCommand)
+	commands.GET("/executions/:id", commandHandler.GetExecution)
+	// The test alert is a dry run, so Odoo must never be called
+	odoo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("dry run called Odoo: %s %s", r.Method, r.URL)
+	}))
+	t.Cleanup(odoo.Close)
+	orchestrator := services.NewAlertOrchestrator(&services.Notifiers{
+		Telegram:      services.NewTelegramService("123:test-token", "-100200"),
+		Odoo:          services.NewOdooService(odoo.URL, "netops", "bot", "secret"),
+		TeamID:        3,
+		DefaultUserID: 7,
+	}, repos.Devices, repos.Alerts)
+	alerts := v1.Group("/alerts", requireUser, middleware.Authorize(middleware.Permissions{Write: models.PermAlertsTest}))
+	alerts.POST("/test", handlers.NewAlertHandler(orchestrator).DryRunZabbixWebhook)
+	return &api{t: t, router: router, repos: repos}, auth
+}
+
+func (a *api) login(username, password string) (int, models.TokenPair) {
+	a.t.Helper()
+	w := a.do(http.MethodPost, "/api/v1/auth/login", gin.H{"username": username, "password": password})
+	var tokens models.TokenPair
+	if w.Code == http.StatusOK {
+		decode(a.t, w, &tokens)
+	}
+	return w.Code, tokens
+}
+
+func (a *api) refresh(token string) (int, models.TokenPair) {
+	a.t.Helper()
+	w := a.do(http.MethodPost, "/api/v1/auth/refresh", gin.H{"refresh_token": token})
+	var tokens models.TokenPair
+	if w.Code == http.StatusOK {
+		decode(a.t, w, &tokens)
+	}
+	return w.Code, tokens
+}
+
+func TestUserLoginProtectsDevices(t *testing.T) {
+	a, _ := newUserAPI(t, jwtSecret, time.Minute)
+
+	w := a.do(http.MethodPost, "/api/v1/admin/users", gin.H{"username": "NOC.Bandung", "password": "correct-horse"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create user: status %d: %s", w.Code, w.Body)
+	}
+	if w := a.do(http.MethodPost, "/api/v1/admin/users", gin.H{"username": "noc.bandung", "password": "correct-horse"}); w.Code != http.StatusConflict {
+		t.Fatalf("duplicate user: status %d", w.Code)
+	}
+	if w := a.do(http.MethodPost, "/api/v1/admin/users", gin.H{"username": "short", "password": "123"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("short password: status %d", w.Code)
+	}
+
+	if w := a.do(http.MethodGet, "/api/v1/devices", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("devices without token: status %d, want 401", w.Code)
+	}
+	if code, _ := a.login("noc.bandung", "wrong-password"); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d", code)
+	}
+	if code, _ := a.login("nobody", "correct-horse"); code != http.StatusUnauthorized {
+		t.Fatalf("unknown user: status %d", code)
+	}
+
+	code, tokens := a.login("noc.bandung", "correct-horse")
+	if code != http.StatusOK || tokens.TokenType != "Bearer" || tokens.ExpiresIn != 60 || tokens.RefreshToken == "" {
+		t.Fatalf("login: status %d, tokens %+v", code, tokens)
+	}
+	bearer := "Bearer " + tokens.AccessToken
+	if w := a.do(http.MethodGet, "/api/v1/devices", nil, "Authorization", bearer); w.Code != http.StatusOK {
+		t.Fatalf("devices with token: status %d: %s", w.Code, w.Body)
+	}
+	w = a.do(http.MethodGet, "/api/v1/auth/me", nil, "Authorization", bearer)
+	var me struct {
+		Data models.AuthUser `json:"data"`
+	}
+	decode(t, w, &me)
+	if w.Code != http.StatusOK || me.Data.Username != "noc.bandung" {
+		t.Fatalf("me: status %d: %s", w.Code, w.Body)
+	}
+
+	// Tokens signed with another secret or tampered with are rejected
+	other, _ := newUserAPI(t, "another-secret-another-secret-xx", time.Minute)
+	if w := other.do(http.MethodGet, "/api/v1/devices", nil, "Authorization", bearer); w.Code != http.StatusUnauthorized {
+		t.Fatalf("foreign token: status %d", w.Code)
+	}
+	if w := a.do(http.MethodGet, "/api/v1/devices", nil, "Authorization", bearer+"x"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered token: status %d", w.Code)
+	}
+}
+
+func TestUserTenantComesFromToken(t *testing.T) {
+	a, _ := newUserAPI(t, jwtSecret, time.Minute)
+	max := 1
+	if _, err := a.repos.Tenants.Create(context.Background(), "acme", "Acme", models.TenantQuotas{MaxDevices: &max}); err != nil {
+		t.Fatal(err)
+	}
+
+	operator := []gin.H{{"role": models.RoleOperator}}
+	if w := a.do(http.MethodPost, "/api/v1/admin/users", gin.H{"username": "noc.nope", "password": "correct-horse", "tenant_id": "nope"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("user of unknown tenant: status %d, want 400", w.Code)
+	}
+	w := a.do(http.MethodPost, "/api/v1/admin/users", gin.H{"username": "noc.acme", "password": "correct-horse", "tenant_id": "acme", "roles": operator})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create user: status %d: %s", w.Code, w.Body)
+	}
+	_, tokens := a.login("noc.acme", "correct-horse")
+	bearer := "Bearer " + tokens.AccessToken
+
+	w = a.do(http.MethodGet, "/api/v1/auth/me", nil, "Authorization", bearer)
+	var me struct {
+		Data models.AuthUser `json:"data"`
+	}
+	decode(t, w, &me)
+	if me.Data.TenantID != "acme" {
+		t.Fatalf("me: %s", w.Body)
+	}
+
+	// The quota of the user's tenant applies; a tenant header changes nothing
+	device := func(name, ip string) int {
+		return a.do(http.MethodPost, "/api/v1/devices", gin.H{"name": name, "ip_address": ip, "location": "Jakarta"},
+			"Authorization", bearer, "X-Tenant-ID", models.DefaultTenantID).Code
+	}
+	if code := device("acme-01", "10.1.0.1"); code != http.StatusCreated {
+		t.Fatalf("first device: status %d", code)
+	}
+	if code := device("acme-02", "10.1.0.2"); code != http.StatusForbidden {
+		t.Fatalf("device over quota: status %d, want 403", code)
+	}
+	if d, err := a.repos.Devices.Resolve(context.Background(), "acme-01"); err != nil || d.TenantID != "acme" {
+		t.Fatalf("device tenant = %+v, %v", d, err)
+	}
+
+	// Tokens issued before users had a tenant are refused
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "netops-integration-api", "sub": me.Data.ID, "username": "noc.acme",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := a.do(http.MethodGet, "/api/v1/devices", nil, "Authorization", "Bearer "+legacy); w.Code != http.StatusUnauthorized {
+		t.Fatalf("token without tenant: status %d, want 401", w.Code)
+	}
+}
+
+func TestAccessTokenExpires(t *testing.T) {
+	a, auth := newUserAPI(t, jwtSecret, time.Second)
+	if _, err := auth.CreateUser(context.Background(), models.CreateUserRequest{Username: "viewer", Password: "correct-horse"}); err != nil {
+		t.Fatal(err)
+	}
+	_, tokens := a.login("viewer", "correct-horse")
+
+	// JWT expiry has one-second resolution
+	time.Sleep(2100 * time.Millisecond)
+	if w := a.do(http.MethodGet, "/api/v1/devices", nil, "Authorization", "Bearer "+tokens.AccessToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expired token: status %d, want 401", w.Code)
+	}
+	if code, _ := a.refresh(tokens.RefreshToken); code != http.StatusOK {
+		t.Fatalf("refresh after access expiry: status %d", code)
+	}
+}
+
+func TestRefreshTokenRotationAndReuse(t *testing.T) {
+	a, auth := newUserAPI(t, jwtSecret, time.Minute)
+	ctx := context.Background()
+	u, err := auth.CreateUser(ctx, models.CreateUserRequest{Username: "operator", Password: "correct-horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, first := a.login("operator", "correct-horse")
+	code, second := a.refresh(first.RefreshToken)
+	if code != http.StatusOK || second.RefreshToken == first.RefreshToken || second.AccessToken == "" {
+		t.Fatalf("refresh: status %d, tokens %+v", code, second)
+	}
+
+	// Replaying the used token revokes the rotated one as well
+	if code, _ := a.refresh(first.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: status %d, want 401", code)
+	}
+	if code, _ := a.refresh(second.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("refresh token of a compromised family: status %d, want 401", code)
+	}
+
+	// Logout ends the session; logging out again is harmless
+	_, session := a.login("operator", "correct-horse")
+	for i := 0; i < 2; i++ {
+		if w := a.do(http.MethodPost, "/api/v1/auth/logout", gin.H{"refresh_token": session.RefreshToken}); w.Code != http.StatusOK {
+			t.Fatalf("logout: status %d", w.Code)
+		}
+	}
+	if code, _ := a.refresh(session.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout: status %d", code)
+	}
+
+	// Disabled users can neither log in nor refresh
+	_, session = a.login("operator", "correct-horse")
+	if w := a.do(http.MethodPost, "/api/v1/admin/users/"+u.ID+"/disable", nil); w.Code != http.StatusOK {
+		t.Fatalf("disable: status %d: %s", w.Code, w.Body)
+	}
+	if code, _ := a.refresh(session.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("refresh of a disabled user: status %d", code)
+	}
+	if code, _ := a.login("operator", "correct-horse"); code != http.StatusUnauthorized {
+		t.Fatalf("login of a disabled user: status %d", code)
+	}
+}
+
+func TestUserAuthDisabledWithoutSecret(t *testing.T) {
+	a, _ := newUserAPI(t, "", time.Minute)
+	if w := a.do(http.MethodGet, "/api/v1/devices", nil); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("devices: status %d, want 503", w.Code)
+	}
+	if code, _ := a.login("anyone", "whatever-pass"); code != http.StatusServiceUnavailable {
+		t.Fatalf("login: status %d, want 503", code)
+	}
+}
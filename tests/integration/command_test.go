@@ -0,0 +1,599 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/database"
+	"portofolionetworkapi/internal/handlers"
+	"portofolionetworkapi/internal/middleware"
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+	"portofolionetworkapi/internal/services"
+)
+
+// forEachStore runs fn against the in-memory repositories and a migrated
+// SQLite file, the single-box deployment
+func forEachStore(t *testing.T, fn func(t *testing.T, repos repository.Repositories)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, repository.NewMemory())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "netops.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := database.RunMigrations(db, database.DriverSQLite); err != nil {
+			t.Fatal(err)
+		}
+		fn(t, repository.NewSQLite(db))
+	})
+}
+
+// newFleetAPI adds the command queue, bulk jobs, rollouts and tenant admin,
+// wired as in src/fleet_features.go, to the device API. Bulk jobs are
+// capped at two devices without confirm; the rollout engine ticks every
+// few milliseconds.
+func newFleetAPI(t *testing.T, repos repository.Repositories) *api {
+	a := newAPIWith(t, repos)
+	v1 := a.router.Group("/api/v1")
+
+	commandHandler := handlers.NewCommandHandler(services.NewCommandService(a.repos.Devices, a.repos.Commands, 2))
+	rolloutService := services.NewRolloutService(a.repos.Rollouts, 5*time.Millisecond)
+	rolloutService.Start()
+	t.Cleanup(rolloutService.Stop)
+	rolloutHandler := handlers.NewRolloutHandler(rolloutService)
+	tenantHandler := handlers.NewTenantHandler(services.NewTenantService(a.repos.Tenants))
+
+	agent := v1.Group("/agent")
+	agent.GET("/commands/:deviceId", commandHandler.PollCommands)
+	agent.POST("/commands/:commandId/result", commandHandler.ReportCommandResult)
+
+	devices := v1.Group("/devices", middleware.Tenant())
+	devices.GET("/:id/commands", commandHandler.ListDeviceCommands)
+	devices.POST("/:id/commands", commandHandler.EnqueueCommand)
+	devices.POST("/bulk/configure", commandHandler.BulkConfigure)
+	commands := v1.Group("", middleware.Tenant())
+	commands.GET("/commands/:id", commandHandler.GetCommand)
+	commands.GET("/executions/:id", commandHandler.GetExecution)
+
+	rollouts := v1.Group("/rollouts", middleware.Tenant())
+	rollouts.GET("", rolloutHandler.ListRollouts)
+	rollouts.POST("", rolloutHandler.CreateRollout)
+	rollouts.GET("/:id", rolloutHandler.GetRollout)
+	rollouts.POST("/:id/pause", rolloutHandler.PauseRollout)
+	rollouts.POST("/:id/resume", rolloutHandler.ResumeRollout)
+	rollouts.POST("/:id/abort", rolloutHandler.AbortRollout)
+
+	admin := v1.Group("/admin")
+	admin.GET("/tenants", tenantHandler.ListTenants)
+	admin.POST("/tenants", tenantHandler.CreateTenant)
+	admin.GET("/tenants/:id", tenantHandler.GetTenant)
+	admin.PUT("/tenants/:id", tenantHandler.UpdateTenant)
+	return a
+}
+
+// poll claims the device's pending commands as its agent would
+func (a *api) poll(deviceRef string) []models.Command {
+	a.t.Helper()
+	w := a.do(http.MethodGet, "/api/v1/agent/commands/"+deviceRef, nil)
+	if w.Code != http.StatusOK {
+		a.t.Fatalf("poll %s: status %d: %s", deviceRef, w.Code, w.Body)
+	}
+	var resp struct {
+		Commands []models.Command `json:"commands"`
+	}
+	decode(a.t, w, &resp)
+	return resp.Commands
+}
+
+func (a *api) report(commandID string, body gin.H) *models.Command {
+	a.t.Helper()
+	w := a.do(http.MethodPost, "/api/v1/agent/commands/"+commandID+"/result", body)
+	if w.Code != http.StatusOK {
+		a.t.Fatalf("report %s: status %d: %s", commandID, w.Code, w.Body)
+	}
+	var resp struct {
+		Data models.Command `json:"data"`
+	}
+	decode(a.t, w, &resp)
+	return &resp.Data
+}
+
+func TestCommandQueue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		a := newFleetAPI(t, repos)
+		id := a.createDevice("Router-BDG-01", "10.0.0.1")
+
+		w := a.do(http.MethodPost, "/api/v1/devices/router-bdg-01/commands", gin.H{"type": "reboot", "parameters": gin.H{"delay": 5}})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("enqueue: status %d: %s", w.Code, w.Body)
+		}
+		var created struct {
+			Data models.Command `json:"data"`
+		}
+		decode(t, w, &created)
+		if created.Data.DeviceID != id || created.Data.Status != models.CommandStatusPending ||
+			created.Data.TimeoutSeconds != models.DefaultCommandTimeout {
+			t.Fatalf("enqueued = %+v", created.Data)
+		}
+
+		for _, tc := range []struct {
+			name string
+			body gin.H
+			want int
+		}{
+			{"timeout too long", gin.H{"type": "reboot", "timeout_seconds": models.MaxCommandTimeout + 1}, http.StatusBadRequest},
+			{"parameters not an object", gin.H{"type": "reboot", "parameters": []int{1}}, http.StatusBadRequest},
+		} {
+			if w := a.do(http.MethodPost, "/api/v1/devices/"+id+"/commands", tc.body); w.Code != tc.want {
+				t.Errorf("%s: status %d, want %d: %s", tc.name, w.Code, tc.want, w.Body)
+			}
+		}
+		if w := a.do(http.MethodPost, "/api/v1/devices/missing/commands", gin.H{"type": "reboot"}); w.Code != http.StatusNotFound {
+			t.Fatalf("unknown device: status %d, want 404", w.Code)
+		}
+
+		// The agent claims the command once, then walks it to a terminal status
+		cmds := a.poll("Router-BDG-01")
+		if len(cmds) != 1 || cmds[0].ID != created.Data.ID || cmds[0].Status != models.CommandStatusDispatched {
+			t.Fatalf("poll = %+v", cmds)
+		}
+		if again := a.poll(id); len(again) != 0 {
+			t.Fatalf("second poll = %+v", again)
+		}
+		if cmd := a.report(cmds[0].ID, gin.H{"status": "executing"}); cmd.StartedAt == nil {
+			t.Fatalf("executing = %+v", cmd)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/agent/commands/"+cmds[0].ID+"/result", gin.H{"status": "dispatched"}); w.Code != http.StatusConflict {
+			t.Fatalf("backwards transition: status %d, want 409: %s", w.Code, w.Body)
+		}
+		if cmd := a.report(cmds[0].ID, gin.H{"status": "succeeded", "result": gin.H{"uptime": "0d"}}); cmd.CompletedAt == nil {
+			t.Fatalf("succeeded = %+v", cmd)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/agent/commands/"+cmds[0].ID+"/result", gin.H{"status": "failed"}); w.Code != http.StatusConflict {
+			t.Fatalf("report after terminal: status %d, want 409", w.Code)
+		}
+
+		w = a.do(http.MethodGet, "/api/v1/commands/"+cmds[0].ID, nil)
+		var got struct {
+			Data models.Command `json:"data"`
+		}
+		decode(t, w, &got)
+		if w.Code != http.StatusOK || got.Data.Status != models.CommandStatusSucceeded {
+			t.Fatalf("get command: status %d: %s", w.Code, w.Body)
+		}
+		if w := a.do(http.MethodGet, "/api/v1/commands/not-a-uuid", nil); w.Code != http.StatusNotFound {
+			t.Fatalf("get unknown command: status %d, want 404", w.Code)
+		}
+
+		w = a.do(http.MethodGet, "/api/v1/devices/"+id+"/commands", nil)
+		var list struct {
+			Total int `json:"total"`
+		}
+		decode(t, w, &list)
+		if list.Total != 1 {
+			t.Fatalf("list commands: %s", w.Body)
+		}
+	})
+}
+
+func TestCommandSweeperTimesOutSilentAgents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		a := newFleetAPI(t, repos)
+		id := a.createDevice("Router-BDG-01", "10.0.0.1")
+
+		// The API enforces whole seconds; store a command that is overdue as
+		// soon as it is dispatched
+		cmd, err := repos.Commands.Enqueue(context.Background(), models.Command{
+			DeviceID: id, Type: "reboot", Parameters: json.RawMessage(`{}`),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending := enqueueHTTP(a, id)
+
+		commands := services.NewCommandService(repos.Devices, repos.Commands, 0)
+		commands.StartSweeper(5 * time.Millisecond)
+		defer commands.StopSweeper()
+
+		// Only dispatched commands time out
+		if cmds := a.poll(id); len(cmds) != 2 {
+			t.Fatalf("poll = %+v", cmds)
+		}
+		status := func(id string) string {
+			w := a.do(http.MethodGet, "/api/v1/commands/"+id, nil)
+			var got struct {
+				Data models.Command `json:"data"`
+			}
+			decode(t, w, &got)
+			return got.Data.Status
+		}
+		for deadline := time.Now().Add(time.Second); status(cmd.ID) != models.CommandStatusTimedOut; time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("command status %q, want timed_out", status(cmd.ID))
+			}
+		}
+		if got := status(pending); got != models.CommandStatusDispatched {
+			t.Fatalf("command within its timeout: status %q", got)
+		}
+
+		// A late result cannot revive it
+		if w := a.do(http.MethodPost, "/api/v1/agent/commands/"+cmd.ID+"/result", gin.H{"status": "succeeded"}); w.Code != http.StatusConflict {
+			t.Fatalf("late result: status %d, want 409", w.Code)
+		}
+	})
+}
+
+// enqueueHTTP queues a reboot for the device through the API and returns
+// its ID
+func enqueueHTTP(a *api, deviceRef string) string {
+	a.t.Helper()
+	w := a.do(http.MethodPost, "/api/v1/devices/"+deviceRef+"/commands", gin.H{"type": "reboot"})
+	if w.Code != http.StatusCreated {
+		a.t.Fatalf("enqueue: status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data models.Command `json:"data"`
+	}
+	decode(a.t, w, &resp)
+	return resp.Data.ID
+}
+
+func TestBulkConfigure(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		a := newFleetAPI(t, repos)
+		a.createDevice("Router-BDG-01", "10.0.0.1")
+		a.createDevice("Router-BDG-02", "10.0.0.2")
+		a.createDevice("Router-BDG-03", "10.0.0.3")
+
+		bulk := func(filter gin.H, confirm bool) *httptest.ResponseRecorder {
+			return a.do(http.MethodPost, "/api/v1/devices/bulk/configure", gin.H{
+				"device_filter": filter, "command": gin.H{"type": "set_ntp", "parameters": gin.H{"server": "pool.ntp.org"}}, "confirm": confirm,
+			})
+		}
+		if w := bulk(gin.H{}, false); w.Code != http.StatusBadRequest {
+			t.Fatalf("empty filter: status %d, want 400: %s", w.Code, w.Body)
+		}
+		if w := bulk(gin.H{"name": "Switch-*"}, false); w.Code != http.StatusBadRequest {
+			t.Fatalf("filter matching nothing: status %d, want 400: %s", w.Code, w.Body)
+		}
+
+		// Above the fan-out cap the request must be confirmed
+		w := bulk(gin.H{"all": true}, false)
+		var refused struct {
+			Matched int `json:"matched_devices"`
+			Max     int `json:"max_devices"`
+		}
+		decode(t, w, &refused)
+		if w.Code != http.StatusUnprocessableEntity || refused.Matched != 3 || refused.Max != 2 {
+			t.Fatalf("unconfirmed fan-out: status %d: %s", w.Code, w.Body)
+		}
+		if cmds := a.poll("Router-BDG-01"); len(cmds) != 0 {
+			t.Fatalf("refused fan-out queued commands: %+v", cmds)
+		}
+
+		w = bulk(gin.H{"all": true}, true)
+		var job struct {
+			ExecutionID  string               `json:"execution_id"`
+			TotalDevices int                  `json:"total_devices"`
+			Status       string               `json:"status"`
+			Devices      []models.FanOutEntry `json:"devices"`
+		}
+		decode(t, w, &job)
+		if w.Code != http.StatusOK || job.TotalDevices != 3 || job.Status != "queued" || job.Devices[0].DeviceName != "Router-BDG-01" {
+			t.Fatalf("confirmed fan-out: status %d: %s", w.Code, w.Body)
+		}
+
+		// Progress follows the per-device commands
+		cmds := a.poll("Router-BDG-01")
+		a.report(cmds[0].ID, gin.H{"status": "succeeded"})
+		cmds = a.poll("Router-BDG-02")
+		a.report(cmds[0].ID, gin.H{"status": "failed", "error": "unreachable"})
+
+		w = a.do(http.MethodGet, "/api/v1/executions/"+job.ExecutionID, nil)
+		var exec struct {
+			Data models.Execution `json:"data"`
+		}
+		decode(t, w, &exec)
+		if e := exec.Data; w.Code != http.StatusOK || e.Completed != 1 || e.Failed != 1 || e.Pending != 1 || e.Status != "executing" || e.Progress != 66 {
+			t.Fatalf("execution: status %d: %s", w.Code, w.Body)
+		}
+		if w := a.do(http.MethodGet, "/api/v1/executions/00000000-0000-4000-8000-000000000000", nil); w.Code != http.StatusNotFound {
+			t.Fatalf("unknown execution: status %d, want 404", w.Code)
+		}
+	})
+}
+
+// rolloutState fetches a rollout until cond holds or a second passes
+func (a *api) rolloutState(id string, cond func(models.Rollout) bool) models.Rollout {
+	a.t.Helper()
+	var resp struct {
+		Data models.Rollout `json:"data"`
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		w := a.do(http.MethodGet, "/api/v1/rollouts/"+id, nil)
+		if w.Code != http.StatusOK {
+			a.t.Fatalf("get rollout: status %d: %s", w.Code, w.Body)
+		}
+		decode(a.t, w, &resp)
+		if cond(resp.Data) {
+			return resp.Data
+		}
+		if time.Now().After(deadline) {
+			a.t.Fatalf("rollout never reached the expected state: %+v", resp.Data)
+		}
+	}
+}
+
+func TestRolloutThroughAgents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		a := newFleetAPI(t, repos)
+		ctx := context.Background()
+		for _, name := range []string{"Router-BDG-01", "Router-BDG-02", "Router-BDG-03"} {
+			a.createDevice(name, "10.0.0.1")
+			if _, err := a.repos.Devices.RecordHeartbeat(ctx, models.HeartbeatRequest{DeviceID: name, Status: "online", Version: "1.0"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if w := a.do(http.MethodPost, "/api/v1/rollouts", gin.H{"target_version": "2.0", "device_filter": gin.H{"all": true}, "canary_percent": 101}); w.Code != http.StatusBadRequest {
+			t.Fatalf("invalid canary: status %d, want 400", w.Code)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/rollouts", gin.H{"target_version": "1.0", "device_filter": gin.H{"all": true}}); w.Code != http.StatusBadRequest {
+			t.Fatalf("no device needs the version: status %d, want 400: %s", w.Code, w.Body)
+		}
+
+		// One canary, then batches of one; a single failure pauses the rollout
+		w := a.do(http.MethodPost, "/api/v1/rollouts", gin.H{
+			"target_version": "2.0", "device_filter": gin.H{"all": true},
+			"canary_percent": 1, "batch_size": 1, "failure_threshold": 0,
+		})
+		var created struct {
+			Data models.Rollout `json:"data"`
+		}
+		decode(t, w, &created)
+		ro := created.Data
+		if w.Code != http.StatusCreated || ro.TotalWaves != 3 || ro.CurrentWave != 1 || ro.Progress.InProgress != 1 {
+			t.Fatalf("create rollout: status %d: %s", w.Code, w.Body)
+		}
+
+		// The canary confirms the version in its command result
+		cmds := a.poll("Router-BDG-01")
+		if len(cmds) != 1 || cmds[0].Type != models.FirmwareUpdateCommand {
+			t.Fatalf("canary commands = %+v", cmds)
+		}
+		a.report(cmds[0].ID, gin.H{"status": "succeeded", "result": gin.H{"version": "2.0"}})
+		ro = a.rolloutState(ro.ID, func(r models.Rollout) bool { return r.CurrentWave == 2 })
+		if ro.Devices[0].Status != models.RolloutDeviceSucceeded || ro.Devices[0].CurrentVersion != "2.0" {
+			t.Fatalf("after canary: %+v", ro.Devices)
+		}
+
+		cmds = a.poll("Router-BDG-02")
+		a.report(cmds[0].ID, gin.H{"status": "failed", "error": "flash failed"})
+		ro = a.rolloutState(ro.ID, func(r models.Rollout) bool { return r.Status == models.RolloutStatusPaused })
+		if ro.PauseReason == "" || ro.Progress.Failed != 1 || ro.Progress.Pending != 1 {
+			t.Fatalf("after failure: %+v", ro)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/rollouts/"+ro.ID+"/pause", nil); w.Code != http.StatusConflict {
+			t.Fatalf("pause while paused: status %d, want 409", w.Code)
+		}
+
+		// Resuming skips the gate and starts the last wave; a heartbeat on
+		// the target version completes it
+		if w := a.do(http.MethodPost, "/api/v1/rollouts/"+ro.ID+"/resume", nil); w.Code != http.StatusOK {
+			t.Fatalf("resume: status %d: %s", w.Code, w.Body)
+		}
+		if cmds := a.poll("Router-BDG-03"); len(cmds) != 1 {
+			t.Fatalf("last wave commands = %+v", cmds)
+		}
+		if _, err := a.repos.Devices.RecordHeartbeat(ctx, models.HeartbeatRequest{DeviceID: "Router-BDG-03", Status: "online", Version: "2.0"}); err != nil {
+			t.Fatal(err)
+		}
+		ro = a.rolloutState(ro.ID, func(r models.Rollout) bool { return r.Status == models.RolloutStatusCompleted })
+		if ro.CompletedAt == nil || ro.Progress.Succeeded != 2 || ro.Progress.Failed != 1 {
+			t.Fatalf("completed rollout: %+v", ro)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/rollouts/"+ro.ID+"/abort", nil); w.Code != http.StatusConflict {
+			t.Fatalf("abort after completion: status %d, want 409", w.Code)
+		}
+
+		w = a.do(http.MethodGet, "/api/v1/rollouts", nil)
+		var list struct {
+			Total int `json:"total"`
+		}
+		decode(t, w, &list)
+		if list.Total != 1 {
+			t.Fatalf("list rollouts: %s", w.Body)
+		}
+	})
+}
+
+func TestRolloutRejectsEnrolledDevices(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		a := newFleetAPI(t, repos)
+		a.createDevice("Router-BDG-01", "10.0.0.1")
+		a.createDevice("Router-JKT-01", "10.0.1.1")
+
+		rollout := func(version string, filter gin.H) *httptest.ResponseRecorder {
+			return a.do(http.MethodPost, "/api/v1/rollouts", gin.H{"target_version": version, "device_filter": filter})
+		}
+		if w := rollout("2.0", gin.H{"name": "Router-BDG-*"}); w.Code != http.StatusCreated {
+			t.Fatalf("first rollout: status %d: %s", w.Code, w.Body)
+		}
+
+		// A second target version would race the first on the same device
+		w := rollout("3.0", gin.H{"all": true})
+		var conflict struct {
+			Devices []string `json:"devices"`
+		}
+		decode(t, w, &conflict)
+		if w.Code != http.StatusConflict || len(conflict.Devices) != 1 || conflict.Devices[0] != "Router-BDG-01" {
+			t.Fatalf("overlapping rollout: status %d: %s", w.Code, w.Body)
+		}
+		if w := rollout("3.0", gin.H{"name": "Router-JKT-*"}); w.Code != http.StatusCreated {
+			t.Fatalf("disjoint rollout: status %d: %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestCommandsAreScopedToTenant(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		a := newFleetAPI(t, repos)
+		if w := a.do(http.MethodPost, "/api/v1/admin/tenants", gin.H{"id": "acme", "name": "Acme"}); w.Code != http.StatusCreated {
+			t.Fatalf("create tenant: status %d: %s", w.Code, w.Body)
+		}
+		a.createDevice("Router-BDG-01", "10.0.0.1")
+		commandID := enqueueHTTP(a, "Router-BDG-01")
+		w := a.do(http.MethodPost, "/api/v1/devices/bulk/configure", gin.H{
+			"device_filter": gin.H{"all": true}, "command": gin.H{"type": "reboot"},
+		})
+		var job struct {
+			ExecutionID string `json:"execution_id"`
+		}
+		decode(t, w, &job)
+		if w.Code != http.StatusOK {
+			t.Fatalf("bulk configure: status %d: %s", w.Code, w.Body)
+		}
+
+		for _, path := range []string{"/api/v1/commands/" + commandID, "/api/v1/executions/" + job.ExecutionID} {
+			if w := a.do(http.MethodGet, path, nil); w.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d: %s", path, w.Code, w.Body)
+			}
+			if w := a.do(http.MethodGet, path, nil, testTenantHeader, "acme"); w.Code != http.StatusNotFound {
+				t.Fatalf("GET %s from another tenant: status %d, want 404: %s", path, w.Code, w.Body)
+			}
+		}
+	})
+}
+
+func TestRolloutsAreScopedToTenant(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		a := newFleetAPI(t, repos)
+		if w := a.do(http.MethodPost, "/api/v1/admin/tenants", gin.H{"id": "acme", "name": "Acme"}); w.Code != http.StatusCreated {
+			t.Fatalf("create tenant: status %d: %s", w.Code, w.Body)
+		}
+		a.createDevice("Router-BDG-01", "10.0.0.1")
+		if w := a.do(http.MethodPost, "/api/v1/devices", gin.H{"name": "Router-ACME-01", "ip_address": "10.1.0.1", "location": "Jakarta"}, testTenantHeader, "acme"); w.Code != http.StatusCreated {
+			t.Fatalf("create acme device: status %d: %s", w.Code, w.Body)
+		}
+
+		// The tenant in the filter is replaced by the request tenant
+		w := a.do(http.MethodPost, "/api/v1/rollouts", gin.H{
+			"target_version": "2.0", "device_filter": gin.H{"all": true, "tenant": models.DefaultTenantID},
+		}, testTenantHeader, "acme")
+		var created struct {
+			Data models.Rollout `json:"data"`
+		}
+		decode(t, w, &created)
+		ro := created.Data
+		if w.Code != http.StatusCreated || ro.TenantID != "acme" || ro.Progress.Total != 1 || ro.Devices[0].DeviceName != "Router-ACME-01" {
+			t.Fatalf("create rollout: status %d: %s", w.Code, w.Body)
+		}
+
+		// Other tenants neither see nor control it
+		var list struct {
+			Total int `json:"total"`
+		}
+		decode(t, a.do(http.MethodGet, "/api/v1/rollouts", nil), &list)
+		if list.Total != 0 {
+			t.Fatalf("default tenant lists %d rollout(s), want 0", list.Total)
+		}
+		if w := a.do(http.MethodGet, "/api/v1/rollouts/"+ro.ID, nil); w.Code != http.StatusNotFound {
+			t.Fatalf("get other tenant's rollout: status %d, want 404", w.Code)
+		}
+		for _, action := range []string{"pause", "resume", "abort"} {
+			if w := a.do(http.MethodPost, "/api/v1/rollouts/"+ro.ID+"/"+action, nil); w.Code != http.StatusNotFound {
+				t.Fatalf("%s other tenant's rollout: status %d, want 404", action, w.Code)
+			}
+		}
+
+		decode(t, a.do(http.MethodGet, "/api/v1/rollouts", nil, testTenantHeader, "acme"), &list)
+		if list.Total != 1 {
+			t.Fatalf("acme lists %d rollout(s), want 1", list.Total)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/rollouts/"+ro.ID+"/abort", nil, testTenantHeader, "acme"); w.Code != http.StatusOK {
+			t.Fatalf("abort own rollout: status %d: %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestTenantQuotas(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		a := newFleetAPI(t, repos)
+
+		w := a.do(http.MethodPost, "/api/v1/admin/tenants", gin.H{
+			"id": "acme", "name": "Acme", "quotas": gin.H{"max_devices": 1, "max_commands_per_hour": 1},
+		})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create tenant: status %d: %s", w.Code, w.Body)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/admin/tenants", gin.H{"id": "acme", "name": "Again"}); w.Code != http.StatusConflict {
+			t.Fatalf("duplicate tenant: status %d, want 409", w.Code)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/admin/tenants", gin.H{"id": "bad", "name": "Bad", "quotas": gin.H{"max_devices": -1}}); w.Code != http.StatusBadRequest {
+			t.Fatalf("negative quota: status %d, want 400", w.Code)
+		}
+
+		w = a.do(http.MethodPost, "/api/v1/devices", gin.H{"name": "Router-ACME-01", "ip_address": "10.1.0.1", "location": "Jakarta"}, testTenantHeader, "acme")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create acme device: status %d: %s", w.Code, w.Body)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/devices", gin.H{"name": "Router-ACME-02", "ip_address": "10.1.0.2", "location": "Jakarta"}, testTenantHeader, "acme"); w.Code != http.StatusForbidden {
+			t.Fatalf("device over quota: status %d, want 403: %s", w.Code, w.Body)
+		}
+
+		if w := a.do(http.MethodPost, "/api/v1/devices/Router-ACME-01/commands", gin.H{"type": "reboot"}); w.Code != http.StatusNotFound {
+			t.Fatalf("command from another tenant: status %d, want 404: %s", w.Code, w.Body)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/devices/Router-ACME-01/commands", gin.H{"type": "reboot"}, testTenantHeader, "acme"); w.Code != http.StatusCreated {
+			t.Fatalf("first command: status %d: %s", w.Code, w.Body)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/devices/Router-ACME-01/commands", gin.H{"type": "reboot"}, testTenantHeader, "acme"); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("command over quota: status %d, want 429: %s", w.Code, w.Body)
+		}
+
+		w = a.do(http.MethodGet, "/api/v1/admin/tenants/acme", nil)
+		var got struct {
+			Data models.Tenant `json:"data"`
+		}
+		decode(t, w, &got)
+		if got.Data.Usage.Devices != 1 || got.Data.Usage.CommandsLastHour != 1 {
+			t.Fatalf("tenant usage: %s", w.Body)
+		}
+
+		// Lifting the quota takes effect at once
+		if w := a.do(http.MethodPut, "/api/v1/admin/tenants/acme", gin.H{"quotas": gin.H{"max_devices": nil}}); w.Code != http.StatusOK {
+			t.Fatalf("update tenant: status %d: %s", w.Code, w.Body)
+		}
+		if w := a.do(http.MethodPost, "/api/v1/devices", gin.H{"name": "Router-ACME-02", "ip_address": "10.1.0.2", "location": "Jakarta"}, testTenantHeader, "acme"); w.Code != http.StatusCreated {
+			t.Fatalf("device after lifting quota: status %d: %s", w.Code, w.Body)
+		}
+
+		// A rollout wave over the command quota pauses the rollout
+		if w := a.do(http.MethodPut, "/api/v1/admin/tenants/acme", gin.H{"quotas": gin.H{"max_commands_per_hour": 1}}); w.Code != http.StatusOK {
+			t.Fatalf("update tenant: status %d: %s", w.Code, w.Body)
+		}
+		w = a.do(http.MethodPost, "/api/v1/rollouts", gin.H{"target_version": "2.0", "device_filter": gin.H{"all": true}}, testTenantHeader, "acme")
+		var rollout struct {
+			Data models.Rollout `json:"data"`
+		}
+		decode(t, w, &rollout)
+		if ro := rollout.Data; w.Code != http.StatusCreated || ro.Status != models.RolloutStatusPaused || ro.CurrentWave != 0 ||
+			!strings.Contains(ro.PauseReason, "commands_per_hour") {
+			t.Fatalf("rollout over quota: status %d: %s", w.Code, w.Body)
+		}
+		if w := a.do(http.MethodGet, "/api/v1/admin/tenants/nope", nil); w.Code != http.StatusNotFound {
+			t.Fatalf("unknown tenant: status %d, want 404", w.Code)
+		}
+	})
+}
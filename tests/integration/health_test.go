@@ -0,0 +1,123 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/database"
+	"portofolionetworkapi/internal/handlers"
+	"portofolionetworkapi/internal/services"
+)
+
+type readiness struct {
+	Status string                            `json:"status"`
+	Checks map[string]map[string]interface{} `json:"checks"`
+}
+
+func newHealthRouter(t *testing.T, migrate bool, deps ...handlers.Dependency) (*gin.Engine, func()) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "health.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if migrate {
+		if err := database.RunMigrations(db, database.DriverSQLite); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err := handlers.NewHealthHandler(db, database.DriverSQLite, time.Second, time.Minute, deps...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.GET("/health/live", h.Live)
+	router.GET("/health/ready", h.Ready)
+	return router, func() { db.Close() }
+}
+
+func getReadiness(t *testing.T, router *gin.Engine) (int, readiness) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	var r readiness
+	decode(t, w, &r)
+	// The endpoint is unauthenticated: failures are logged, not returned
+	for name, check := range r.Checks {
+		if _, ok := check["error"]; ok {
+			t.Errorf("%s check exposes its error: %v", name, check)
+		}
+	}
+	if body := w.Body.String(); strings.Contains(body, "unreachable") || strings.Contains(body, "closed") {
+		t.Errorf("readiness exposes error text: %s", body)
+	}
+	return w.Code, r
+}
+
+func TestHealthReady(t *testing.T) {
+	odooAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"server_version":"17.0"}}`))
+	}))
+	defer odooAPI.Close()
+	odoo := services.NewOdooService(odooAPI.URL, "db", "user", "pass")
+
+	pings := 0
+	router, closeDB := newHealthRouter(t, true,
+		handlers.Dependency{Name: "odoo", Ping: odoo.Ping},
+		handlers.Dependency{Name: "telegram", Ping: func(context.Context) error {
+			pings++
+			return errors.New("telegram unreachable")
+		}},
+		handlers.Dependency{Name: "pager", Ping: services.NewTelegramService("", "").Ping},
+	)
+
+	code, r := getReadiness(t, router)
+	if code != http.StatusOK || r.Status != "ready" {
+		t.Fatalf("ready: status %d %+v", code, r)
+	}
+	if r.Checks["database"]["status"] != "up" || r.Checks["database"]["latency_ms"] == nil {
+		t.Errorf("database check = %v", r.Checks["database"])
+	}
+	if m := r.Checks["migrations"]; m["status"] != "up" || m["version"] != m["latest"] || m["version"] == float64(0) {
+		t.Errorf("migrations check = %v", m)
+	}
+	// A dependency being down is reported but does not fail readiness
+	if r.Checks["odoo"]["status"] != "up" || r.Checks["telegram"]["status"] != "down" || r.Checks["pager"]["status"] != "disabled" {
+		t.Errorf("dependency checks = %v", r.Checks)
+	}
+
+	// Dependency results are cached between probes
+	getReadiness(t, router)
+	if pings != 1 {
+		t.Errorf("telegram pinged %d times, want 1", pings)
+	}
+
+	closeDB()
+	if code, r = getReadiness(t, router); code != http.StatusServiceUnavailable || r.Checks["database"]["status"] != "down" {
+		t.Fatalf("closed database: status %d %+v", code, r)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("live with the database down: status %d", w.Code)
+	}
+}
+
+func TestHealthReadyPendingMigrations(t *testing.T) {
+	router, _ := newHealthRouter(t, false)
+	code, r := getReadiness(t, router)
+	if code != http.StatusServiceUnavailable || r.Status != "not_ready" {
+		t.Fatalf("unmigrated database: status %d %+v", code, r)
+	}
+}
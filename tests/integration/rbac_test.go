@@ -0,0 +1,209 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/services"
+)
+
+var testAlert = gin.H{
+	"event_id": "E1", "device": "Router-BDG-01", "ip": "10.0.0.1",
+	"severity": "HIGH", "problem": "Link down", "status": "PROBLEM",
+}
+
+// bearerFor creates a user with roles and returns their Authorization header
+func (a *api) bearerFor(auth *services.AuthService, username string, roles ...models.RoleGrant) string {
+	a.t.Helper()
+	if _, err := auth.CreateUser(context.Background(), models.CreateUserRequest{
+		Username: username, Password: "correct-horse", Roles: roles,
+	}); err != nil {
+		a.t.Fatal(err)
+	}
+	code, tokens := a.login(username, "correct-horse")
+	if code != http.StatusOK {
+		a.t.Fatalf("login %s: status %d", username, code)
+	}
+	return "Bearer " + tokens.AccessToken
+}
+
+// seedDevice creates a device directly in the repository
+func (a *api) seedDevice(name, location string) string {
+	a.t.Helper()
+	d, err := a.repos.Devices.Create(context.Background(), models.DefaultTenantID, models.CreateDeviceRequest{
+		Name: name, IPAddress: "10.0.0.1", Location: location,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return d.ID
+}
+
+func TestRolePermissions(t *testing.T) {
+	a, auth := newUserAPI(t, jwtSecret, time.Minute)
+	id := a.seedDevice("Router-BDG-01", "Bandung")
+	viewer := a.bearerFor(auth, "viewer")
+	operator := a.bearerFor(auth, "operator", models.RoleGrant{Role: models.RoleOperator})
+	admin := a.bearerFor(auth, "admin", models.RoleGrant{Role: models.RoleAdmin})
+	device := gin.H{"name": "Router-BDG-02", "ip_address": "10.0.0.2", "location": "Bandung"}
+
+	cases := []struct {
+		name, bearer, method, path string
+		body                       interface{}
+		want                       int
+		missing                    string
+	}{
+		{"viewer lists", viewer, http.MethodGet, "/api/v1/devices", nil, http.StatusOK, ""},
+		{"viewer creates", viewer, http.MethodPost, "/api/v1/devices", device, http.StatusForbidden, models.PermDevicesWrite},
+		{"viewer tests alerts", viewer, http.MethodPost, "/api/v1/alerts/test", testAlert, http.StatusForbidden, models.PermAlertsTest},
+		{"operator creates", operator, http.MethodPost, "/api/v1/devices", device, http.StatusCreated, ""},
+		{"operator deletes", operator, http.MethodDelete, "/api/v1/devices/" + id, nil, http.StatusForbidden, models.PermDevicesDelete},
+		{"operator tests alerts", operator, http.MethodPost, "/api/v1/alerts/test", testAlert, http.StatusForbidden, models.PermAlertsTest},
+		{"admin tests alerts", admin, http.MethodPost, "/api/v1/alerts/test", testAlert, http.StatusOK, ""},
+		{"admin deletes", admin, http.MethodDelete, "/api/v1/devices/" + id, nil, http.StatusOK, ""},
+	}
+	for _, tc := range cases {
+		w := a.do(tc.method, tc.path, tc.body, "Authorization", tc.bearer)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, w.Code, tc.want, w.Body)
+			continue
+		}
+		if tc.missing != "" {
+			var resp struct {
+				MissingPermission string `json:"missing_permission"`
+			}
+			decode(t, w, &resp)
+			if resp.MissingPermission != tc.missing {
+				t.Errorf("%s: missing_permission = %q, want %q", tc.name, resp.MissingPermission, tc.missing)
+			}
+		}
+	}
+}
+
+func TestLocationScopedRoles(t *testing.T) {
+	a, auth := newUserAPI(t, jwtSecret, time.Minute)
+	bdg := a.seedDevice("Router-BDG-01", "Bandung")
+	jkt := a.seedDevice("Router-JKT-01", "Jakarta")
+	a.seedDevice("Router-NOWHERE", "")
+	// Operator in Bandung, nothing elsewhere
+	eng := a.bearerFor(auth, "eng.bandung", models.RoleGrant{Role: models.RoleOperator, Location: "bandung"})
+
+	w := a.do(http.MethodGet, "/api/v1/devices", nil, "Authorization", eng)
+	var list struct {
+		Data  []models.Device `json:"data"`
+		Total int             `json:"total"`
+	}
+	decode(t, w, &list)
+	if w.Code != http.StatusOK || list.Total != 1 || list.Data[0].ID != bdg {
+		t.Fatalf("list: status %d: %s", w.Code, w.Body)
+	}
+
+	cases := []struct {
+		name, method, path string
+		body               interface{}
+		want               int
+	}{
+		{"get own location", http.MethodGet, "/api/v1/devices/" + bdg, nil, http.StatusOK},
+		{"get other location", http.MethodGet, "/api/v1/devices/" + jkt, nil, http.StatusForbidden},
+		{"create at own location", http.MethodPost, "/api/v1/devices", gin.H{"name": "Switch-BDG-01", "ip_address": "10.0.0.9", "location": "Bandung"}, http.StatusCreated},
+		{"create elsewhere", http.MethodPost, "/api/v1/devices", gin.H{"name": "Switch-JKT-01", "ip_address": "10.0.1.9", "location": "Jakarta"}, http.StatusForbidden},
+		{"patch other location", http.MethodPatch, "/api/v1/devices/" + jkt, gin.H{"status": "online"}, http.StatusForbidden},
+		{"move out of own location", http.MethodPatch, "/api/v1/devices/" + bdg, gin.H{"location": "Jakarta"}, http.StatusForbidden},
+		{"clear location", http.MethodPatch, "/api/v1/devices/" + bdg, gin.H{"location": nil}, http.StatusForbidden},
+		{"patch own location", http.MethodPatch, "/api/v1/devices/" + bdg, gin.H{"status": "online"}, http.StatusOK},
+		{"delete needs admin", http.MethodDelete, "/api/v1/devices/" + bdg, nil, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		if w := a.do(tc.method, tc.path, tc.body, "Authorization", eng); w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, w.Code, tc.want, w.Body)
+		}
+	}
+
+	// Commands and bulk jobs outside the user's locations are not found
+	ctx := context.Background()
+	var commands []string
+	for _, id := range []string{bdg, jkt} {
+		cmd, err := a.repos.Commands.Enqueue(ctx, models.Command{DeviceID: id, Type: "reboot", TimeoutSeconds: 60})
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands = append(commands, cmd.ID)
+	}
+	var jobs []string
+	for _, filter := range []models.DeviceFilter{
+		{Location: "Bandung", Tenant: models.DefaultTenantID},
+		{All: true, Tenant: models.DefaultTenantID},
+	} {
+		job, err := a.repos.Commands.CreateJob(ctx, filter, models.Command{Type: "reboot", TimeoutSeconds: 60}, func(int) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, job.ID)
+	}
+	for path, want := range map[string]int{
+		"/api/v1/commands/" + commands[0]: http.StatusOK,
+		"/api/v1/commands/" + commands[1]: http.StatusNotFound,
+		"/api/v1/executions/" + jobs[0]:   http.StatusOK,
+		"/api/v1/executions/" + jobs[1]:   http.StatusNotFound,
+	} {
+		if w := a.do(http.MethodGet, path, nil, "Authorization", eng); w.Code != want {
+			t.Errorf("GET %s: status %d, want %d: %s", path, w.Code, want, w.Body)
+		}
+	}
+
+	w = a.do(http.MethodGet, "/api/v1/devices/"+jkt, nil, "Authorization", eng)
+	var denied map[string]string
+	decode(t, w, &denied)
+	if denied["missing_permission"] != models.PermDevicesRead || denied["location"] != "Jakarta" {
+		t.Fatalf("403 body = %v", denied)
+	}
+}
+
+func TestSetUserRoles(t *testing.T) {
+	a, auth := newUserAPI(t, jwtSecret, time.Minute)
+	u, err := auth.CreateUser(context.Background(), models.CreateUserRequest{Username: "noc", Password: "correct-horse"})
+	if err != nil || len(u.Roles) != 1 || u.Roles[0].Role != models.RoleViewer {
+		t.Fatalf("default roles = %+v, %v", u, err)
+	}
+	_, tokens := a.login("noc", "correct-horse")
+
+	path := "/api/v1/admin/users/" + u.ID + "/roles"
+	for _, body := range []gin.H{
+		{"roles": []gin.H{{"role": "superuser"}}},
+		{"roles": []gin.H{{"role": "operator", "location": "bad\nlocation"}}},
+		{},
+	} {
+		if w := a.do(http.MethodPut, path, body); w.Code != http.StatusBadRequest {
+			t.Errorf("roles %v: status %d, want 400", body, w.Code)
+		}
+	}
+	if w := a.do(http.MethodPut, "/api/v1/admin/users/00000000-0000-4000-8000-000000000000/roles", gin.H{"roles": []gin.H{}}); w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status %d", w.Code)
+	}
+
+	w := a.do(http.MethodPut, path, gin.H{"roles": []gin.H{{"role": "admin"}, {"role": "admin"}}})
+	var resp struct {
+		Data models.User `json:"data"`
+	}
+	decode(t, w, &resp)
+	if w.Code != http.StatusOK || len(resp.Data.Roles) != 1 {
+		t.Fatalf("set roles: status %d: %s", w.Code, w.Body)
+	}
+
+	// New roles apply to tokens issued from the next refresh
+	test := func(token string) int {
+		return a.do(http.MethodPost, "/api/v1/alerts/test", testAlert, "Authorization", "Bearer "+token).Code
+	}
+	if code := test(tokens.AccessToken); code != http.StatusForbidden {
+		t.Fatalf("old token: status %d, want 403", code)
+	}
+	_, tokens = a.refresh(tokens.RefreshToken)
+	if code := test(tokens.AccessToken); code != http.StatusOK {
+		t.Fatalf("refreshed token: status %d, want 200", code)
+	}
+}
@@ -0,0 +1,69 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+	"portofolionetworkapi/internal/services"
+)
+
+// waitForOpenAlerts polls the alert history until the device has want open
+// alerts or a second passes
+func waitForOpenAlerts(t *testing.T, repos repository.Repositories, deviceID string, want int) []models.Alert {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		open, err := repos.Alerts.OpenForDevice(context.Background(), deviceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(open) == want {
+			return open
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("open alerts = %+v, want %d", open, want)
+		}
+	}
+}
+
+func TestStalenessMonitorRecordsAlerts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		// Telegram and Odoo are not configured; alerts are still recorded
+		orchestrator := services.NewAlertOrchestrator(&services.Notifiers{
+			Telegram: services.NewTelegramService("", ""),
+			Odoo:     services.NewOdooService("", "", "", ""),
+		}, repos.Devices, repos.Alerts)
+		t.Cleanup(func() { orchestrator.Drain(ctx) })
+
+		d, err := repos.Devices.Create(ctx, models.DefaultTenantID, models.CreateDeviceRequest{
+			Name: "Router-BDG-01", IPAddress: "10.0.0.1", Location: "Bandung",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repos.Devices.RecordHeartbeat(ctx, models.HeartbeatRequest{DeviceID: d.ID, Status: "online"}); err != nil {
+			t.Fatal(err)
+		}
+
+		monitor := services.NewStalenessMonitor(orchestrator, repos.Devices, 10*time.Millisecond, 50*time.Millisecond)
+		monitor.Start()
+		defer monitor.Stop()
+
+		open := waitForOpenAlerts(t, repos, d.ID, 1)
+		if open[0].EventID != "stale-"+d.ID || open[0].TenantID != models.DefaultTenantID {
+			t.Fatalf("stale alert = %+v", open[0])
+		}
+		if got, _ := repos.Devices.Get(ctx, d.ID); got.Status != "offline" {
+			t.Fatalf("stale device status = %q, want offline", got.Status)
+		}
+
+		// A heartbeat resolves the alert
+		if _, err := repos.Devices.RecordHeartbeat(ctx, models.HeartbeatRequest{DeviceID: d.ID, Status: "online"}); err != nil {
+			t.Fatal(err)
+		}
+		waitForOpenAlerts(t, repos, d.ID, 0)
+	})
+}
@@ -0,0 +1,137 @@
+package integration
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/handlers"
+	"portofolionetworkapi/internal/middleware"
+)
+
+const webhookSecret = "zabbix-shared-secret"
+
+const zabbixEvent = `{"event_id":"E1","device":"Router-BDG-01","ip":"10.0.0.1","severity":"HIGH","problem":"Link down","status":"PROBLEM"}`
+
+// newWebhookRouter mounts the Zabbix webhook behind its verifier, as in
+// src/alert_integration_setup.go; the handler echoes the parsed event
+func newWebhookRouter(t *testing.T, allowed ...*net.IPNet) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	v := middleware.NewWebhookVerifier("zabbix", middleware.WebhookOptions{
+		Secret:          webhookSecret,
+		SignatureHeader: "X-Signature",
+		TimestampHeader: "X-Timestamp",
+		Tolerance:       time.Minute,
+		AllowedIPs:      allowed,
+	})
+	t.Cleanup(v.Stop)
+
+	router := gin.New()
+	if err := router.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	router.POST("/api/v1/webhooks/zabbix", v.Middleware(), func(c *gin.Context) {
+		var req handlers.ZabbixWebhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"event_id": req.EventID})
+	})
+	return router
+}
+
+func signWebhook(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(router *gin.Engine, body string, headers map[string]string, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/zabbix", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestZabbixWebhookSignature(t *testing.T) {
+	router := newWebhookRouter(t)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	signed := func(ts, body string) map[string]string {
+		return map[string]string{"X-Timestamp": ts, "X-Signature": signWebhook(webhookSecret, ts, body)}
+	}
+
+	if w := postWebhook(router, zabbixEvent, signed(now, zabbixEvent), ""); w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"E1"`)) {
+		t.Fatalf("signed request: status %d: %s", w.Code, w.Body)
+	}
+	if w := postWebhook(router, zabbixEvent, signed(now, zabbixEvent), ""); w.Code != http.StatusConflict {
+		t.Fatalf("replayed request: status %d, want 409", w.Code)
+	}
+
+	stale := strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(2*time.Minute).Unix(), 10)
+	tampered := signed(now, zabbixEvent)
+	bare := signed(now, `{"event_id":"E2"}`)
+	bare["X-Signature"] = bare["X-Signature"][len("sha256="):]
+	cases := []struct {
+		name    string
+		body    string
+		headers map[string]string
+		want    int
+	}{
+		{"unsigned", zabbixEvent, nil, http.StatusUnauthorized},
+		{"wrong secret", zabbixEvent, map[string]string{"X-Timestamp": now, "X-Signature": signWebhook("other-secret", now, zabbixEvent)}, http.StatusUnauthorized},
+		{"tampered body", zabbixEvent + " ", tampered, http.StatusUnauthorized},
+		{"timestamp not signed", zabbixEvent, map[string]string{"X-Timestamp": stale, "X-Signature": tampered["X-Signature"]}, http.StatusUnauthorized},
+		{"stale timestamp", zabbixEvent, signed(stale, zabbixEvent), http.StatusUnauthorized},
+		{"future timestamp", zabbixEvent, signed(future, zabbixEvent), http.StatusUnauthorized},
+		{"malformed timestamp", zabbixEvent, signed("yesterday", zabbixEvent), http.StatusUnauthorized},
+		// Passing verification does not skip payload validation
+		{"bare hex signature", `{"event_id":"E2"}`, bare, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if w := postWebhook(router, tc.body, tc.headers, ""); w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, w.Code, tc.want, w.Body)
+		}
+	}
+}
+
+func TestZabbixWebhookAllowedIPs(t *testing.T) {
+	_, zabbixNet, _ := net.ParseCIDR("192.0.2.0/28")
+	router := newWebhookRouter(t, zabbixNet)
+	// Rejected sources never reach the replay check, so one signature will do
+	sign := func() map[string]string {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		return map[string]string{"X-Timestamp": ts, "X-Signature": signWebhook(webhookSecret, ts, zabbixEvent)}
+	}
+
+	if w := postWebhook(router, zabbixEvent, sign(), "192.0.2.5:40000"); w.Code != http.StatusOK {
+		t.Fatalf("allowed source: status %d: %s", w.Code, w.Body)
+	}
+	if w := postWebhook(router, zabbixEvent, sign(), "198.51.100.7:40000"); w.Code != http.StatusForbidden {
+		t.Fatalf("other source: status %d, want 403", w.Code)
+	}
+
+	// X-Forwarded-For from an untrusted peer is ignored
+	headers := sign()
+	headers["X-Forwarded-For"] = "192.0.2.5"
+	if w := postWebhook(router, zabbixEvent, headers, "198.51.100.7:40000"); w.Code != http.StatusForbidden {
+		t.Fatalf("spoofed X-Forwarded-For: status %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+func enqueue(t *testing.T, repos repository.Repositories, deviceID string, timeout int) models.Command {
+	t.Helper()
+	cmd, err := repos.Commands.Enqueue(context.Background(), models.Command{
+		DeviceID: deviceID, Type: "reboot", Parameters: json.RawMessage(`{"delay":5}`), TimeoutSeconds: timeout,
+	})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	return cmd
+}
+
+// sameJSON compares JSON documents, ignoring the formatting Postgres JSONB applies
+func sameJSON(t *testing.T, got json.RawMessage, want string) bool {
+	t.Helper()
+	var a, b interface{}
+	if err := json.Unmarshal(got, &a); err != nil {
+		t.Fatalf("invalid JSON %q: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &b); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func TestCommandLifecycle(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		d := create(t, repos.Devices, "Router-BDG-01", "10.0.0.1")
+
+		first := enqueue(t, repos, d.ID, 60)
+		if len(first.ID) != 36 || first.Status != models.CommandStatusPending || first.DeviceID != d.ID ||
+			first.TimeoutSeconds != 60 || !sameJSON(t, first.Parameters, `{"delay":5}`) {
+			t.Fatalf("enqueued = %+v", first)
+		}
+		second := enqueue(t, repos, d.ID, 60)
+
+		if _, err := repos.Commands.Enqueue(ctx, models.Command{DeviceID: "00000000-0000-4000-8000-000000000000", Type: "reboot"}); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("unknown device: err = %v, want ErrNotFound", err)
+		}
+
+		// Claims hand out pending commands oldest first, once
+		claimed, err := repos.Commands.Claim(ctx, d.ID, 1)
+		if err != nil || len(claimed) != 1 || claimed[0].ID != first.ID ||
+			claimed[0].Status != models.CommandStatusDispatched || claimed[0].DispatchedAt == nil {
+			t.Fatalf("Claim = %+v, %v", claimed, err)
+		}
+		claimed, err = repos.Commands.Claim(ctx, d.ID, 10)
+		if err != nil || len(claimed) != 1 || claimed[0].ID != second.ID {
+			t.Fatalf("second Claim = %+v, %v", claimed, err)
+		}
+		if claimed, err = repos.Commands.Claim(ctx, d.ID, 10); err != nil || len(claimed) != 0 {
+			t.Fatalf("empty Claim = %+v, %v", claimed, err)
+		}
+
+		executing, err := repos.Commands.Report(ctx, first.ID, repository.CommandUpdate{Status: models.CommandStatusExecuting})
+		if err != nil || executing.Status != models.CommandStatusExecuting || executing.StartedAt == nil {
+			t.Fatalf("Report executing = %+v, %v", executing, err)
+		}
+		// Backwards transitions are refused with the current command
+		current, err := repos.Commands.Report(ctx, first.ID, repository.CommandUpdate{Status: models.CommandStatusDispatched})
+		if !errors.Is(err, repository.ErrStatusConflict) || current.Status != models.CommandStatusExecuting {
+			t.Fatalf("Report dispatched = %+v, %v, want ErrStatusConflict", current, err)
+		}
+		done, err := repos.Commands.Report(ctx, first.ID, repository.CommandUpdate{
+			Status: models.CommandStatusSucceeded, Result: json.RawMessage(`{"ok":true}`),
+		})
+		if err != nil || done.CompletedAt == nil || !sameJSON(t, done.Result, `{"ok":true}`) {
+			t.Fatalf("Report succeeded = %+v, %v", done, err)
+		}
+		if _, err := repos.Commands.Report(ctx, first.ID, repository.CommandUpdate{Status: models.CommandStatusFailed}); !errors.Is(err, repository.ErrStatusConflict) {
+			t.Fatalf("Report after terminal: err = %v, want ErrStatusConflict", err)
+		}
+		if _, err := repos.Commands.Report(ctx, "00000000-0000-4000-8000-000000000000", repository.CommandUpdate{Status: models.CommandStatusFailed}); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Report unknown: err = %v, want ErrNotFound", err)
+		}
+
+		got, err := repos.Commands.Get(ctx, first.ID)
+		if err != nil || got.Status != models.CommandStatusSucceeded {
+			t.Fatalf("Get = %+v, %v", got, err)
+		}
+
+		// Only commands dispatched longer ago than their timeout expire
+		quick := enqueue(t, repos, d.ID, 0)
+		if _, err := repos.Commands.Claim(ctx, d.ID, 10); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if n, err := repos.Commands.ExpireTimedOut(ctx); err != nil || n != 1 {
+			t.Fatalf("ExpireTimedOut = %d, %v", n, err)
+		}
+		if got, _ := repos.Commands.Get(ctx, quick.ID); got.Status != models.CommandStatusTimedOut || got.Error == "" {
+			t.Fatalf("expired command = %+v", got)
+		}
+		if got, _ := repos.Commands.Get(ctx, second.ID); got.Status != models.CommandStatusDispatched {
+			t.Fatalf("command within timeout = %+v", got)
+		}
+
+		recent, err := repos.Commands.RecentForDevice(ctx, d.ID, 10)
+		if err != nil || len(recent) != 3 {
+			t.Fatalf("RecentForDevice = %+v, %v", recent, err)
+		}
+	})
+}
+
+func TestCommandQuota(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		one := 1
+		if _, err := repos.Tenants.Create(ctx, "acme", "Acme", models.TenantQuotas{MaxCommandsPerHour: &one}); err != nil {
+			t.Fatal(err)
+		}
+		d, err := repos.Devices.Create(ctx, "acme", models.CreateDeviceRequest{Name: "Router-ACME-01", IPAddress: "10.0.0.1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		enqueue(t, repos, d.ID, 60)
+		_, err = repos.Commands.Enqueue(ctx, models.Command{DeviceID: d.ID, Type: "reboot"})
+		var quota *repository.QuotaExceededError
+		if !errors.As(err, &quota) || quota.Quota != models.QuotaCommandsPerHour || quota.Used != 1 || quota.Requested != 1 {
+			t.Fatalf("Enqueue over quota: err = %v", err)
+		}
+
+		// Other tenants are unaffected
+		enqueue(t, repos, create(t, repos.Devices, "Router-BDG-01", "10.0.0.2").ID, 60)
+
+		tenant, err := repos.Tenants.Get(ctx, "acme")
+		if err != nil || tenant.Usage.Devices != 1 || tenant.Usage.CommandsLastHour != 1 {
+			t.Fatalf("Get = %+v, %v", tenant, err)
+		}
+	})
+}
+
+func TestCommandJobs(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		a := create(t, repos.Devices, "Router-BDG-02", "10.0.0.2")
+		b := create(t, repos.Devices, "Router-BDG-01", "10.0.0.1")
+		create(t, repos.Devices, "Switch-BDG-01", "10.0.0.3")
+		cmd := models.Command{Type: "configure", Parameters: json.RawMessage(`{"ntp":"pool.ntp.org"}`), TimeoutSeconds: 60}
+
+		matched := 0
+		exec, err := repos.Commands.CreateJob(ctx, models.DeviceFilter{Name: "router-bdg-*"}, cmd, func(n int) error {
+			matched = n
+			return nil
+		})
+		if err != nil || matched != 2 || exec.TotalDevices != 2 || len(exec.Devices) != 2 ||
+			exec.Devices[0].DeviceID != b.ID || exec.Devices[1].DeviceID != a.ID ||
+			exec.Devices[0].Status != models.CommandStatusPending || exec.CommandType != "configure" {
+			t.Fatalf("CreateJob = %+v, %v (matched %d)", exec, err, matched)
+		}
+
+		got, err := repos.Commands.GetJob(ctx, exec.ID)
+		if err != nil || got.TotalDevices != 2 || len(got.Devices) != 2 || got.Devices[0].CommandID != exec.Devices[0].CommandID ||
+			!sameJSON(t, got.Parameters, `{"ntp":"pool.ntp.org"}`) || !sameJSON(t, got.DeviceFilter, `{"name":"router-bdg-*"}`) {
+			t.Fatalf("GetJob = %+v, %v", got, err)
+		}
+		queued, _ := repos.Commands.Get(ctx, exec.Devices[1].CommandID)
+		if queued.DeviceID != a.ID || queued.Type != "configure" || queued.TimeoutSeconds != 60 {
+			t.Fatalf("fanned-out command = %+v", queued)
+		}
+
+		// An error from accept aborts the job before anything is queued
+		errTooMany := errors.New("too many")
+		if _, err := repos.Commands.CreateJob(ctx, models.DeviceFilter{All: true}, cmd, func(n int) error {
+			if n != 3 {
+				t.Errorf("accept got %d devices, want 3", n)
+			}
+			return errTooMany
+		}); !errors.Is(err, errTooMany) {
+			t.Fatalf("rejected CreateJob: err = %v", err)
+		}
+		if recent, _ := repos.Commands.RecentForDevice(ctx, a.ID, 10); len(recent) != 1 {
+			t.Fatalf("commands after rejected job = %+v", recent)
+		}
+
+		if _, err := repos.Commands.GetJob(ctx, "00000000-0000-4000-8000-000000000000"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("GetJob unknown: err = %v, want ErrNotFound", err)
+		}
+
+		// The quota is checked for the whole fan-out at once
+		one := 1
+		if _, err := repos.Tenants.Create(ctx, "acme", "Acme", models.TenantQuotas{MaxCommandsPerHour: &one}); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"Router-ACME-01", "Router-ACME-02"} {
+			if _, err := repos.Devices.Create(ctx, "acme", models.CreateDeviceRequest{Name: name, IPAddress: "10.1.0.1"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err = repos.Commands.CreateJob(ctx, models.DeviceFilter{Name: "Router-ACME-*"}, cmd, func(int) error { return nil })
+		var quota *repository.QuotaExceededError
+		if !errors.As(err, &quota) || quota.TenantID != "acme" || quota.Requested != 2 {
+			t.Fatalf("CreateJob over quota: err = %v", err)
+		}
+		if tenant, _ := repos.Tenants.Get(ctx, "acme"); tenant.Usage.CommandsLastHour != 0 {
+			t.Fatalf("commands queued by rejected job: %+v", tenant.Usage)
+		}
+	})
+}
+
+func TestTenants(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		tenants, err := repos.Tenants.List(ctx)
+		if err != nil || len(tenants) != 1 || tenants[0].ID != models.DefaultTenantID || tenants[0].Quotas.MaxDevices != nil {
+			t.Fatalf("List = %+v, %v", tenants, err)
+		}
+
+		one := 1
+		created, err := repos.Tenants.Create(ctx, "acme", "Acme", models.TenantQuotas{MaxDevices: &one})
+		if err != nil || created.Name != "Acme" || created.Quotas.MaxDevices == nil || *created.Quotas.MaxDevices != 1 {
+			t.Fatalf("Create = %+v, %v", created, err)
+		}
+		if _, err := repos.Tenants.Create(ctx, "acme", "Other", models.TenantQuotas{}); !errors.Is(err, repository.ErrDuplicateTenant) {
+			t.Fatalf("duplicate Create: err = %v, want ErrDuplicateTenant", err)
+		}
+
+		if _, err := repos.Devices.Create(ctx, "acme", models.CreateDeviceRequest{Name: "a", IPAddress: "10.0.0.1"}); err != nil {
+			t.Fatal(err)
+		}
+		_, err = repos.Devices.Create(ctx, "acme", models.CreateDeviceRequest{Name: "b", IPAddress: "10.0.0.2"})
+		var quota *repository.QuotaExceededError
+		if !errors.As(err, &quota) || quota.Quota != models.QuotaDevices || quota.Used != 1 {
+			t.Fatalf("Create over device quota: err = %v", err)
+		}
+		if _, err := repos.Devices.Create(ctx, "nope", models.CreateDeviceRequest{Name: "c", IPAddress: "10.0.0.3"}); !errors.Is(err, repository.ErrTenantNotFound) {
+			t.Fatalf("Create in unknown tenant: err = %v, want ErrTenantNotFound", err)
+		}
+
+		// An empty name keeps the stored one; quotas are replaced
+		updated, err := repos.Tenants.Update(ctx, "acme", "", models.TenantQuotas{})
+		if err != nil || updated.Name != "Acme" || updated.Quotas.MaxDevices != nil || updated.Usage.Devices != 1 {
+			t.Fatalf("Update = %+v, %v", updated, err)
+		}
+		if _, err := repos.Devices.Create(ctx, "acme", models.CreateDeviceRequest{Name: "b", IPAddress: "10.0.0.2"}); err != nil {
+			t.Fatalf("Create after lifting quota: %v", err)
+		}
+
+		if _, err := repos.Tenants.Update(ctx, "nope", "Nope", models.TenantQuotas{}); !errors.Is(err, repository.ErrTenantNotFound) {
+			t.Fatalf("Update unknown: err = %v, want ErrTenantNotFound", err)
+		}
+		if _, err := repos.Tenants.Get(ctx, "nope"); !errors.Is(err, repository.ErrTenantNotFound) {
+			t.Fatalf("Get unknown: err = %v, want ErrTenantNotFound", err)
+		}
+		if tenants, _ := repos.Tenants.List(ctx); len(tenants) != 2 || tenants[0].ID != "acme" {
+			t.Fatalf("List after Create = %+v", tenants)
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"portofolionetworkapi/internal/database"
+	"portofolionetworkapi/internal/handlers"
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+// openDemo turns demo mode on over Postgres with a cap of maxDevices. Demo
+// mode works on the global database.DB, which is restored afterwards.
+func openDemo(t *testing.T, maxDevices int) (*sql.DB, repository.Repositories) {
+	t.Helper()
+	db := openPostgres(t)
+	previous := database.DB
+	database.DB = db
+	database.ConfigureDemoMode(true, maxDevices, 0)
+	t.Cleanup(func() {
+		database.ConfigureDemoMode(false, 25, 0)
+		database.DB = previous
+	})
+	return db, repository.NewPostgres(db)
+}
+
+func TestDemoDeviceCap(t *testing.T) {
+	_, repos := openDemo(t, 2)
+	create(t, repos.Devices, "Router-BDG-01", "10.0.0.1")
+	create(t, repos.Devices, "Router-BDG-02", "10.0.0.2")
+
+	_, err := repos.Devices.Create(context.Background(), models.DefaultTenantID,
+		models.CreateDeviceRequest{Name: "Router-BDG-03", IPAddress: "10.0.0.3", Location: "Bandung"})
+	var limitErr *repository.DeviceLimitError
+	if !errors.As(err, &limitErr) || limitErr.Count != 2 {
+		t.Fatalf("create over the cap: err = %v, want DeviceLimitError{2}", err)
+	}
+}
+
+func TestDemoStatusCountdown(t *testing.T) {
+	_, repos := openDemo(t, 2)
+	database.ConfigureDemoMode(true, 2, time.Hour)
+	database.StartDemoAutoReset()
+	t.Cleanup(database.StopDemoAutoReset)
+	create(t, repos.Devices, "Router-BDG-01", "10.0.0.1")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/demo/status", handlers.GetDemoStatus)
+	status := func() map[string]interface{} {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/demo/status", nil))
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		return body
+	}
+
+	got := status()
+	if got["enabled"] != true || got["device_count"] != 1.0 || got["remaining_slots"] != 1.0 || got["limit_reached"] != false {
+		t.Fatalf("demo status = %v", got)
+	}
+	if in := got["reset_in_seconds"].(float64); in <= 3500 || in > 3600 {
+		t.Fatalf("reset_in_seconds = %v, want just under an hour", in)
+	}
+
+	create(t, repos.Devices, "Router-BDG-02", "10.0.0.2")
+	if got := status(); got["limit_reached"] != true || got["remaining_slots"] != 0.0 {
+		t.Fatalf("demo status at the cap = %v", got)
+	}
+}
+
+func TestDemoResetUndoRestoresDependents(t *testing.T) {
+	db, repos := openDemo(t, 0)
+	ctx := context.Background()
+
+	d := create(t, repos.Devices, "Router-BDG-01", "10.0.0.1")
+	if _, err := repos.Devices.RecordHeartbeat(ctx, models.HeartbeatRequest{DeviceID: d.ID, Status: "online"}); err != nil {
+		t.Fatal(err)
+	}
+	cmd := enqueue(t, repos, d.ID, 60)
+	if _, err := repos.APIKeys.Create(ctx, models.DeviceAPIKey{DeviceID: d.ID, Prefix: "ndk_00000000demo", Hash: "demo-hash"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Alerts.Raise(ctx, models.Alert{
+		EventID: "evt-demo", DeviceID: d.ID, TenantID: models.DefaultTenantID, DeviceName: d.Name,
+		Severity: "High", Problem: "Link down", OpenedAt: time.Now().UTC(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	reset, err := database.ResetDatabase(models.DemoTriggerManual, "test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reset.DevicesBefore != 1 || reset.DevicesAfter != 3 {
+		t.Fatalf("reset = %+v", reset)
+	}
+	if _, _, err := repos.APIKeys.FindUsable(ctx, "ndk_00000000demo"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("key after reset: err = %v", err)
+	}
+
+	restore, err := database.UndoDemoReset(reset.ID, "test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"devices": 1, "device_heartbeats": 1, "commands": 1, "rollout_devices": 0, "device_api_keys": 1, "alert_links": 1}
+	for table, n := range want {
+		if restore.Restored[table] != n {
+			t.Errorf("restored %s = %d, want %d (%+v)", table, restore.Restored[table], n, restore.Restored)
+		}
+	}
+	if restore.DevicesBefore != 3 || restore.DevicesAfter != 1 {
+		t.Fatalf("restore = %+v", restore)
+	}
+
+	// The agent's key, history and queue come back with the device
+	if got, err := repos.Devices.Get(ctx, d.ID); err != nil || got.Name != d.Name {
+		t.Fatalf("restored device = %+v, %v", got, err)
+	}
+	if _, name, err := repos.APIKeys.FindUsable(ctx, "ndk_00000000demo"); err != nil || name != d.Name {
+		t.Fatalf("restored key: %q, %v", name, err)
+	}
+	if beats, err := repos.Devices.RecentHeartbeats(ctx, d.ID, 10); err != nil || len(beats) != 1 {
+		t.Fatalf("restored heartbeats = %+v, %v", beats, err)
+	}
+	if cmds, err := repos.Commands.RecentForDevice(ctx, d.ID, 10); err != nil || len(cmds) != 1 || cmds[0].ID != cmd.ID {
+		t.Fatalf("restored commands = %+v, %v", cmds, err)
+	}
+	if open, err := repos.Alerts.OpenForDevice(ctx, d.ID); err != nil || len(open) != 1 {
+		t.Fatalf("relinked alerts = %+v, %v", open, err)
+	}
+	if _, err := repos.Devices.Resolve(ctx, "Router-JKT-01"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("sample device after undo: err = %v", err)
+	}
+
+	if _, err := database.UndoDemoReset(reset.ID, "test", ""); !errors.Is(err, database.ErrDemoResetUndone) {
+		t.Fatalf("second undo: err = %v", err)
+	}
+
+	// Snapshots from before dependents were captured restore devices only
+	var legacyID int64
+	if err := db.QueryRow(`
+		INSERT INTO demo_resets (action, triggered_by, devices_before, devices_after, snapshot)
+		SELECT 'reset', 'manual', COUNT(*), 0, jsonb_agg(to_jsonb(d)) FROM devices d
+		RETURNING id
+	`).Scan(&legacyID); err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := database.UndoDemoReset(legacyID, "test", "")
+	if err != nil || len(legacy.Restored) != 1 || legacy.Restored["devices"] != 1 {
+		t.Fatalf("legacy undo = %+v, %v", legacy, err)
+	}
+	if _, _, err := repos.APIKeys.FindUsable(ctx, "ndk_00000000demo"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("key after legacy undo: err = %v", err)
+	}
+}
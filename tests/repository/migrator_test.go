@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"portofolionetworkapi/internal/database"
+)
+
+// forEachDriver runs fn against a migrated SQLite file and, when
+// TEST_DATABASE_URL is set, Postgres
+func forEachDriver(t *testing.T, fn func(t *testing.T, db *sql.DB, driver string)) {
+	t.Run("sqlite", func(t *testing.T) { fn(t, openSQLite(t), database.DriverSQLite) })
+	t.Run("postgres", func(t *testing.T) { fn(t, openPostgres(t), database.DriverPostgres) })
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	for _, driver := range []string{database.DriverPostgres, database.DriverSQLite} {
+		migrations, err := database.LoadMigrations(driver)
+		if err != nil {
+			t.Fatalf("%s: %v", driver, err)
+		}
+		// Versions are numbered from 1 without gaps, and every one can be
+		// rolled back
+		for i, m := range migrations {
+			if m.Version != i+1 || m.Up == "" || m.Down == "" {
+				t.Errorf("%s: migration %d is %03d_%s (up %d bytes, down %d bytes)",
+					driver, i+1, m.Version, m.Name, len(m.Up), len(m.Down))
+			}
+		}
+	}
+}
+
+func TestMigratorUpDownStatus(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *sql.DB, driver string) {
+		ctx := context.Background()
+		migrator, err := database.NewMigrator(db, driver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		version := func() int {
+			t.Helper()
+			applied, _, err := migrator.Version(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return applied
+		}
+
+		_, latest, err := migrator.Version(ctx)
+		if err != nil || version() != latest {
+			t.Fatalf("Version = %d of %d, %v", version(), latest, err)
+		}
+		if applied, err := migrator.Up(ctx, 0); err != nil || len(applied) != 0 {
+			t.Fatalf("Up when current applied %d, %v", len(applied), err)
+		}
+
+		// Down rolls back newest first
+		reverted, err := migrator.Down(ctx, 2)
+		if err != nil || len(reverted) != 2 || reverted[0].Version != latest || reverted[1].Version != latest-1 {
+			t.Fatalf("Down(2) = %+v, %v", reverted, err)
+		}
+		statuses, err := migrator.Status(ctx)
+		if err != nil || len(statuses) != latest {
+			t.Fatalf("Status = %+v, %v", statuses, err)
+		}
+		for _, st := range statuses {
+			if st.Applied != (st.Version <= latest-2) || st.Modified {
+				t.Errorf("status of %03d_%s = %+v", st.Version, st.Name, st)
+			}
+		}
+
+		// Up stops at the target, then applies the rest
+		if applied, err := migrator.Up(ctx, latest-1); err != nil || len(applied) != 1 || version() != latest-1 {
+			t.Fatalf("Up(%d) applied %+v, %v; at %d", latest-1, applied, err, version())
+		}
+		if applied, err := migrator.Up(ctx, 0); err != nil || len(applied) != 1 || version() != latest {
+			t.Fatalf("Up(0) applied %+v, %v; at %d", applied, err, version())
+		}
+
+		// A migration edited after being applied is reported as modified
+		if _, err := db.Exec(`UPDATE schema_migrations SET checksum = 'edited' WHERE version = 1`); err != nil {
+			t.Fatal(err)
+		}
+		statuses, err = migrator.Status(ctx)
+		if err != nil || !statuses[0].Modified || statuses[1].Modified {
+			t.Fatalf("Status after edit = %+v, %v", statuses, err)
+		}
+	})
+}
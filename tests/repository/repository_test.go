@@ -0,0 +1,791 @@
+// Package repository runs one contract suite against every repository
+// implementation: in-memory, SQLite and, when TEST_DATABASE_URL is set,
+// Postgres.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"portofolionetworkapi/internal/database"
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+type backend struct {
+	name string
+	open func(t *testing.T) repository.Repositories
+}
+
+var backends = []backend{
+	{"memory", func(t *testing.T) repository.Repositories {
+		return repository.NewMemory()
+	}},
+	{"sqlite", func(t *testing.T) repository.Repositories {
+		return repository.NewSQLite(openSQLite(t))
+	}},
+	{"postgres", func(t *testing.T) repository.Repositories {
+		return repository.NewPostgres(openPostgres(t))
+	}},
+}
+
+// openPostgres connects to TEST_DATABASE_URL, or skips the test when it is
+// not set
+func openPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.RunMigrations(db, database.DriverPostgres); err != nil {
+		t.Fatal(err)
+	}
+	// The suite owns the database: start every test from an empty
+	// inventory with only the default tenant
+	if _, err := db.Exec(`TRUNCATE tenants, users, command_jobs, rollouts CASCADE`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO tenants (id, name) VALUES ('default', 'Default')`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "netops.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.RunMigrations(db, database.DriverSQLite); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// forEachBackend runs fn once per backend with a fresh, empty repository
+func forEachBackend(t *testing.T, fn func(t *testing.T, repo repository.DeviceRepository)) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		fn(t, repos.Devices)
+	})
+}
+
+// forEachRepositories is forEachBackend for tests spanning several
+// repositories of the same backend
+func forEachRepositories(t *testing.T, fn func(t *testing.T, repos repository.Repositories)) {
+	for _, b := range backends {
+		b := b
+		t.Run(b.name, func(t *testing.T) {
+			fn(t, b.open(t))
+		})
+	}
+}
+
+func create(t *testing.T, repo repository.DeviceRepository, name, ip string) models.Device {
+	t.Helper()
+	d, err := repo.Create(context.Background(), models.DefaultTenantID,
+		models.CreateDeviceRequest{Name: name, IPAddress: ip, Location: "Bandung"})
+	if err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+	return d
+}
+
+func TestDeviceCRUD(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo repository.DeviceRepository) {
+		ctx := context.Background()
+		d := create(t, repo, "Router-BDG-01", "10.0.0.1")
+		if d.ID == "" || d.Status != "unknown" || d.Revision != 1 || d.TenantID != models.DefaultTenantID {
+			t.Fatalf("created device = %+v", d)
+		}
+
+		got, err := repo.Get(ctx, d.ID)
+		if err != nil || got.Name != d.Name || got.IPAddress != "10.0.0.1" || got.Location != "Bandung" {
+			t.Fatalf("Get = %+v, %v", got, err)
+		}
+
+		updated, err := repo.Update(ctx, d.ID, models.UpdateDeviceRequest{
+			Name: "Router-BDG-01", IPAddress: "10.0.0.2", Location: "Jakarta", Status: "online",
+		}, repository.Precondition{Enforced: true, Revisions: []int64{1}})
+		if err != nil || updated.Revision != 2 || updated.Location != "Jakarta" || updated.Status != "online" {
+			t.Fatalf("Update = %+v, %v", updated, err)
+		}
+
+		location := "Surabaya"
+		patched, err := repo.Patch(ctx, d.ID, repository.DevicePatch{"location": &location, "status": nil},
+			repository.Precondition{})
+		if err != nil || patched.Revision != 3 || patched.Location != "Surabaya" || patched.Status != "" {
+			t.Fatalf("Patch = %+v, %v", patched, err)
+		}
+		if same, err := repo.Patch(ctx, d.ID, repository.DevicePatch{}, repository.Precondition{}); err != nil || same.Revision != 3 {
+			t.Fatalf("empty Patch = %+v, %v", same, err)
+		}
+
+		if err := repo.Delete(ctx, d.ID, repository.Precondition{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Get(ctx, d.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Get after delete: err = %v, want ErrNotFound", err)
+		}
+		if err := repo.Delete(ctx, d.ID, repository.Precondition{}); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("second delete: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestDeviceDuplicateName(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo repository.DeviceRepository) {
+		ctx := context.Background()
+		a := create(t, repo, "a", "10.0.0.1")
+		create(t, repo, "b", "10.0.0.2")
+
+		_, err := repo.Create(ctx, models.DefaultTenantID, models.CreateDeviceRequest{Name: "a", IPAddress: "10.0.0.3"})
+		if !errors.Is(err, repository.ErrDuplicateName) {
+			t.Fatalf("create duplicate: err = %v, want ErrDuplicateName", err)
+		}
+
+		name := "b"
+		_, err = repo.Patch(ctx, a.ID, repository.DevicePatch{"name": &name}, repository.Precondition{})
+		if !errors.Is(err, repository.ErrDuplicateName) {
+			t.Fatalf("rename onto b: err = %v, want ErrDuplicateName", err)
+		}
+		if got, _ := repo.Get(ctx, a.ID); got.Name != "a" || got.Revision != 1 {
+			t.Fatalf("failed rename changed the device: %+v", got)
+		}
+	})
+}
+
+func TestDevicePreconditions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo repository.DeviceRepository) {
+		ctx := context.Background()
+		d := create(t, repo, "a", "10.0.0.1")
+		stale := repository.Precondition{Enforced: true, Revisions: []int64{7}}
+
+		status := "online"
+		if _, err := repo.Patch(ctx, d.ID, repository.DevicePatch{"status": &status}, stale); !errors.Is(err, repository.ErrRevisionMismatch) {
+			t.Fatalf("stale patch: err = %v, want ErrRevisionMismatch", err)
+		}
+		if err := repo.Delete(ctx, d.ID, stale); !errors.Is(err, repository.ErrRevisionMismatch) {
+			t.Fatalf("stale delete: err = %v, want ErrRevisionMismatch", err)
+		}
+		if err := repo.Delete(ctx, d.ID, repository.Precondition{Enforced: true}); !errors.Is(err, repository.ErrRevisionMismatch) {
+			t.Fatalf("delete with no acceptable revision: err = %v, want ErrRevisionMismatch", err)
+		}
+		if _, err := repo.Patch(ctx, "00000000-0000-4000-8000-000000000000", repository.DevicePatch{"status": &status}, stale); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("patch missing device: err = %v, want ErrNotFound", err)
+		}
+		if err := repo.Delete(ctx, d.ID, repository.Precondition{Enforced: true, Revisions: []int64{3, 1}}); err != nil {
+			t.Fatalf("delete with matching revision: %v", err)
+		}
+	})
+}
+
+func TestDeviceListPagination(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo repository.DeviceRepository) {
+		ctx := context.Background()
+		for i := 0; i < 7; i++ {
+			create(t, repo, fmt.Sprintf("router-%02d", (i*3)%7), fmt.Sprintf("10.0.0.%d", i+1))
+		}
+
+		for _, sortBy := range []string{repository.SortByName, repository.SortByCreatedAt, repository.SortByLastSeen} {
+			for _, order := range []string{"asc", "desc"} {
+				opts := repository.DeviceListOptions{Sort: sortBy, Order: order, Limit: 3}
+				seen := map[string]bool{}
+				var names []string
+				for page := 0; ; page++ {
+					devices, total, err := repo.List(ctx, opts)
+					if err != nil {
+						t.Fatalf("%s %s page %d: %v", sortBy, order, page, err)
+					}
+					if total != 7 {
+						t.Fatalf("%s %s: total = %d, want 7", sortBy, order, total)
+					}
+					for _, d := range devices {
+						if seen[d.ID] {
+							t.Fatalf("%s %s: %s returned twice", sortBy, order, d.Name)
+						}
+						seen[d.ID] = true
+						names = append(names, d.Name)
+					}
+					if len(devices) < opts.Limit {
+						break
+					}
+					last := devices[len(devices)-1]
+					cur := repository.DeviceCursor{Name: last.Name, Time: last.CreatedAt, ID: last.ID}
+					if sortBy == repository.SortByLastSeen {
+						cur.Time = last.LastSeen
+					}
+					opts.After = &cur
+				}
+				if len(seen) != 7 {
+					t.Fatalf("%s %s: paged through %d devices, want 7", sortBy, order, len(seen))
+				}
+				if sortBy == repository.SortByName {
+					first, lastName := "router-00", "router-06"
+					if order == "desc" {
+						first, lastName = lastName, first
+					}
+					if names[0] != first || names[6] != lastName {
+						t.Fatalf("name %s order: %v", order, names)
+					}
+				}
+			}
+		}
+	})
+}
+
+func TestDeviceListFilters(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo repository.DeviceRepository) {
+		ctx := context.Background()
+		create(t, repo, "Core-Router", "10.1.0.1")
+		create(t, repo, "edge_switch", "10.10.0.1")
+		create(t, repo, "edgeXswitch", "192.168.0.1")
+
+		cases := []struct {
+			filter repository.DeviceFilter
+			want   int
+		}{
+			{repository.DeviceFilter{Name: "router"}, 1},
+			{repository.DeviceFilter{Name: "EDGE"}, 2},
+			// "_" and "%" are literals, not LIKE wildcards
+			{repository.DeviceFilter{Name: "edge_"}, 1},
+			{repository.DeviceFilter{Name: "%"}, 0},
+			{repository.DeviceFilter{IPPrefix: "10.1"}, 2},
+			{repository.DeviceFilter{IPPrefix: "10.1."}, 1},
+			{repository.DeviceFilter{Location: "bandung"}, 3},
+			{repository.DeviceFilter{Locations: []string{"Jakarta", "BANDUNG"}}, 3},
+			{repository.DeviceFilter{Locations: []string{"Jakarta"}}, 0},
+			{repository.DeviceFilter{Locations: []string{}}, 0},
+			{repository.DeviceFilter{Status: "unknown", IPPrefix: "192."}, 1},
+			{repository.DeviceFilter{Tenant: "other"}, 0},
+		}
+		for _, tc := range cases {
+			devices, total, err := repo.List(ctx, repository.DeviceListOptions{
+				DeviceFilter: tc.filter, Sort: repository.SortByName, Order: "asc", Limit: 10,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tc.want || len(devices) != tc.want {
+				t.Errorf("filter %+v: %d devices (total %d), want %d", tc.filter, len(devices), total, tc.want)
+			}
+		}
+	})
+}
+
+func TestDeviceHeartbeats(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo repository.DeviceRepository) {
+		ctx := context.Background()
+		d := create(t, repo, "Router-BDG-01", "10.0.0.1")
+
+		// By name, case-insensitively: status changes, so the revision moves
+		id, err := repo.RecordHeartbeat(ctx, models.HeartbeatRequest{DeviceID: "router-bdg-01", Status: "online", Version: "7.1"})
+		if err != nil || id != d.ID {
+			t.Fatalf("RecordHeartbeat by name = %q, %v", id, err)
+		}
+		got, _ := repo.Get(ctx, d.ID)
+		if got.Status != "online" || got.Version != "7.1" || got.Revision != 2 || got.LastSeen.IsZero() {
+			t.Fatalf("after first heartbeat: %+v", got)
+		}
+
+		// Same status, version omitted: the revision stays
+		if _, err := repo.RecordHeartbeat(ctx, models.HeartbeatRequest{DeviceID: d.ID, Status: "online", Uptime: "1d"}); err != nil {
+			t.Fatal(err)
+		}
+		got, _ = repo.Get(ctx, d.ID)
+		if got.Version != "7.1" || got.Revision != 2 {
+			t.Fatalf("after routine heartbeat: %+v", got)
+		}
+
+		heartbeats, err := repo.RecentHeartbeats(ctx, d.ID, 10)
+		if err != nil || len(heartbeats) != 2 || heartbeats[0].Uptime != "1d" {
+			t.Fatalf("RecentHeartbeats = %+v, %v", heartbeats, err)
+		}
+
+		if _, err := repo.RecordHeartbeat(ctx, models.HeartbeatRequest{DeviceID: "missing", Status: "online"}); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("unknown device: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestDeviceResolveAndMatch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo repository.DeviceRepository) {
+		ctx := context.Background()
+		d := create(t, repo, "Router-BDG-01", "10.0.0.1")
+		other := create(t, repo, "Router-BDG-02", "10.0.0.2")
+
+		for _, ref := range []string{d.ID, "router-bdg-01"} {
+			if got, err := repo.Resolve(ctx, ref); err != nil || got.ID != d.ID {
+				t.Fatalf("Resolve(%q) = %+v, %v", ref, got, err)
+			}
+		}
+		if _, err := repo.Resolve(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Resolve unknown: err = %v, want ErrNotFound", err)
+		}
+
+		// The name wins over the address; the address is the fallback
+		if got, err := repo.Match(ctx, "ROUTER-BDG-01", "10.0.0.2"); err != nil || got.ID != d.ID {
+			t.Fatalf("Match by name = %+v, %v", got, err)
+		}
+		if got, err := repo.Match(ctx, "unknown", "10.0.0.2"); err != nil || got.ID != other.ID {
+			t.Fatalf("Match by address = %+v, %v", got, err)
+		}
+		if _, err := repo.Match(ctx, "unknown", "10.9.9.9"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Match unknown: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestDeviceStaleness(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo repository.DeviceRepository) {
+		ctx := context.Background()
+		d := create(t, repo, "Router-BDG-01", "10.0.0.1")
+		create(t, repo, "Router-BDG-02", "10.0.0.2") // never seen: not stale
+		if _, err := repo.RecordHeartbeat(ctx, models.HeartbeatRequest{DeviceID: d.ID, Status: "online"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if stale, err := repo.MarkStale(ctx, time.Hour); err != nil || len(stale) != 0 {
+			t.Fatalf("MarkStale within grace = %+v, %v", stale, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		stale, err := repo.MarkStale(ctx, 0)
+		if err != nil || len(stale) != 1 || stale[0].ID != d.ID || stale[0].Status != "offline" {
+			t.Fatalf("MarkStale = %+v, %v", stale, err)
+		}
+		if stale, err := repo.MarkStale(ctx, 0); err != nil || len(stale) != 0 {
+			t.Fatalf("second MarkStale = %+v, %v", stale, err)
+		}
+		if recovered, err := repo.MarkRecovered(ctx); err != nil || len(recovered) != 0 {
+			t.Fatalf("MarkRecovered without heartbeat = %+v, %v", recovered, err)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		if _, err := repo.RecordHeartbeat(ctx, models.HeartbeatRequest{DeviceID: d.ID, Status: "online"}); err != nil {
+			t.Fatal(err)
+		}
+		recovered, err := repo.MarkRecovered(ctx)
+		if err != nil || len(recovered) != 1 || recovered[0].ID != d.ID || recovered[0].Status != "online" {
+			t.Fatalf("MarkRecovered = %+v, %v", recovered, err)
+		}
+		if recovered, err := repo.MarkRecovered(ctx); err != nil || len(recovered) != 0 {
+			t.Fatalf("second MarkRecovered = %+v, %v", recovered, err)
+		}
+	})
+}
+
+func TestAlertHistory(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		d := create(t, repos.Devices, "Router-BDG-01", "10.0.0.1")
+		alert := models.Alert{
+			EventID: "evt-1", DeviceID: d.ID, TenantID: models.DefaultTenantID, DeviceName: d.Name,
+			IPAddress: d.IPAddress, Severity: "High", Problem: "Link down", TicketID: 42,
+			CustomersAffected: 10, SLAStatus: "ok", OpenedAt: time.Now().UTC(),
+		}
+		if err := repos.Alerts.Raise(ctx, alert); err != nil {
+			t.Fatal(err)
+		}
+
+		// Raising the same event updates it and keeps the ticket
+		alert.Severity, alert.TicketID = "Disaster", 0
+		if err := repos.Alerts.Raise(ctx, alert); err != nil {
+			t.Fatal(err)
+		}
+		open, err := repos.Alerts.OpenForDevice(ctx, d.ID)
+		if err != nil || len(open) != 1 || open[0].Severity != "Disaster" || open[0].TicketID != 42 || open[0].Status != models.AlertStatusOpen {
+			t.Fatalf("OpenForDevice = %+v, %v", open, err)
+		}
+
+		if err := repos.Alerts.Resolve(ctx, "evt-1", time.Now().UTC()); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Alerts.Resolve(ctx, "evt-unknown", time.Now().UTC()); err != nil {
+			t.Fatalf("Resolve unknown event: %v", err)
+		}
+		if open, err := repos.Alerts.OpenForDevice(ctx, d.ID); err != nil || len(open) != 0 {
+			t.Fatalf("OpenForDevice after Resolve = %+v, %v", open, err)
+		}
+		if err := repos.Alerts.Raise(ctx, alert); err != nil {
+			t.Fatal(err)
+		}
+		if open, _ := repos.Alerts.OpenForDevice(ctx, d.ID); len(open) != 1 {
+			t.Fatalf("reopened alert missing: %+v", open)
+		}
+
+		// Hourly quota: re-raising a counted event is free, a new one is not
+		one := 1
+		if _, err := repos.Tenants.Create(ctx, "acme", "Acme", models.TenantQuotas{MaxAlertsPerHour: &one}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Alerts.CheckQuota(ctx, "acme", "evt-2"); err != nil {
+			t.Fatalf("CheckQuota under quota: %v", err)
+		}
+		if err := repos.Alerts.Raise(ctx, models.Alert{EventID: "evt-2", TenantID: "acme", DeviceName: "unknown",
+			Severity: "High", SLAStatus: "ok", OpenedAt: time.Now().UTC()}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Alerts.CheckQuota(ctx, "acme", "evt-2"); err != nil {
+			t.Fatalf("CheckQuota for a counted event: %v", err)
+		}
+		var quota *repository.QuotaExceededError
+		if err := repos.Alerts.CheckQuota(ctx, "acme", "evt-3"); !errors.As(err, &quota) || quota.Quota != models.QuotaAlertsPerHour {
+			t.Fatalf("CheckQuota over quota: err = %v", err)
+		}
+		if err := repos.Alerts.CheckQuota(ctx, "nope", "evt-3"); !errors.Is(err, repository.ErrTenantNotFound) {
+			t.Fatalf("CheckQuota unknown tenant: err = %v, want ErrTenantNotFound", err)
+		}
+		if tenant, _ := repos.Tenants.Get(ctx, "acme"); tenant.Usage.AlertsLastHour != 1 {
+			t.Fatalf("acme usage = %+v", tenant.Usage)
+		}
+
+		// Deleting the device keeps its history, unlinked
+		if err := repos.Devices.Delete(ctx, d.ID, repository.Precondition{}); err != nil {
+			t.Fatal(err)
+		}
+		if open, err := repos.Alerts.OpenForDevice(ctx, d.ID); err != nil || len(open) != 0 {
+			t.Fatalf("OpenForDevice after delete = %+v, %v", open, err)
+		}
+	})
+}
+
+func TestAPIKeyRotation(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		d := create(t, repos.Devices, "Router-BDG-01", "10.0.0.1")
+		other := create(t, repos.Devices, "Router-BDG-02", "10.0.0.2")
+
+		issue := func(deviceID, prefix string, grace time.Duration) models.DeviceAPIKey {
+			t.Helper()
+			// Keys list by created_at, stored to the millisecond on SQLite
+			time.Sleep(2 * time.Millisecond)
+			k, err := repos.APIKeys.Create(ctx, models.DeviceAPIKey{DeviceID: deviceID, Prefix: prefix, Hash: prefix + "-hash"}, grace)
+			if err != nil {
+				t.Fatalf("Create %s: %v", prefix, err)
+			}
+			return k
+		}
+		usable := func(prefix string) bool {
+			t.Helper()
+			_, _, err := repos.APIKeys.FindUsable(ctx, prefix)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				t.Fatal(err)
+			}
+			return err == nil
+		}
+
+		first := issue(d.ID, "ndk_000000000001", time.Hour)
+		if first.Status != models.APIKeyStatusActive || first.ExpiresAt != nil || len(first.ID) != 36 {
+			t.Fatalf("first key = %+v", first)
+		}
+		k, name, err := repos.APIKeys.FindUsable(ctx, first.Prefix)
+		if err != nil || k.ID != first.ID || k.DeviceID != d.ID || k.Hash != "ndk_000000000001-hash" || name != d.Name {
+			t.Fatalf("FindUsable = %+v, %q, %v", k, name, err)
+		}
+		issue(other.ID, "ndk_0000000000ff", 0)
+
+		// Rotating with a grace period keeps the old key usable until it expires
+		second := issue(d.ID, "ndk_000000000002", time.Hour)
+		keys, err := repos.APIKeys.List(ctx, d.ID)
+		if err != nil || len(keys) != 2 || keys[0].ID != second.ID {
+			t.Fatalf("List = %+v, %v", keys, err)
+		}
+		if keys[1].Status != models.APIKeyStatusGrace || keys[1].ExpiresAt == nil ||
+			keys[1].ExpiresAt.Sub(keys[0].CreatedAt) < 59*time.Minute {
+			t.Fatalf("rotated key = %+v", keys[1])
+		}
+		if !usable(first.Prefix) || !usable(second.Prefix) {
+			t.Fatal("both keys should work during the grace period")
+		}
+
+		// A shorter grace period cuts the old key's expiry; it then lapses
+		issue(d.ID, "ndk_000000000003", 50*time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+		if usable(first.Prefix) || usable(second.Prefix) || !usable("ndk_000000000003") {
+			t.Fatal("rotated keys should expire after the grace period")
+		}
+		keys, _ = repos.APIKeys.List(ctx, d.ID)
+		if keys[2].Status != models.APIKeyStatusExpired {
+			t.Fatalf("first key status = %q, want expired", keys[2].Status)
+		}
+
+		// No grace period revokes the current key at once
+		fourth := issue(d.ID, "ndk_000000000004", 0)
+		keys, _ = repos.APIKeys.List(ctx, d.ID)
+		if keys[1].Status != models.APIKeyStatusRevoked || usable("ndk_000000000003") {
+			t.Fatalf("key rotated without grace = %+v", keys[1])
+		}
+
+		if err := repos.APIKeys.MarkUsed(ctx, fourth.ID); err != nil {
+			t.Fatal(err)
+		}
+		revoked, err := repos.APIKeys.Revoke(ctx, d.ID, fourth.ID)
+		if err != nil || revoked.Status != models.APIKeyStatusRevoked || revoked.RevokedAt == nil || revoked.LastUsedAt == nil {
+			t.Fatalf("Revoke = %+v, %v", revoked, err)
+		}
+		if usable(fourth.Prefix) {
+			t.Fatal("revoked key still usable")
+		}
+		for ref, want := range map[string]bool{d.ID: false, other.ID: true, "ROUTER-BDG-02": true} {
+			if has, err := repos.APIKeys.DeviceHasUsable(ctx, ref); err != nil || has != want {
+				t.Fatalf("DeviceHasUsable(%s) = %v, %v, want %v", ref, has, err, want)
+			}
+		}
+		if _, err := repos.APIKeys.Revoke(ctx, other.ID, first.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("revoking another device's key: err = %v, want ErrNotFound", err)
+		}
+
+		// Other devices' keys are untouched
+		if !usable("ndk_0000000000ff") {
+			t.Fatal("rotation affected another device")
+		}
+		missing := "00000000-0000-4000-8000-000000000000"
+		if _, err := repos.APIKeys.Create(ctx, models.DeviceAPIKey{DeviceID: missing, Prefix: "ndk_000000000009", Hash: "x"}, 0); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("unknown device: err = %v, want ErrNotFound", err)
+		}
+
+		// Deleting the device invalidates its keys
+		if err := repos.Devices.Delete(ctx, other.ID, repository.Precondition{}); err != nil {
+			t.Fatal(err)
+		}
+		if usable("ndk_0000000000ff") {
+			t.Fatal("key of a deleted device still usable")
+		}
+	})
+}
+
+func TestUserRefreshTokens(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		users := repos.Users
+
+		u, err := users.Create(ctx, "noc.bandung", "bcrypt-hash", models.DefaultTenantID, nil)
+		if err != nil || len(u.ID) != 36 || u.Username != "noc.bandung" || u.PasswordHash != "bcrypt-hash" ||
+			u.TenantID != models.DefaultTenantID || u.DisabledAt != nil {
+			t.Fatalf("Create = %+v, %v", u, err)
+		}
+		if _, err := users.Create(ctx, "noc.bandung", "x", models.DefaultTenantID, nil); !errors.Is(err, repository.ErrDuplicateUsername) {
+			t.Fatalf("duplicate username: err = %v", err)
+		}
+		if got, err := users.GetByUsername(ctx, "noc.bandung"); err != nil || got.ID != u.ID {
+			t.Fatalf("GetByUsername = %+v, %v", got, err)
+		}
+		if _, err := users.GetByUsername(ctx, "nobody"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("unknown username: err = %v", err)
+		}
+		other, _ := users.Create(ctx, "admin", "bcrypt-hash", models.DefaultTenantID, nil)
+		if list, err := users.List(ctx); err != nil || len(list) != 2 || list[0].ID != other.ID {
+			t.Fatalf("List = %+v, %v", list, err)
+		}
+
+		// Each refresh uses up the token and hands out the next one
+		if err := users.CreateRefreshToken(ctx, u.ID, "t1", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := users.RotateRefreshToken(ctx, "t1", "t2", time.Hour); err != nil || got.ID != u.ID {
+			t.Fatalf("Rotate t1 = %+v, %v", got, err)
+		}
+		if _, err := users.RotateRefreshToken(ctx, "t2", "t3", time.Hour); err != nil {
+			t.Fatalf("Rotate t2: %v", err)
+		}
+		if _, err := users.RotateRefreshToken(ctx, "missing", "x", time.Hour); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("unknown token: err = %v", err)
+		}
+
+		// A second login is a separate family
+		if err := users.CreateRefreshToken(ctx, u.ID, "s1", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		// Replaying t1 revokes t3, the family's current token
+		if _, err := users.RotateRefreshToken(ctx, "t1", "t4", time.Hour); !errors.Is(err, repository.ErrTokenReused) {
+			t.Fatalf("reused token: err = %v, want ErrTokenReused", err)
+		}
+		if _, err := users.RotateRefreshToken(ctx, "t3", "t5", time.Hour); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("token of a revoked family: err = %v, want ErrNotFound", err)
+		}
+		if _, err := users.RotateRefreshToken(ctx, "s1", "s2", time.Hour); err != nil {
+			t.Fatalf("other family affected by reuse: %v", err)
+		}
+
+		// Logout revokes the family; expired tokens don't rotate
+		if err := users.RevokeRefreshFamily(ctx, "s2"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.RotateRefreshToken(ctx, "s2", "s3", time.Hour); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("logged out token: err = %v", err)
+		}
+		if err := users.RevokeRefreshFamily(ctx, "unknown"); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.CreateRefreshToken(ctx, u.ID, "e1", 20*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if _, err := users.RotateRefreshToken(ctx, "e1", "e2", time.Hour); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("expired token: err = %v", err)
+		}
+
+		// Disabling a user ends their sessions
+		if err := users.CreateRefreshToken(ctx, u.ID, "d1", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		disabled, err := users.Disable(ctx, u.ID)
+		if err != nil || disabled.DisabledAt == nil {
+			t.Fatalf("Disable = %+v, %v", disabled, err)
+		}
+		if _, err := users.RotateRefreshToken(ctx, "d1", "d2", time.Hour); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("token of a disabled user: err = %v", err)
+		}
+		if _, err := users.Disable(ctx, "00000000-0000-4000-8000-000000000000"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("unknown user: err = %v", err)
+		}
+	})
+}
+
+func TestUserTenants(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		users := repos.Users
+
+		if _, err := users.Create(ctx, "noc.acme", "bcrypt-hash", "acme", nil); !errors.Is(err, repository.ErrTenantNotFound) {
+			t.Fatalf("unknown tenant: err = %v, want ErrTenantNotFound", err)
+		}
+		if _, err := repos.Tenants.Create(ctx, "acme", "Acme", models.TenantQuotas{}); err != nil {
+			t.Fatal(err)
+		}
+		u, err := users.Create(ctx, "noc.acme", "bcrypt-hash", "acme", nil)
+		if err != nil || u.TenantID != "acme" {
+			t.Fatalf("Create = %+v, %v", u, err)
+		}
+
+		// Tokens are issued from the rotated user, so it carries the tenant
+		if err := users.CreateRefreshToken(ctx, u.ID, "a1", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := users.RotateRefreshToken(ctx, "a1", "a2", time.Hour); err != nil || got.TenantID != "acme" {
+			t.Fatalf("Rotate = %+v, %v", got, err)
+		}
+		if list, err := users.List(ctx); err != nil || len(list) != 1 || list[0].TenantID != "acme" {
+			t.Fatalf("List = %+v, %v", list, err)
+		}
+	})
+}
+
+func TestUserRoles(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		users := repos.Users
+
+		grants := []models.RoleGrant{{Role: models.RoleViewer}, {Role: models.RoleOperator, Location: "Bandung"}}
+		u, err := users.Create(ctx, "eng.bandung", "bcrypt-hash", models.DefaultTenantID, grants)
+		if err != nil || len(u.Roles) != 2 || u.Roles[0] != grants[1] || u.Roles[1] != grants[0] {
+			t.Fatalf("Create = %+v, %v", u, err)
+		}
+		if got, err := users.GetByUsername(ctx, "eng.bandung"); err != nil || len(got.Roles) != 2 {
+			t.Fatalf("GetByUsername = %+v, %v", got, err)
+		}
+
+		// Setting roles replaces them all; tokens carry the current roles
+		admin := []models.RoleGrant{{Role: models.RoleAdmin}}
+		if got, err := users.SetRoles(ctx, u.ID, admin); err != nil || len(got.Roles) != 1 || got.Roles[0] != admin[0] {
+			t.Fatalf("SetRoles = %+v, %v", got, err)
+		}
+		if err := users.CreateRefreshToken(ctx, u.ID, "r1", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := users.RotateRefreshToken(ctx, "r1", "r2", time.Hour); err != nil || len(got.Roles) != 1 || got.Roles[0] != admin[0] {
+			t.Fatalf("Rotate = %+v, %v", got, err)
+		}
+
+		if _, err := users.Create(ctx, "nobody", "bcrypt-hash", models.DefaultTenantID, nil); err != nil {
+			t.Fatal(err)
+		}
+		list, err := users.List(ctx)
+		if err != nil || len(list) != 2 || len(list[0].Roles) != 1 || list[1].Roles == nil || len(list[1].Roles) != 0 {
+			t.Fatalf("List = %+v, %v", list, err)
+		}
+
+		if got, err := users.SetRoles(ctx, u.ID, nil); err != nil || len(got.Roles) != 0 {
+			t.Fatalf("SetRoles(nil) = %+v, %v", got, err)
+		}
+		if _, err := users.SetRoles(ctx, "00000000-0000-4000-8000-000000000000", admin); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("unknown user: err = %v", err)
+		}
+	})
+}
+
+func TestSQLiteAlertsAndCommands(t *testing.T) {
+	db := openSQLite(t)
+	repos := repository.NewSQLite(db)
+	ctx := context.Background()
+	d := create(t, repos.Devices, "Router-BDG-01", "10.0.0.1")
+
+	_, err := db.Exec(`
+		INSERT INTO alerts (event_id, device_id, device_name, status, opened_at)
+		VALUES ('evt-1', $1, 'Router-BDG-01', 'open', '2026-01-01 10:00:00.000'),
+			('evt-2', $1, 'Router-BDG-01', 'open', '2026-01-01 11:00:00.000'),
+			('evt-0', $1, 'Router-BDG-01', 'resolved', '2026-01-01 09:00:00.000')`, d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts, err := repos.Alerts.OpenForDevice(ctx, d.ID)
+	if err != nil || len(alerts) != 2 || alerts[0].EventID != "evt-2" {
+		t.Fatalf("OpenForDevice = %+v, %v", alerts, err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO commands (device_id, type, parameters) VALUES ($1, 'reboot', '{"delay":5}')`, d.ID); err != nil {
+		t.Fatal(err)
+	}
+	commands, err := repos.Commands.RecentForDevice(ctx, d.ID, 10)
+	if err != nil || len(commands) != 1 || commands[0].Type != "reboot" || len(commands[0].ID) != 36 {
+		t.Fatalf("RecentForDevice = %+v, %v", commands, err)
+	}
+
+	// Deleting the device cascades through the foreign keys
+	if err := repos.Devices.Delete(ctx, d.ID, repository.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM commands`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("commands left after device delete: %d, %v", n, err)
+	}
+}
+
+func TestSQLiteMigrationsRoundTrip(t *testing.T) {
+	db := openSQLite(t)
+	ctx := context.Background()
+	migrator, err := database.NewMigrator(db, database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := database.LoadMigrations(database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := migrator.Down(ctx, len(all))
+	if err != nil || len(reverted) != len(all) {
+		t.Fatalf("Down reverted %d of %d migrations: %v", len(reverted), len(all), err)
+	}
+	applied, err := migrator.Up(ctx, 0)
+	if err != nil || len(applied) != len(all) {
+		t.Fatalf("Up applied %d of %d migrations: %v", len(applied), len(all), err)
+	}
+
+	create(t, repository.NewSQLite(db).Devices, "a", "10.0.0.1")
+}
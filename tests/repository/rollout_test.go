@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+// onVersion creates a device that has reported version
+func onVersion(t *testing.T, repos repository.Repositories, name, ip, version string) models.Device {
+	t.Helper()
+	d := create(t, repos.Devices, name, ip)
+	if _, err := repos.Devices.RecordHeartbeat(context.Background(), models.HeartbeatRequest{DeviceID: d.ID, Status: "online", Version: version}); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func createRollout(t *testing.T, repos repository.Repositories, version string, filter models.DeviceFilter, waves ...int) string {
+	t.Helper()
+	id, err := repos.Rollouts.Create(context.Background(), models.Rollout{
+		TenantID: models.DefaultTenantID, TargetVersion: version, BatchSize: 1, FailureThreshold: 0.5, TimeoutSeconds: 60,
+	}, filter, func(n int) ([]int, int, error) {
+		if n != len(waves) {
+			t.Fatalf("plan got %d devices, want %d", n, len(waves))
+		}
+		return waves, waves[len(waves)-1], nil
+	})
+	if err != nil {
+		t.Fatalf("Create rollout: %v", err)
+	}
+	return id
+}
+
+var firmwareCommand = models.Command{
+	Type: models.FirmwareUpdateCommand, Parameters: json.RawMessage(`{"version":"2.0"}`), TimeoutSeconds: 60,
+}
+
+func TestRolloutWaves(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		a := onVersion(t, repos, "Router-BDG-01", "10.0.0.1", "1.0")
+		b := onVersion(t, repos, "Router-BDG-02", "10.0.0.2", "1.0")
+		onVersion(t, repos, "Router-BDG-03", "10.0.0.3", "2.0") // already upgraded
+
+		id := createRollout(t, repos, "2.0", models.DeviceFilter{All: true}, 1, 2)
+		ro, err := repos.Rollouts.Get(ctx, id)
+		if err != nil || ro.TenantID != models.DefaultTenantID || ro.Status != models.RolloutStatusRunning || ro.TotalWaves != 2 || ro.CurrentWave != 0 ||
+			ro.Progress.Total != 2 || ro.Progress.Pending != 2 || len(ro.Devices) != 2 ||
+			ro.Devices[0].DeviceID != a.ID || ro.Devices[1].Wave != 2 {
+			t.Fatalf("Get = %+v, %v", ro, err)
+		}
+		if running, _ := repos.Rollouts.Running(ctx); len(running) != 1 || running[0] != id {
+			t.Fatalf("Running = %v", running)
+		}
+
+		err = repos.Rollouts.Update(ctx, id, false, func(tx repository.RolloutTx) error {
+			if tx.Rollout().ID != id {
+				t.Errorf("tx rollout = %+v", tx.Rollout())
+			}
+			n, err := tx.StartWave(1, firmwareCommand)
+			if err != nil || n != 1 {
+				t.Errorf("StartWave = %d, %v", n, err)
+			}
+			if p, _ := tx.WaveProgress(1); p.Total != 1 || p.InProgress != 1 {
+				t.Errorf("WaveProgress(1) = %+v", p)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ro, _ = repos.Rollouts.Get(ctx, id)
+		first := ro.Devices[0]
+		if ro.CurrentWave != 1 || first.Status != models.RolloutDeviceInProgress || first.CommandID == "" || first.PreviousVersion != "1.0" {
+			t.Fatalf("after StartWave: %+v", ro)
+		}
+		if cmd, err := repos.Commands.Get(ctx, first.CommandID); err != nil || cmd.DeviceID != a.ID || cmd.Type != models.FirmwareUpdateCommand {
+			t.Fatalf("wave command = %+v, %v", cmd, err)
+		}
+
+		// The version in the command result confirms the upgrade
+		if _, err := repos.Commands.Claim(ctx, a.ID, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repos.Commands.Report(ctx, first.CommandID, repository.CommandUpdate{
+			Status: models.CommandStatusSucceeded, Result: json.RawMessage(`{"version":"2.0"}`),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Rollouts.SyncDevices(ctx); err != nil {
+			t.Fatal(err)
+		}
+		ro, _ = repos.Rollouts.Get(ctx, id)
+		if ro.Devices[0].Status != models.RolloutDeviceSucceeded || ro.Devices[0].CurrentVersion != "2.0" || ro.Progress.Succeeded != 1 {
+			t.Fatalf("after SyncDevices: %+v", ro)
+		}
+		if d, _ := repos.Devices.Get(ctx, a.ID); d.Version != "2.0" {
+			t.Fatalf("device version = %q, want 2.0", d.Version)
+		}
+
+		// A failing fn leaves the rollout and the queue untouched
+		errBoom := errors.New("boom")
+		err = repos.Rollouts.Update(ctx, id, false, func(tx repository.RolloutTx) error {
+			if _, err := tx.StartWave(2, firmwareCommand); err != nil {
+				return err
+			}
+			return errBoom
+		})
+		if !errors.Is(err, errBoom) {
+			t.Fatalf("Update = %v, want boom", err)
+		}
+		ro, _ = repos.Rollouts.Get(ctx, id)
+		if ro.CurrentWave != 1 || ro.Devices[1].Status != models.RolloutDevicePending {
+			t.Fatalf("after rolled back Update: %+v", ro)
+		}
+		if recent, _ := repos.Commands.RecentForDevice(ctx, b.ID, 10); len(recent) != 0 {
+			t.Fatalf("commands queued by rolled back Update: %+v", recent)
+		}
+
+		err = repos.Rollouts.Update(ctx, id, false, func(tx repository.RolloutTx) error {
+			return tx.SetStatus(models.RolloutStatusPaused, "manual")
+		})
+		if ro, _ = repos.Rollouts.Get(ctx, id); err != nil || ro.Status != models.RolloutStatusPaused || ro.PauseReason != "manual" {
+			t.Fatalf("after pause: %+v, %v", ro, err)
+		}
+		if running, _ := repos.Rollouts.Running(ctx); len(running) != 0 {
+			t.Fatalf("Running while paused = %v", running)
+		}
+
+		err = repos.Rollouts.Update(ctx, id, false, func(tx repository.RolloutTx) error {
+			if err := tx.SkipPending("rollout aborted"); err != nil {
+				return err
+			}
+			return tx.SetStatus(models.RolloutStatusAborted, "")
+		})
+		ro, _ = repos.Rollouts.Get(ctx, id)
+		if err != nil || ro.Status != models.RolloutStatusAborted || ro.PauseReason != "" || ro.CompletedAt == nil ||
+			ro.Devices[1].Status != models.RolloutDeviceSkipped || ro.Devices[1].Error != "rollout aborted" {
+			t.Fatalf("after abort: %+v, %v", ro, err)
+		}
+
+		list, err := repos.Rollouts.List(ctx, models.DefaultTenantID, 10)
+		if err != nil || len(list) != 1 || list[0].Progress.Succeeded != 1 || list[0].Progress.Skipped != 1 || len(list[0].Devices) != 0 {
+			t.Fatalf("List = %+v, %v", list, err)
+		}
+		if list, err := repos.Rollouts.List(ctx, "acme", 10); err != nil || len(list) != 0 {
+			t.Fatalf("List of another tenant = %+v, %v", list, err)
+		}
+
+		if err := repos.Rollouts.Update(ctx, "00000000-0000-4000-8000-000000000000", false, func(repository.RolloutTx) error { return nil }); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Update unknown: err = %v, want ErrNotFound", err)
+		}
+		if _, err := repos.Rollouts.Get(ctx, "00000000-0000-4000-8000-000000000000"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Get unknown: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestRolloutFailures(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		a := onVersion(t, repos, "Router-BDG-01", "10.0.0.1", "1.0")
+		b := onVersion(t, repos, "Router-BDG-02", "10.0.0.2", "1.0")
+
+		// An error from plan aborts the rollout
+		errPlan := errors.New("no devices")
+		if _, err := repos.Rollouts.Create(ctx, models.Rollout{TargetVersion: "2.0"}, models.DeviceFilter{All: true},
+			func(int) ([]int, int, error) { return nil, 0, errPlan }); !errors.Is(err, errPlan) {
+			t.Fatalf("Create with failing plan: err = %v", err)
+		}
+		if list, _ := repos.Rollouts.List(ctx, models.DefaultTenantID, 10); len(list) != 0 {
+			t.Fatalf("rollout stored despite plan error: %+v", list)
+		}
+
+		id := createRollout(t, repos, "2.0", models.DeviceFilter{All: true}, 1, 1)
+		if err := repos.Rollouts.Update(ctx, id, false, func(tx repository.RolloutTx) error {
+			_, err := tx.StartWave(1, firmwareCommand)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		// A failed command fails its device with the agent's error; a
+		// success without the new version stays in progress until the
+		// command timeout
+		ro, _ := repos.Rollouts.Get(ctx, id)
+		commands := map[string]string{}
+		for _, rd := range ro.Devices {
+			commands[rd.DeviceID] = rd.CommandID
+		}
+		for _, d := range []models.Device{a, b} {
+			if _, err := repos.Commands.Claim(ctx, d.ID, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := repos.Commands.Report(ctx, commands[a.ID], repository.CommandUpdate{Status: models.CommandStatusFailed, Error: "flash failed"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repos.Commands.Report(ctx, commands[b.ID], repository.CommandUpdate{Status: models.CommandStatusSucceeded}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Rollouts.SyncDevices(ctx); err != nil {
+			t.Fatal(err)
+		}
+		ro, _ = repos.Rollouts.Get(ctx, id)
+		if ro.Devices[0].Status != models.RolloutDeviceFailed || ro.Devices[0].Error != "flash failed" ||
+			ro.Devices[1].Status != models.RolloutDeviceInProgress {
+			t.Fatalf("after SyncDevices: %+v", ro.Devices)
+		}
+
+		// A heartbeat on the target version confirms the upgrade as well
+		if _, err := repos.Devices.RecordHeartbeat(ctx, models.HeartbeatRequest{DeviceID: b.ID, Status: "online", Version: "2.0"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Rollouts.SyncDevices(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if ro, _ = repos.Rollouts.Get(ctx, id); ro.Devices[1].Status != models.RolloutDeviceSucceeded {
+			t.Fatalf("after heartbeat: %+v", ro.Devices)
+		}
+		if p := ro.Progress; p.Failed != 1 || p.Succeeded != 1 {
+			t.Fatalf("progress = %+v", p)
+		}
+	})
+}
+
+func TestRolloutConflicts(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		a := onVersion(t, repos, "Router-BDG-01", "10.0.0.1", "1.0")
+		b := onVersion(t, repos, "Router-BDG-02", "10.0.0.2", "1.0")
+		first := createRollout(t, repos, "2.0", models.DeviceFilter{IDs: []string{a.ID}}, 1)
+
+		conflicts := func(status string) {
+			t.Helper()
+			_, err := repos.Rollouts.Create(ctx, models.Rollout{TargetVersion: "3.0"}, models.DeviceFilter{All: true},
+				func(n int) ([]int, int, error) { return make([]int, n), 1, nil })
+			var conflict *repository.RolloutConflictError
+			if !errors.As(err, &conflict) || len(conflict.Devices) != 1 || conflict.Devices[0] != "Router-BDG-01" {
+				t.Fatalf("Create over a %s rollout: err = %v", status, err)
+			}
+		}
+		conflicts(models.RolloutStatusRunning)
+		if err := repos.Rollouts.Update(ctx, first, false, func(tx repository.RolloutTx) error {
+			return tx.SetStatus(models.RolloutStatusPaused, "manual")
+		}); err != nil {
+			t.Fatal(err)
+		}
+		conflicts(models.RolloutStatusPaused)
+
+		// Devices outside active rollouts are free
+		createRollout(t, repos, "3.0", models.DeviceFilter{IDs: []string{b.ID}}, 1)
+
+		if err := repos.Rollouts.Update(ctx, first, false, func(tx repository.RolloutTx) error {
+			return tx.SetStatus(models.RolloutStatusAborted, "")
+		}); err != nil {
+			t.Fatal(err)
+		}
+		createRollout(t, repos, "3.0", models.DeviceFilter{IDs: []string{a.ID}}, 1)
+	})
+}
+
+func TestRolloutWaveQuota(t *testing.T) {
+	forEachRepositories(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		one := 1
+		if _, err := repos.Tenants.Create(ctx, "acme", "Acme", models.TenantQuotas{MaxCommandsPerHour: &one}); err != nil {
+			t.Fatal(err)
+		}
+		var devices []models.Device
+		for _, req := range []models.CreateDeviceRequest{
+			{Name: "Router-ACME-01", IPAddress: "10.0.0.1"},
+			{Name: "Router-ACME-02", IPAddress: "10.0.0.2"},
+		} {
+			d, err := repos.Devices.Create(ctx, "acme", req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			devices = append(devices, d)
+		}
+		id, err := repos.Rollouts.Create(ctx, models.Rollout{TenantID: "acme", TargetVersion: "2.0", TimeoutSeconds: 60},
+			models.DeviceFilter{All: true, Tenant: "acme"}, func(n int) ([]int, int, error) { return []int{1, 1}, 1, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A wave over the quota queues nothing
+		err = repos.Rollouts.Update(ctx, id, false, func(tx repository.RolloutTx) error {
+			_, err := tx.StartWave(1, firmwareCommand)
+			return err
+		})
+		var quota *repository.QuotaExceededError
+		if !errors.As(err, &quota) || quota.TenantID != "acme" || quota.Used != 0 || quota.Requested != 2 {
+			t.Fatalf("StartWave over quota: err = %v", err)
+		}
+		if ro, _ := repos.Rollouts.Get(ctx, id); ro.CurrentWave != 0 || ro.Progress.Pending != 2 {
+			t.Fatalf("rollout after refused wave: %+v", ro)
+		}
+		for _, d := range devices {
+			if cmds, err := repos.Commands.RecentForDevice(ctx, d.ID, 10); err != nil || len(cmds) != 0 {
+				t.Fatalf("commands of %s = %+v, %v", d.Name, cmds, err)
+			}
+		}
+
+		two := 2
+		if _, err := repos.Tenants.Update(ctx, "acme", "", models.TenantQuotas{MaxCommandsPerHour: &two}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Rollouts.Update(ctx, id, false, func(tx repository.RolloutTx) error {
+			queued, err := tx.StartWave(1, firmwareCommand)
+			if err == nil && queued != 2 {
+				t.Errorf("StartWave queued %d, want 2", queued)
+			}
+			return err
+		}); err != nil {
+			t.Fatalf("StartWave within quota: %v", err)
+		}
+	})
+}
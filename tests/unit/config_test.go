@@ -0,0 +1,166 @@
+package unit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"portofolionetworkapi/internal/config"
+)
+
+func TestConfigLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netops.yaml")
+	yaml := "odoo:\n  team_id: 4\n  url: https://odoo.example.com\nstaleness:\n  grace_period: 10m\n"
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("ODOO_TEAM_ID", "7")
+	t.Setenv("PORT", "9090")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Odoo.TeamID != 7 || cfg.Odoo.URL != "https://odoo.example.com" {
+		t.Errorf("odoo = %+v: env must override YAML, YAML must override defaults", cfg.Odoo)
+	}
+	if cfg.Staleness.GracePeriod != 10*time.Minute || cfg.Staleness.CheckInterval != time.Minute {
+		t.Errorf("staleness = %+v", cfg.Staleness)
+	}
+	if cfg.App.Port != 9090 {
+		t.Errorf("port = %d, want PORT to win", cfg.App.Port)
+	}
+}
+
+func TestConfigLoadRejectsMalformedValues(t *testing.T) {
+	t.Setenv("ODOO_TEAM_ID", "helpdesk")
+	t.Setenv("STALENESS_GRACE_PERIOD", "5")
+	t.Setenv("DB_DRIVER", "mysql")
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("AGENT_AUTH_DISABLED", "true")
+	t.Setenv("AGENT_API_KEY", "fleet-secret")
+	t.Setenv("JWT_SECRET", "too-short")
+	t.Setenv("ZABBIX_WEBHOOK_ALLOWED_IPS", "10.0.0.0/8, zabbix.local")
+
+	_, err := config.Load()
+	var cfgErr *config.Error
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("err = %v, want *config.Error", err)
+	}
+	msg := err.Error()
+	for _, name := range []string{"ODOO_TEAM_ID", "STALENESS_GRACE_PERIOD", "DB_DRIVER", "AGENT_AUTH_DISABLED", "AGENT_API_KEY", "JWT_SECRET",
+		"ZABBIX_WEBHOOK_ALLOWED_IPS", "ZABBIX_WEBHOOK_SECRET"} {
+		if !strings.Contains(msg, name) {
+			t.Errorf("error does not mention %s:\n%s", name, msg)
+		}
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://netops:hunter2@db:5432/netops")
+	t.Setenv("ODOO_PASSWORD", "odoo-secret")
+	t.Setenv("ADMIN_API_KEY", "admin-secret")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := cfg.Redacted()
+	db := out["database"].(map[string]interface{})
+	if db["url"] != "postgres://netops:xxxxx@db:5432/netops" {
+		t.Errorf("database.url = %v", db["url"])
+	}
+	if out["odoo"].(map[string]interface{})["password"] != "***" || out["auth"].(map[string]interface{})["admin_api_key"] != "***" {
+		t.Errorf("secrets not masked: %v", out)
+	}
+	if out["auth"].(map[string]interface{})["agent_api_key"] != "" {
+		t.Errorf("unset secret should stay empty: %v", out["auth"])
+	}
+	if out["staleness"].(map[string]interface{})["grace_period"] != "5m0s" {
+		t.Errorf("durations should render as strings: %v", out["staleness"])
+	}
+	if strings.Contains(cfg.Database.URL, "***") {
+		t.Error("Redacted modified the config")
+	}
+}
+
+func TestConfigRedactedDatabaseURLForms(t *testing.T) {
+	for raw, want := range map[string]string{
+		"postgres://netops@db/netops?sslmode=disable&password=hunter2": "postgres://netops@db/netops?password=xxxxx&sslmode=disable",
+		"postgres://netops@db/netops?sslpassword=hunter2":              "postgres://netops@db/netops?sslpassword=xxxxx",
+		"host=db user=netops password=hunter2 dbname=netops":           "***",
+		"db:5432/netops?password=hunter2":                              "***",
+	} {
+		t.Setenv("DATABASE_URL", raw)
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := cfg.Redacted()["database"].(map[string]interface{})["url"]
+		if got != want {
+			t.Errorf("%s: url = %v, want %s", raw, got, want)
+		}
+	}
+}
+
+func TestConfigStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(envFile, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("TELEGRAM_BOT_TOKEN=old-token\nTELEGRAM_CHAT_ID=100\nODOO_TEAM_ID=1\n")
+	// Variables set in the process win over .env, on reload too
+	t.Setenv("ODOO_DEFAULT_USER_ID", "9")
+
+	loader := config.NewLoader(envFile)
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := config.NewStore(loader, cfg)
+	var applied []*config.Config
+	store.OnReload(func(c *config.Config) { applied = append(applied, c) })
+
+	write("TELEGRAM_BOT_TOKEN=new-token\nTELEGRAM_CHAT_ID=200\nODOO_TEAM_ID=5\nODOO_DEFAULT_USER_ID=3\nBULK_MAX_DEVICES=10\n")
+	result, err := store.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := store.Current()
+	if got.Telegram.ChatID != "200" || got.Odoo.TeamID != 5 || got.Odoo.DefaultUserID != 9 {
+		t.Errorf("reloaded config = %+v %+v", got.Telegram, got.Odoo)
+	}
+	if got.Commands.BulkMaxDevices != 50 || len(result.RestartRequired) != 1 || result.RestartRequired[0] != "commands" {
+		t.Errorf("non-reloadable change: bulk_max_devices = %d, restart_required = %v",
+			got.Commands.BulkMaxDevices, result.RestartRequired)
+	}
+	if len(applied) != 1 || applied[0] != got {
+		t.Errorf("hook saw %d configs", len(applied))
+	}
+	if cfg.Telegram.ChatID != "100" {
+		t.Error("reload modified the previous snapshot")
+	}
+
+	// An invalid file leaves the running configuration alone
+	write("ODOO_TEAM_ID=helpdesk\n")
+	if _, err := store.Reload(); err == nil {
+		t.Fatal("reload accepted ODOO_TEAM_ID=helpdesk")
+	}
+	if store.Current() != got {
+		t.Error("failed reload replaced the configuration")
+	}
+
+	// Nothing changed: hooks don't run
+	write("TELEGRAM_BOT_TOKEN=new-token\nTELEGRAM_CHAT_ID=200\nODOO_TEAM_ID=5\nBULK_MAX_DEVICES=10\n")
+	if result, err = store.Reload(); err != nil || len(result.Applied) != 0 || len(applied) != 1 {
+		t.Errorf("no-op reload: %+v, %v, hooks ran %d times", result, err, len(applied))
+	}
+}
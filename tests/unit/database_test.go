@@ -0,0 +1,18 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"portofolionetworkapi/internal/database"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := database.RetryPolicy{Attempts: 10, InitialDelay: 500 * time.Millisecond, MaxDelay: 3 * time.Second}
+	want := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w {
+			t.Errorf("Delay(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"portofolionetworkapi/internal/models"
+	"portofolionetworkapi/internal/repository"
+)
+
+func TestNormalizeDeviceIP(t *testing.T) {
+	cases := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"10.0.0.1", "10.0.0.1", true},
+		{"2001:DB8::0001", "2001:db8::1", true},
+		{"10.0.0.5/24", "10.0.0.5/24", true},
+		{"fe80::1%eth0", "", false},
+		{"300.0.0.1", "", false},
+		{"", "", false},
+	}
+	for _, tc := range cases {
+		got, msg := models.NormalizeDeviceIP(tc.in)
+		if (msg == "") != tc.ok || got != tc.want {
+			t.Errorf("NormalizeDeviceIP(%q) = %q, %q", tc.in, got, msg)
+		}
+	}
+}
+
+func TestValidateDeviceName(t *testing.T) {
+	for _, name := range []string{"Router-BDG-01", "core sw.1", "a"} {
+		if msg := models.ValidateDeviceName(name); msg != "" {
+			t.Errorf("ValidateDeviceName(%q) = %q, want valid", name, msg)
+		}
+	}
+	for _, name := range []string{"", " Router", "-router", "router/1"} {
+		if models.ValidateDeviceName(name) == "" {
+			t.Errorf("ValidateDeviceName(%q) accepted an invalid name", name)
+		}
+	}
+}
+
+func TestPreconditionMatches(t *testing.T) {
+	if !(repository.Precondition{}).Matches(7) {
+		t.Error("an unenforced precondition must match any revision")
+	}
+	pre := repository.Precondition{Enforced: true, Revisions: []int64{2, 3}}
+	if !pre.Matches(3) || pre.Matches(4) {
+		t.Errorf("%+v matched the wrong revisions", pre)
+	}
+	if (repository.Precondition{Enforced: true}).Matches(1) {
+		t.Error("an enforced precondition without revisions must never match")
+	}
+}
+
+func TestMemoryDeviceRepositoryRenameConflict(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryDeviceRepository()
+
+	a, err := repo.Create(ctx, models.DefaultTenantID, models.CreateDeviceRequest{Name: "a", IPAddress: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Create(ctx, models.DefaultTenantID, models.CreateDeviceRequest{Name: "b", IPAddress: "10.0.0.2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "b"
+	_, err = repo.Patch(ctx, a.ID, repository.DevicePatch{"name": &name}, repository.Precondition{})
+	if !errors.Is(err, repository.ErrDuplicateName) {
+		t.Fatalf("rename onto an existing name: err = %v, want ErrDuplicateName", err)
+	}
+
+	got, err := repo.Get(ctx, a.ID)
+	if err != nil || got.Name != "a" || got.Revision != 1 {
+		t.Fatalf("failed patch changed the device: %+v, %v", got, err)
+	}
+}
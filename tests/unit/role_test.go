@@ -0,0 +1,47 @@
+package unit
+
+import (
+	"reflect"
+	"testing"
+
+	"portofolionetworkapi/internal/models"
+)
+
+func TestAuthUserCan(t *testing.T) {
+	u := models.AuthUser{Roles: []models.RoleGrant{
+		{Role: models.RoleViewer},
+		{Role: models.RoleOperator, Location: "Bandung"},
+		{Role: models.RoleOperator, Location: "Cimahi"},
+	}}
+
+	cases := []struct {
+		perm, location string
+		want           bool
+	}{
+		{models.PermDevicesRead, "", true},
+		{models.PermDevicesRead, "Jakarta", true},
+		{models.PermDevicesWrite, "bandung", true},
+		{models.PermDevicesWrite, "Jakarta", false},
+		{models.PermDevicesWrite, "", false},
+		{models.PermDevicesDelete, "Bandung", false},
+		{models.PermAlertsTest, "", false},
+	}
+	for _, tc := range cases {
+		if got := u.Can(tc.perm, tc.location); got != tc.want {
+			t.Errorf("Can(%s, %q) = %v, want %v", tc.perm, tc.location, got, tc.want)
+		}
+	}
+
+	if !u.CanSomewhere(models.PermCommandsExecute) || u.CanSomewhere(models.PermRolloutsManage) {
+		t.Error("CanSomewhere should follow scoped grants")
+	}
+	if locations, all := u.Locations(models.PermDevicesWrite); all || !reflect.DeepEqual(locations, []string{"Bandung", "Cimahi"}) {
+		t.Errorf("Locations(write) = %v, %v", locations, all)
+	}
+	if _, all := u.Locations(models.PermDevicesRead); !all {
+		t.Error("Locations(read) should be unrestricted")
+	}
+	if (models.AuthUser{}).Can(models.PermDevicesRead, "") {
+		t.Error("a user without roles can read")
+	}
+}